@@ -0,0 +1,56 @@
+package main
+
+import "log"
+
+// Settings -amp takes
+const (
+	ampOn   = "on"
+	ampOff  = "off"
+	ampAuto = "auto"
+)
+
+// Below this much gain the HackRF's RF amp adds more distortion and noise
+// than level, so -amp auto bypasses it
+const minAmpGainDB = 6
+
+// nominalAmpGain is the gain of a typical HackRF One's RF amp (an
+// MGA-81563, rated 0.1-6 GHz) by frequency: little below 100 MHz, about
+// 13 dB through UHF and L band, falling away above 3 GHz.
+var nominalAmpGain = []calPoint{
+	{1, 2}, {50, 7}, {100, 11}, {500, 13}, {2000, 12}, {3000, 10}, {4000, 7}, {5000, 4}, {6000, 2},
+}
+
+// ampGainAt returns the amp's nominal gain in dB at freqMHz.
+func ampGainAt(freqMHz float64) float64 {
+	return interpolate(nominalAmpGain, freqMHz)
+}
+
+// ampEnabled reports whether the amp should be on at freqMHz for an -amp
+// setting.
+func ampEnabled(mode string, freqMHz float64) bool {
+	switch mode {
+	case ampOff:
+		return false
+	case ampAuto:
+		return ampGainAt(freqMHz) >= minAmpGainDB
+	}
+	return true
+}
+
+// applyAmp switches the amp as the -amp setting has it for freqMHz. Unless
+// it is simply on, the choice is logged, as it changes the output level.
+func (d hackrfDevice) applyAmp(freqMHz float64) error {
+	on := ampEnabled(d.amp, freqMHz)
+	if err := d.SetAmpEnable(on); err != nil {
+		return err
+	}
+	switch {
+	case d.amp == ampOff:
+		log.Println("RF amp: off (-amp off)")
+	case d.amp == ampAuto && on:
+		log.Printf("RF amp: on at %.2f MHz, where it gives about %.0f dB", freqMHz, ampGainAt(freqMHz))
+	case d.amp == ampAuto:
+		log.Printf("RF amp: bypassed at %.2f MHz, where it gives only about %.0f dB", freqMHz, ampGainAt(freqMHz))
+	}
+	return nil
+}
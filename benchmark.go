@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"hackdvbs/consts"
+	"hackdvbs/dvbs"
+	"hackdvbs/filter"
+	"hackdvbs/radio"
+	"hackdvbs/ts"
+)
+
+// The benchmark loops the file until it has run for at least this long,
+// so a short clip still gives a steady figure.
+const benchmarkMinDuration = 3 * time.Second
+
+// packingSink is a dvbs.SampleWriter that packs samples into the radio's
+// wire format and throws them away, so the benchmark covers every step
+// the samples take on the way to the radio.
+type packingSink struct {
+	level   float32
+	buf     []byte
+	samples uint64
+}
+
+func (s *packingSink) WriteAll(samples []complex64) {
+	n := len(samples) * txFormat.BytesPerSample()
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	radio.PackIQ(s.buf[:n], samples, txFormat, s.level)
+	s.samples += uint64(len(samples))
+}
+
+// benchmark runs a TS file through the configured encoder, RRC filter and
+// I/Q packing as fast as the host allows and reports the sample rate
+// reached against the rate the radio needs. The file is read into memory
+// first, so the disk is not measured.
+func benchmark(path string, enc *dvbs.DVBSEncoder, rrc *filter.FIRFilter, level float32) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := ts.Validate(bytes.NewReader(data), 16); err != nil {
+		return err
+	}
+
+	sink := packingSink{level: level}
+	passes := 0
+	start := time.Now()
+	for passes == 0 || time.Since(start) < benchmarkMinDuration {
+		if err := dvbs.StreamToIQ(bytes.NewReader(data), &sink, enc, rrc); err != nil {
+			return err
+		}
+		passes++
+	}
+	elapsed := time.Since(start)
+
+	rate := float64(sink.samples) / elapsed.Seconds()
+	factor := rate / consts.HackRFSampleRate
+	fmt.Printf("Benchmark: %s, %d pass(es), %d samples in %v\n", path, passes, sink.samples, elapsed.Round(time.Millisecond))
+	fmt.Printf("  Encoder, %d-tap shaping filter and %s packing on one core\n", len(rrc.Taps), txFormat)
+	fmt.Printf("  Throughput: %.2f Msps (%.2f Msymbols/s)\n", rate/1e6, rate/float64(rrc.UpsampleFactor)/1e6)
+	fmt.Printf("  Required:   %.2f Msps, so this host runs at %.1fx real time\n", consts.HackRFSampleRate/1e6, factor)
+	switch {
+	case factor < 1:
+		fmt.Println("  Too slow: expect constant underflows. Try fewer -taps, or -shaping rc with fewer taps.")
+	case factor < 1.5:
+		fmt.Println("  Marginal: FFmpeg and USB also need CPU; expect underflows under load.")
+	default:
+		fmt.Println("  Fast enough.")
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyBitrateSignals returns channels for the signals that step the video
+// bitrate down (SIGUSR1) and up (SIGUSR2).
+func notifyBitrateSignals() (down, up <-chan os.Signal) {
+	d := make(chan os.Signal, 1)
+	u := make(chan os.Signal, 1)
+	signal.Notify(d, syscall.SIGUSR1)
+	signal.Notify(u, syscall.SIGUSR2)
+	return d, u
+}
@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// notifyBitrateSignals returns nil channels: Windows has no SIGUSR1/SIGUSR2.
+func notifyBitrateSignals() (down, up <-chan os.Signal) {
+	return nil, nil
+}
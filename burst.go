@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// burstKeyer keys the transmitter on and off on a fixed cycle. Samples keep
+// flowing from the ring buffer while keyed off so the stream stays in real
+// time and the receiver re-locks on the next burst.
+type burstKeyer struct {
+	onSamples    int64
+	cycleSamples int64
+	rampSamples  int64
+	shape        func(float64) float32
+	pos          int64
+}
+
+// parseBurst parses "on=2s,off=8s" into a keyer for the given sample rate,
+// with the given ramp on each edge.
+func parseBurst(spec string, sampleRate float64, ramp time.Duration, shape func(float64) float32) (*burstKeyer, error) {
+	var on, off time.Duration
+	for _, part := range strings.Split(spec, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=duration, got %q", part)
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration %q for %s", val, key)
+		}
+		switch key {
+		case "on":
+			on = d
+		case "off":
+			off = d
+		default:
+			return nil, fmt.Errorf("unknown burst key %q (want on, off)", key)
+		}
+	}
+	if on == 0 || off == 0 {
+		return nil, fmt.Errorf("both on and off durations are required")
+	}
+	if on < 2*ramp {
+		return nil, fmt.Errorf("on time %v is shorter than the key-up and key-down ramps", on)
+	}
+	return &burstKeyer{
+		onSamples:    int64(on.Seconds() * sampleRate),
+		cycleSamples: int64((on + off).Seconds() * sampleRate),
+		rampSamples:  int64(ramp.Seconds() * sampleRate),
+		shape:        shape,
+	}, nil
+}
+
+// DutyCycle returns the fraction of time the transmitter is keyed.
+func (k *burstKeyer) DutyCycle() float64 {
+	return float64(k.onSamples) / float64(k.cycleSamples)
+}
+
+// Apply scales the samples by the keying envelope and advances the cycle.
+func (k *burstKeyer) Apply(samples []complex64) {
+	for i := range samples {
+		samples[i] *= complex(k.gain(k.pos), 0)
+		k.pos++
+		if k.pos == k.cycleSamples {
+			k.pos = 0
+		}
+	}
+}
+
+func (k *burstKeyer) gain(pos int64) float32 {
+	switch {
+	case pos >= k.onSamples:
+		return 0
+	case pos < k.rampSamples:
+		return k.shape(float64(pos) / float64(k.rampSamples))
+	case pos >= k.onSamples-k.rampSamples:
+		return k.shape(float64(k.onSamples-pos) / float64(k.rampSamples))
+	}
+	return 1
+}
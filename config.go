@@ -0,0 +1,649 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"hackdvbs/consts"
+	"hackdvbs/dvbs"
+	"hackdvbs/filter"
+	"hackdvbs/utils"
+)
+
+// Config holds every setting, whether it came from a flag, the environment
+// or a config file. Defaults returns the built-in values and Validate checks
+// the whole set once everything is loaded.
+type Config struct {
+	// Radio
+	Freq           float64 // MHz
+	FreqCorrection float64 // ppm
+	Gain           int     // dB
+	Power          string
+	PowerCal       string
+	Soapy          string
+	AntennaPower   bool
+	Amp            string
+	NoRadio        bool
+
+	// Live encoder
+	Device        string
+	Input         string
+	PixFmt        string
+	VideoSize     string
+	FPS           int
+	VideoBitrate  string
+	MPEG2Profile  string
+	MPEG2Level    string
+	AudioBitrate  string
+	AudioCodec    string
+	AudioRate     int // Hz
+	AudioChannels int
+	Muxrate       string
+	ColorBars     bool
+	TestCard      bool
+	Callsign      string
+	TestCardText  string
+	AudioOnly     bool
+	Slideshow     string
+	Dwell         time.Duration
+
+	// Other sources
+	File            string
+	Playlist        string
+	RepeatPacket    string
+	UDPAddr         string
+	TCPAddr         string
+	Iface           string
+	RTP             bool
+	RTMPURL         string
+	SRTURL          string
+	ValidatePackets int
+
+	// Stream handling
+	StreamType    string
+	RestampPCR    bool
+	Smooth        bool
+	FreezeOnStall bool
+	Adaptive      bool
+	LockAssist    time.Duration
+	Prefill       string
+	MaxLatency    time.Duration
+	FlushOnEnd    bool
+	StreamCheck   time.Duration
+	DataSource    string
+	DataPID       int
+	DataRate      string
+
+	// Signal
+	Shaping       string
+	Taps          int
+	TapsFile      string
+	Phase         float64 // degrees
+	IFOffset      float64 // Hz
+	RampShape     string
+	RampTime      time.Duration
+	Burst         string
+	Backoff       float64 // dB
+	ConvGen       string
+	ConvTerminate bool
+	PilotEvery    int // packets
+	PilotPattern  string
+	Strict        bool
+
+	// Testing and debugging
+	SymClockPPM  float64 // ppm
+	Impair       string
+	NoScramble   bool
+	NoDispersal  bool
+	NoRS         bool
+	NoInterleave bool
+	NoConv       bool
+	InjectErrors string
+	AllowInvalid bool
+	CheckFraming bool
+	SelfMonitor  bool
+
+	// Outputs and operation
+	Sinks      string
+	IQOut      string
+	SymOut     string
+	RecordLast time.Duration
+	RecordDir  string
+	TSOut      string
+	StartAt    string
+	Duration   time.Duration
+	Control    string
+	ConfigFile string
+	LogFormat  string
+	Quiet      bool
+
+	// One-shot modes, which run instead of transmitting
+	ListDevices bool
+	InspectIQ   string
+	IQRate      float64 // samples/s
+	InspectTS   string
+	Benchmark   string
+	SelfTest    bool
+}
+
+// Defaults returns the settings used for anything not given.
+func Defaults() Config {
+	return Config{
+		Freq:            1250.0,
+		Gain:            30,
+		Amp:             ampOn,
+		Prefill:         prefillAuto,
+		Device:          "/dev/video0",
+		Input:           "auto",
+		PixFmt:          "auto",
+		VideoSize:       "640x480",
+		FPS:             30,
+		VideoBitrate:    "700k",
+		MPEG2Profile:    "main",
+		MPEG2Level:      mpeg2LevelAuto,
+		AudioBitrate:    "128k",
+		AudioCodec:      "mp2",
+		AudioRate:       44100,
+		AudioChannels:   2,
+		Dwell:           10 * time.Second,
+		StreamCheck:     3 * time.Second,
+		DataPID:         0x200,
+		DataRate:        "16k",
+		ValidatePackets: 16,
+		Shaping:         filter.ShapeRRC,
+		Taps:            consts.RRCFilterTaps,
+		RampShape:       "raised-cosine",
+		RampTime:        50 * time.Millisecond,
+		Backoff:         1,
+		TestCardText:    `{callsign}\n{freq} MHz\nSR {sr}`,
+		ConvGen:         "171,133",
+		PilotPattern:    defaultPilotPattern,
+		RecordDir:       "iq-record",
+		LogFormat:       "text",
+		IQRate:          consts.HackRFSampleRate,
+	}
+}
+
+// RegisterFlags defines a flag for every setting on fs, each defaulting to
+// its current value in c.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&c.Freq, "freq", c.Freq, "Transmit frequency in MHz")
+	fs.Float64Var(&c.FreqCorrection, "freq-correction", c.FreqCorrection, "Reference oscillator error in ppm, positive if the radio transmits high (measured, e.g., against a calibrated receiver); -freq is corrected by it")
+	fs.IntVar(&c.Gain, "gain", c.Gain, "TX gain in dB (the TX VGA gain, 0-47, on a HackRF)")
+	fs.StringVar(&c.Power, "power", c.Power, "Transmit power (e.g., -20dBm), translated to the nearest TX VGA gain through the calibration table; replaces -gain")
+	fs.StringVar(&c.PowerCal, "power-cal", c.PowerCal, "Calibration table for -power measured on this HackRF (default: nominal HackRF One figures)")
+	fs.StringVar(&c.Soapy, "soapy", c.Soapy, "Transmit through a SoapySDR device instead of a HackRF (e.g., driver=lime); needs a build with -tags soapy")
+	fs.StringVar(&c.Amp, "amp", c.Amp, "HackRF RF amp: on, off, or auto to bypass it at frequencies where it gives little gain (see README)")
+	fs.BoolVar(&c.AntennaPower, "antenna-power", c.AntennaPower, "Turn on the HackRF's antenna port power: 3.3 V DC at 50 mA at most on the TX port, too little for an LNB (see README)")
+	fs.BoolVar(&c.NoRadio, "no-radio", c.NoRadio, "Run the encoder without a HackRF, draining samples as fast as they are produced (for CI)")
+	fs.StringVar(&c.Device, "device", c.Device, "Video device (Linux) or device index (e.g., '0' for Windows/Mac)")
+	fs.StringVar(&c.Input, "input", c.Input, "Webcam capture on Linux: v4l2, rpicam (Raspberry Pi camera via rpicam-vid/libcamera-vid), or auto to use rpicam when a Pi camera is detected")
+	fs.StringVar(&c.PixFmt, "pixfmt", c.PixFmt, "Webcam capture format (e.g., mjpeg, yuyv422), or auto to pick one the device supports")
+	fs.StringVar(&c.VideoSize, "size", c.VideoSize, "Video resolution (e.g., 640x480, 1280x720)")
+	fs.IntVar(&c.FPS, "fps", c.FPS, "Frames per second")
+	fs.StringVar(&c.VideoBitrate, "vbitrate", c.VideoBitrate, "Video bitrate (e.g., 500k, 700k, 1M)")
+	fs.StringVar(&c.MPEG2Profile, "mpeg2-profile", c.MPEG2Profile, "MPEG-2 video profile: simple, main or high; set-top boxes expect main")
+	fs.StringVar(&c.MPEG2Level, "mpeg2-level", c.MPEG2Level, "MPEG-2 video level: low, main, high-1440, high, or auto for the lowest the -size and -fps fit (main, as broadcast SD, up to 720x576)")
+	fs.StringVar(&c.AudioBitrate, "abitrate", c.AudioBitrate, "Audio bitrate (e.g., 64k, 128k)")
+	fs.StringVar(&c.AudioCodec, "acodec", c.AudioCodec, "Audio codec: mp2, aac or ac3")
+	fs.IntVar(&c.AudioRate, "arate", c.AudioRate, "Audio sample rate in Hz, captured and encoded (e.g., 32000 for SD, 48000)")
+	fs.IntVar(&c.AudioChannels, "achannels", c.AudioChannels, "Audio channels captured and encoded: 1 (mono, for mono devices or to save bitrate) or 2")
+	fs.StringVar(&c.Muxrate, "muxrate", c.Muxrate, "MPEG-TS mux rate (e.g., 900k); defaults to the channel's net capacity")
+	fs.BoolVar(&c.ColorBars, "colorbars", c.ColorBars, "Use SMPTE color bars instead of webcam")
+	fs.BoolVar(&c.TestCard, "testcard", c.TestCard, "Transmit a test card for alignment: SMPTE bars and a 1 kHz tone, captioned with -testcard-text")
+	fs.StringVar(&c.Callsign, "callsign", c.Callsign, "Station callsign for the -testcard caption")
+	fs.StringVar(&c.TestCardText, "testcard-text", c.TestCardText, "Caption for -testcard; {callsign}, {freq} (MHz) and {sr} (symbol rate, kS/s) are filled in and \\n starts a new line")
+	fs.BoolVar(&c.AudioOnly, "audio-only", c.AudioOnly, "Transmit an audio-only radio service (no video)")
+	fs.StringVar(&c.Slideshow, "slideshow", c.Slideshow, "Transmit the images in this directory as a looping slideshow")
+	fs.DurationVar(&c.Dwell, "dwell", c.Dwell, "How long each -slideshow image is shown")
+	fs.StringVar(&c.File, "file", c.File, "Transmit a pre-recorded .ts file instead of live source")
+	fs.StringVar(&c.Playlist, "playlist", c.Playlist, "Transmit the .ts files listed in this file (one per line) back to back, looping forever")
+	fs.StringVar(&c.RepeatPacket, "repeat-packet", c.RepeatPacket, "DEBUG: transmit the single 188-byte TS packet in this file over and over")
+	fs.StringVar(&c.UDPAddr, "udp", c.UDPAddr, "Receive MPEG-TS over UDP instead of encoding locally (e.g., :5000, 239.1.1.1:5000, [ff05::1]:5000)")
+	fs.StringVar(&c.TCPAddr, "tcp", c.TCPAddr, "Receive MPEG-TS from a TCP server instead of encoding locally (e.g., 192.168.1.10:5000), reconnecting whenever the link drops")
+	fs.StringVar(&c.Iface, "iface", c.Iface, "Network interface to join the -udp multicast group on (default: system choice)")
+	fs.BoolVar(&c.RTP, "rtp", c.RTP, "The -udp stream is TS over RTP; strip the RTP headers")
+	fs.StringVar(&c.RTMPURL, "rtmp", c.RTMPURL, "Pull a live stream from an RTMP server and transcode it for transmission (e.g., rtmp://192.168.1.10/live/stream), reconnecting whenever it drops")
+	fs.StringVar(&c.SRTURL, "srt", c.SRTURL, "Pull a live stream over SRT and transcode it for transmission (e.g., srt://192.168.1.10:9000?mode=caller), reconnecting whenever it drops")
+	fs.IntVar(&c.ValidatePackets, "validate-packets", c.ValidatePackets, "Check that the first N packets of the input are 188-byte MPEG-TS before transmitting (0 to skip)")
+	fs.StringVar(&c.StreamType, "stream-type", c.StreamType, "Rewrite the PMT to advertise this stream_type for the video (the PCR stream), e.g. 0x24 for HEVC, or for given PIDs, e.g. 0x100=0x24,0x101=0x0f")
+	fs.BoolVar(&c.RestampPCR, "restamp-pcr", c.RestampPCR, "Rewrite PCRs to match the actual transmit timing at the channel bitrate")
+	fs.BoolVar(&c.Smooth, "smooth", c.Smooth, "Pace the TS at the channel capacity through a leaky bucket, spreading encoder bursts and padding gaps with null packets")
+	fs.BoolVar(&c.FreezeOnStall, "freeze-on-stall", c.FreezeOnStall, "Loop the last complete GOP (frozen frame) while the input stalls")
+	fs.BoolVar(&c.Adaptive, "adaptive", c.Adaptive, "On sustained underflows, lower the live encoder's frame rate to free CPU for the modulator")
+	fs.StringVar(&c.Prefill, "prefill", c.Prefill, "Samples to buffer before transmitting, as a duration (e.g., 1.5s), or auto to watch the source for a few seconds and keep twice its worst shortfall; more rides out source hiccups, less cuts latency")
+	fs.DurationVar(&c.MaxLatency, "max-latency", c.MaxLatency, "For live sources, skip to the next keyframe whenever more than this is buffered (e.g., 500ms), trading a glitch for lower latency (see README)")
+	fs.DurationVar(&c.LockAssist, "lock-assist", c.LockAssist, "Transmit this long of null packets before the stream (e.g., 500ms), a clean signal for scanning receivers to lock onto; content starts that much later")
+	fs.BoolVar(&c.FlushOnEnd, "flush-on-end", c.FlushOnEnd, "When the input ends, pad a partial last packet and flush the interleaver with null packets, so transmission ends on a complete packet and 8-packet group")
+	fs.DurationVar(&c.StreamCheck, "stream-check", c.StreamCheck, "Watch this much of the outgoing TS at startup and warn if the video or audio stream carries nothing (0 to skip)")
+	fs.StringVar(&c.DataSource, "datasource", c.DataSource, "Multiplex the lines of this file or FIFO, or the datagrams arriving on udp:ADDR, into the TS as private data (e.g., GPS or telemetry); a file is re-read from the top when it ends")
+	fs.IntVar(&c.DataPID, "datapid", c.DataPID, "PID for the -datasource stream, advertised in the PMT (e.g., 0x200)")
+	fs.StringVar(&c.DataRate, "datarate", c.DataRate, "Most of the channel the -datasource stream may take, in bits/s (e.g., 16k); it only replaces null packets")
+	fs.StringVar(&c.Shaping, "shaping", c.Shaping, "Pulse shape: rrc (DVB-S), or to save CPU on slow hosts rc or rect, at the cost of spectrum and MER (see README)")
+	fs.IntVar(&c.Taps, "taps", c.Taps, "Pulse shaping filter taps (odd), for rrc and rc; the filter spans (taps-1)/samples-per-symbol symbols")
+	fs.StringVar(&c.TapsFile, "taps-file", c.TapsFile, "Use the pulse shaping filter taps in this file, one number per line, designed at the 2 Msps sample rate, instead of -shaping and -taps")
+	fs.Float64Var(&c.Phase, "phase", c.Phase, "Rotate the QPSK constellation by this many degrees")
+	fs.Float64Var(&c.IFOffset, "ifoffset", c.IFOffset, "Shift the signal this many Hz from the tuned frequency, moving it off the LO leakage at the centre (tune the receiver to freq + offset)")
+	fs.StringVar(&c.RampShape, "ramp-shape", c.RampShape, "Envelope the carrier is keyed up and down with: linear, raised-cosine or exponential")
+	fs.DurationVar(&c.RampTime, "ramp-time", c.RampTime, "Duration of each key-up and key-down ramp (too fast splatters, too slow wastes airtime)")
+	fs.StringVar(&c.Burst, "burst", c.Burst, "Key the transmitter in bursts for duty-cycle-limited operation (e.g., on=2s,off=8s)")
+	fs.Float64Var(&c.Backoff, "backoff", c.Backoff, "Pack samples this many dB below the level at which the filter's worst-case peak reaches full scale; 0 is the loudest that never clips")
+	fs.StringVar(&c.ConvGen, "conv-gen", c.ConvGen, "DEBUG: inner code generators X,Y in octal, MSB tapping the newest bit (DVB-S is 171,133)")
+	fs.BoolVar(&c.ConvTerminate, "conv-terminate", c.ConvTerminate, "Flush the convolutional encoder with 6 zero tail bits after every packet (non-standard)")
+	fs.IntVar(&c.PilotEvery, "pilot-every", c.PilotEvery, "Insert the -pilot-pattern symbols after every this many packets (e.g., 8), a visible reference for tuning a receiver by hand; only receivers that strip them decode the stream (non-standard, see README)")
+	fs.StringVar(&c.PilotPattern, "pilot-pattern", c.PilotPattern, "QPSK symbols (0-3) -pilot-every inserts; the default alternates two opposite points, which look the same with the spectrum inverted")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "Transmit strictly to EN 300 421, for any conformant receiver (e.g. a satellite set-top box) rather than SDRangel: the inner code runs on across packets instead of restarting with each (see README)")
+	fs.Float64Var(&c.SymClockPPM, "symclock-ppm", c.SymClockPPM, "Run the symbol clock this many ppm fast (or slow, if negative) for testing receiver clock tolerance; still valid DVB-S, but off the nominal symbol rate")
+	fs.StringVar(&c.Impair, "impair", c.Impair, "Degrade the signal for receiver testing: noise=<Es/N0 dB>,cfo=<Hz>,timing=<fraction of a symbol>")
+	fs.BoolVar(&c.NoScramble, "no-scramble", c.NoScramble, "DEBUG: skip energy dispersal scrambling (invalid DVB-S)")
+	fs.BoolVar(&c.NoDispersal, "no-dispersal", c.NoDispersal, "DEBUG: skip the energy dispersal PRBS but keep the inverted sync byte every 8 packets, to see the payload structure on test equipment (invalid DVB-S)")
+	fs.BoolVar(&c.NoRS, "no-rs", c.NoRS, "DEBUG: send zero Reed-Solomon parity (invalid DVB-S)")
+	fs.BoolVar(&c.NoInterleave, "no-interleave", c.NoInterleave, "DEBUG: skip the convolutional interleaver (invalid DVB-S)")
+	fs.BoolVar(&c.NoConv, "no-conv", c.NoConv, "DEBUG: send uncoded bits instead of the rate 1/2 code (invalid DVB-S)")
+	fs.StringVar(&c.InjectErrors, "inject-errors", c.InjectErrors, "DEBUG: corrupt the coded stream after a stage, to measure a decoder's correction: STAGE:N/packet or STAGE:RATE, STAGE being rs, interleave or conv (invalid DVB-S)")
+	fs.BoolVar(&c.AllowInvalid, "allow-invalid-signal", c.AllowInvalid, "Permit transmitting with DEBUG options that produce a non-standard signal")
+	fs.BoolVar(&c.CheckFraming, "check-framing", c.CheckFraming, "Verify every packet descrambles correctly against the 8-packet sync framing, as a receiver would")
+	fs.BoolVar(&c.SelfMonitor, "self-monitor", c.SelfMonitor, "Demodulate a copy of the samples handed to the radio and report their MER and EVM, catching clipping and level problems live")
+	fs.StringVar(&c.Sinks, "sinks", c.Sinks, "Where the transmitted I/Q goes, any of radio, file (-iqout), stdout and fft (spectrum in the monitor), e.g. radio,file; default radio, plus file with -iqout")
+	fs.StringVar(&c.IQOut, "iqout", c.IQOut, "Also write the transmitted 8-bit I/Q samples to this file (hackrf_transfer format)")
+	fs.StringVar(&c.SymOut, "symout", c.SymOut, "Write the unfiltered QPSK symbols (one complex float32 per symbol, at the symbol rate) to this file or pipe, or - for stdout, instead of transmitting, for pulse shaping elsewhere")
+	fs.DurationVar(&c.RecordLast, "record-last", c.RecordLast, "Keep the last this much transmitted I/Q on disk as rolling 5 s segments (e.g., 30s), for reviewing what went out")
+	fs.StringVar(&c.RecordDir, "record-dir", c.RecordDir, "Directory for the -record-last segments")
+	fs.StringVar(&c.TSOut, "tsout", c.TSOut, "Also write the TS exactly as it enters the DVB-S encoder to this .ts file, for checking in a TS analyzer")
+	fs.StringVar(&c.StartAt, "start-at", c.StartAt, "Hold the stream, primed, and put the carrier on air at this time (RFC 3339, e.g., 2024-01-01T20:00:00Z)")
+	fs.DurationVar(&c.Duration, "duration", c.Duration, "Key down and stop after transmitting this long (e.g., 15m), from -start-at if given")
+	fs.StringVar(&c.Control, "control", c.Control, "Accept line commands (freq, gain, stop, start, vbitrate, stats) on this socket: unix:/path or host:port")
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "Read settings from this file, one \"flag = value\" per line; kill -HUP re-reads it and applies freq, gain, vbitrate and quiet live")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log output format: text or json")
+	fs.BoolVar(&c.Quiet, "quiet", c.Quiet, "Log errors and warnings only")
+	fs.BoolVar(&c.ListDevices, "list-devices", c.ListDevices, "List capture devices and their supported formats, then exit")
+	fs.StringVar(&c.InspectIQ, "inspect-iq", c.InspectIQ, "Analyse an 8-bit I/Q capture (hackrf_transfer -r) and report symbol rate, roll-off and constellation, then exit")
+	fs.Float64Var(&c.IQRate, "iq-rate", c.IQRate, "Sample rate of the -inspect-iq capture in samples/s")
+	fs.StringVar(&c.InspectTS, "inspect-ts", c.InspectTS, "Report a TS file's packet size, PAT and PMT, PIDs with bitrates, PCR, continuity and TEI errors and whether it is fit for DVB-S, then exit (non-zero if not); also hackdvbs inspect FILE")
+	fs.StringVar(&c.Benchmark, "benchmark", c.Benchmark, "Run this TS file through the encoder and filter as fast as possible, report the sample rate reached against what the radio needs, then exit")
+	fs.BoolVar(&c.SelfTest, "selftest", c.SelfTest, "Encode random data, check ACPR and MER of the result against limits, then exit (non-zero on failure)")
+}
+
+// Validate checks for values out of range and settings that cannot be
+// combined, before anything is opened. Whether -power and -gain were both
+// given is left to the caller, since only the flag set knows.
+func (c *Config) Validate() error {
+	// Radio
+	// Other radios are checked against their own range once open
+	if c.Soapy == "" && (c.Freq < minFreqMHz || c.Freq > maxFreqMHz) {
+		return fmt.Errorf("-freq %v: must be %.0f-%.0f MHz on a HackRF", c.Freq, minFreqMHz, maxFreqMHz)
+	}
+	if c.Freq <= 0 {
+		return fmt.Errorf("-freq %v: must be positive", c.Freq)
+	}
+	if math.Abs(c.FreqCorrection) > maxFreqCorrectionPPM {
+		return fmt.Errorf("-freq-correction %v: must be within ±%d ppm", c.FreqCorrection, maxFreqCorrectionPPM)
+	}
+	if c.Soapy == "" && (c.Gain < 0 || c.Gain > maxTXGain) {
+		return fmt.Errorf("-gain %d: must be 0-%d on a HackRF", c.Gain, maxTXGain)
+	}
+	if c.Power != "" {
+		if c.Soapy != "" {
+			return errors.New("-power cannot be used with -soapy: the calibration tables are for the HackRF")
+		}
+		if _, err := parsePower(c.Power); err != nil {
+			return fmt.Errorf("-power: %w", err)
+		}
+	} else if c.PowerCal != "" {
+		return errors.New("-power-cal cannot be used without -power")
+	}
+	if c.Amp != ampOn && c.Amp != ampOff && c.Amp != ampAuto {
+		return fmt.Errorf("-amp %q: must be on, off or auto", c.Amp)
+	}
+	if c.Amp != ampOn && (c.Soapy != "" || c.NoRadio) {
+		return errors.New("-amp cannot be used with -soapy or -no-radio: it is the HackRF's RF amp")
+	}
+	if c.AntennaPower && (c.Soapy != "" || c.NoRadio) {
+		return errors.New("-antenna-power cannot be used with -soapy or -no-radio: it is the HackRF's port power")
+	}
+
+	// Live encoder
+	if c.Input != "auto" && c.Input != "v4l2" && c.Input != "rpicam" {
+		return fmt.Errorf("-input %q: must be auto, v4l2 or rpicam", c.Input)
+	}
+	if _, ok := audioCodecs[c.AudioCodec]; !ok {
+		return fmt.Errorf("-acodec %q: must be mp2, aac or ac3", c.AudioCodec)
+	}
+	if err := checkAudioFormat(c.AudioCodec, c.AudioRate, c.AudioChannels); err != nil {
+		return fmt.Errorf("audio format: %w", err)
+	}
+	if c.FPS <= 0 {
+		return fmt.Errorf("-fps %d: must be positive", c.FPS)
+	}
+	width, height, err := parseVideoSize(c.VideoSize)
+	if err != nil {
+		return fmt.Errorf("-size %w", err)
+	}
+	if !c.AudioOnly {
+		if _, err := chooseMPEG2(c.MPEG2Profile, c.MPEG2Level, width, height, c.FPS); err != nil {
+			return err
+		}
+	}
+	if c.Muxrate != "" {
+		bps, err := utils.ParseBitrate(c.Muxrate)
+		if err != nil {
+			return fmt.Errorf("-muxrate: %w", err)
+		}
+		if capacity := c.Capacity(); bps > capacity {
+			return fmt.Errorf("-muxrate %s exceeds the channel capacity of %.1f kbps; use %dk or lower", c.Muxrate, capacity/1000, int(capacity/1000))
+		}
+	}
+	if c.Slideshow != "" && c.AudioOnly {
+		return errors.New("-slideshow and -audio-only cannot be combined")
+	}
+	if c.TestCard && (c.AudioOnly || c.Slideshow != "") {
+		return errors.New("-testcard cannot be combined with -audio-only or -slideshow")
+	}
+	if c.Dwell <= 0 {
+		return fmt.Errorf("-dwell %v: must be positive", c.Dwell)
+	}
+
+	// Other sources
+	if c.RTMPURL != "" && c.SRTURL != "" {
+		return errors.New("-rtmp and -srt cannot be combined")
+	}
+	if c.RTMPURL != "" {
+		if err := checkStreamURL(c.RTMPURL, "rtmp", "rtmps"); err != nil {
+			return fmt.Errorf("-rtmp: %w", err)
+		}
+	}
+	if c.SRTURL != "" {
+		if err := checkStreamURL(c.SRTURL, "srt"); err != nil {
+			return fmt.Errorf("-srt: %w", err)
+		}
+	}
+	if c.ValidatePackets < 0 {
+		return fmt.Errorf("-validate-packets %d: must be 0 or more", c.ValidatePackets)
+	}
+
+	// Stream handling
+	if c.StreamType != "" {
+		if _, err := parseStreamTypes(c.StreamType); err != nil {
+			return fmt.Errorf("-stream-type: %w", err)
+		}
+	}
+	if _, _, err := parsePrefill(c.Prefill); err != nil {
+		return fmt.Errorf("-prefill %w", err)
+	}
+	if c.MaxLatency < 0 || (c.MaxLatency > 0 && c.MaxLatency < 2*latencyFloor) {
+		return fmt.Errorf("-max-latency %v: must be 0 (off) or at least %v", c.MaxLatency, 2*latencyFloor)
+	}
+	if c.MaxLatency > 0 {
+		if c.File != "" || c.Playlist != "" || c.RepeatPacket != "" {
+			return errors.New("-max-latency is for live sources: -file, -playlist and -repeat-packet are read as fast as the buffer takes them, and would always be behind")
+		}
+		if d, auto, _ := parsePrefill(c.Prefill); !auto && d >= c.MaxLatency {
+			return fmt.Errorf("-prefill %v: must be less than -max-latency %v", d, c.MaxLatency)
+		}
+	}
+	if c.LockAssist < 0 {
+		return fmt.Errorf("-lock-assist %v: must be 0 or more", c.LockAssist)
+	}
+	if c.StreamCheck < 0 {
+		return fmt.Errorf("-stream-check %v: must be 0 or more", c.StreamCheck)
+	}
+	if c.DataSource != "" {
+		if c.DataPID < minDataPID || c.DataPID > maxDataPID {
+			return fmt.Errorf("-datapid %#x: must be %#x-%#x", c.DataPID, minDataPID, maxDataPID)
+		}
+		bps, err := utils.ParseBitrate(c.DataRate)
+		if err != nil {
+			return fmt.Errorf("-datarate: %w", err)
+		}
+		if capacity := c.Capacity(); bps <= 0 || bps >= capacity {
+			return fmt.Errorf("-datarate %s: must be positive and below the channel capacity of %.1f kbps", c.DataRate, capacity/1000)
+		}
+	}
+
+	// Signal. The rates are compiled in, but a bad combination must never
+	// reach the air.
+	if err := filter.ValidateRates(consts.SymbolRate, consts.HackRFSampleRate, consts.RollOffFactor); err != nil {
+		return fmt.Errorf("symbol and sample rates: %w", err)
+	}
+	if c.TapsFile != "" {
+		if c.Shaping != filter.ShapeRRC {
+			return errors.New("-taps-file replaces -shaping; give one or the other")
+		}
+		if _, err := c.Filter(); err != nil {
+			return fmt.Errorf("-taps-file %s: %w", c.TapsFile, err)
+		}
+	} else if _, err := c.Filter(); err != nil {
+		return fmt.Errorf("-shaping: %w", err)
+	}
+	if c.Shaping != filter.ShapeRect && c.TapsFile == "" {
+		if err := filter.ValidateTaps(c.Taps, int(consts.HackRFSampleRate/consts.SymbolRate)); err != nil {
+			return fmt.Errorf("-taps: %w", err)
+		}
+	}
+	occupied := consts.SymbolRate * (1 + consts.RollOffFactor)
+	if err := checkIFOffset(c.IFOffset, occupied, consts.HackRFSampleRate, basebandFilterBW); err != nil {
+		return fmt.Errorf("-ifoffset: %w", err)
+	}
+	shape, err := parseRampShape(c.RampShape)
+	if err != nil {
+		return fmt.Errorf("-ramp-shape: %w", err)
+	}
+	if c.RampTime <= 0 {
+		return fmt.Errorf("-ramp-time %v: must be positive", c.RampTime)
+	}
+	if c.Burst != "" {
+		if _, err := parseBurst(c.Burst, consts.HackRFSampleRate, c.RampTime, shape); err != nil {
+			return fmt.Errorf("-burst: %w", err)
+		}
+	}
+	if c.Backoff < 0 || c.Backoff > maxBackoffDB {
+		return fmt.Errorf("-backoff %v: must be 0-%d dB", c.Backoff, maxBackoffDB)
+	}
+	if _, _, err := parseConvGenerators(c.ConvGen); err != nil {
+		return fmt.Errorf("-conv-gen: %w", err)
+	}
+	if c.PilotEvery < 0 {
+		return fmt.Errorf("-pilot-every %d: must be 0 or more", c.PilotEvery)
+	}
+	if _, err := parsePilotPattern(c.PilotPattern); err != nil {
+		return fmt.Errorf("-pilot-pattern: %w", err)
+	}
+
+	// Testing and debugging
+	if c.Impair != "" {
+		if _, err := parseImpairments(c.Impair, consts.HackRFSampleRate); err != nil {
+			return fmt.Errorf("-impair: %w", err)
+		}
+	}
+	if c.Strict {
+		g1, g2, _ := parseConvGenerators(c.ConvGen)
+		if c.ConvTerminate || g1 != consts.ConvG1 || g2 != consts.ConvG2 || c.PilotEvery > 0 || c.NoScramble || c.NoDispersal || c.NoRS || c.NoInterleave || c.NoConv || c.InjectErrors != "" {
+			return errors.New("-strict cannot be combined with -conv-terminate, -conv-gen, -pilot-every, -no-scramble, -no-dispersal, -no-rs, -no-interleave, -no-conv or -inject-errors: they all make the signal non-standard")
+		}
+		if c.Shaping != filter.ShapeRRC || c.TapsFile != "" {
+			return errors.New("-strict needs the standard pulse shape: no -shaping other than rrc, and no -taps-file")
+		}
+	}
+	if c.InjectErrors != "" {
+		if _, err := parseErrorInjection(c.InjectErrors); err != nil {
+			return fmt.Errorf("-inject-errors: %w", err)
+		}
+	}
+	if math.Abs(c.SymClockPPM) > maxClockPPM {
+		return fmt.Errorf("-symclock-ppm %v: must be within ±%d", c.SymClockPPM, maxClockPPM)
+	}
+	if c.RecordLast < 0 {
+		return fmt.Errorf("-record-last %v: must be positive", c.RecordLast)
+	}
+
+	// Outputs and operation
+	if c.StartAt != "" {
+		at, err := time.Parse(time.RFC3339, c.StartAt)
+		if err != nil {
+			return fmt.Errorf("-start-at %q: must be an RFC 3339 time, such as 2024-01-01T20:00:00Z", c.StartAt)
+		}
+		if time.Until(at) < minStartLead {
+			return fmt.Errorf("-start-at %s: must be at least %v from now", c.StartAt, minStartLead)
+		}
+	}
+	if c.Duration < 0 {
+		return fmt.Errorf("-duration %v: must be positive", c.Duration)
+	}
+	if c.Sinks != "" {
+		sinks, err := parseSinks(c.Sinks)
+		if err != nil {
+			return fmt.Errorf("-sinks: %w", err)
+		}
+		if sinks[sinkRadio] && c.NoRadio {
+			return errors.New("-sinks radio cannot be combined with -no-radio")
+		}
+		if sinks[sinkFile] != (c.IQOut != "") {
+			return errors.New("-sinks file and -iqout go together: -iqout names the file")
+		}
+	}
+	if c.SymOut != "" {
+		// These all act on the filtered samples, which -symout replaces
+		if c.IQOut != "" || c.Sinks != "" || c.RecordLast > 0 || c.SelfMonitor || c.Impair != "" || c.SymClockPPM != 0 || c.IFOffset != 0 || c.Burst != "" {
+			return errors.New("-symout cannot be combined with -iqout, -sinks, -record-last, -self-monitor, -impair, -symclock-ppm, -ifoffset or -burst: there are no filtered samples")
+		}
+	}
+	return nil
+}
+
+// Level returns the level samples are packed at (see radio.PackIQ): the
+// clip-free maximum for the constellation and filter these settings give,
+// less Backoff.
+func (c *Config) Level() float32 {
+	enc := dvbs.NewDVBSEncoder()
+	enc.SetPhaseOffset(c.Phase)
+	rrc, _ := c.Filter()
+	return clipFreeLevel(enc, rrc) * float32(math.Pow(10, -c.Backoff/20))
+}
+
+// Filter returns a new pulse shaping filter for these settings.
+func (c *Config) Filter() (*filter.FIRFilter, error) {
+	if c.TapsFile != "" {
+		f, err := os.Open(c.TapsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		taps, err := filter.ReadTaps(f)
+		if err != nil {
+			return nil, err
+		}
+		return filter.NewFIRFilterFromTaps(taps, consts.SymbolRate, consts.HackRFSampleRate), nil
+	}
+	return filter.NewShapingFilter(c.Shaping, consts.SymbolRate, consts.HackRFSampleRate, consts.RollOffFactor, c.Taps)
+}
+
+// Capacity returns the net TS bitrate of the channel with these settings.
+func (c *Config) Capacity() float64 {
+	enc := dvbs.NewDVBSEncoder()
+	enc.SetConvTermination(c.ConvTerminate)
+	if c.PilotEvery > 0 {
+		pattern, _ := parsePilotPattern(c.PilotPattern)
+		enc.SetPilots(c.PilotEvery, pattern)
+	}
+	return enc.NetBitrate(consts.SymbolRate)
+}
+
+// Settings a SIGHUP reload applies to the running transmitter; any other
+// change in the config file waits for a restart.
+var liveSettings = map[string]bool{
+	"freq":     true,
+	"gain":     true,
+	"vbitrate": true,
+	"quiet":    true,
+}
+
+// readConfig parses a config file of "name = value" lines, one per flag
+// (the name without its dash). Blank lines and # comments are ignored.
+func readConfig(path string, fs *flag.FlagSet) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]string)
+	for n, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected name = value", path, n+1)
+		}
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		if fs.Lookup(name) == nil || name == "config" {
+			return nil, fmt.Errorf("%s:%d: unknown setting %q", path, n+1, name)
+		}
+		settings[name] = strings.Trim(strings.TrimSpace(val), `"`)
+	}
+	return settings, nil
+}
+
+// applyConfig sets the flags named in the config file, except those already
+// given on the command line or in the environment, which take precedence.
+func applyConfig(path string, fs *flag.FlagSet) (map[string]string, error) {
+	settings, err := readConfig(path, fs)
+	if err != nil {
+		return nil, err
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for name, val := range settings {
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, val); err != nil {
+			return nil, fmt.Errorf("%s: %s = %q: %v", path, name, val, err)
+		}
+	}
+	return settings, nil
+}
+
+// reloadConfig re-reads the config file and applies what changed since
+// the last load through apply, logging changes that need a restart.
+func reloadConfig(path string, fs *flag.FlagSet, last map[string]string, apply func(name, val string) error) map[string]string {
+	settings, err := readConfig(path, fs)
+	if err != nil {
+		log.Printf("WARNING: Reload failed, keeping the current settings: %v", err)
+		return last
+	}
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	changed := 0
+	for _, name := range names {
+		val := settings[name]
+		if old, ok := last[name]; ok && old == val {
+			continue
+		}
+		changed++
+		if !liveSettings[name] {
+			log.Printf("Reload: %s = %s ignored, it needs a restart", name, val)
+			continue
+		}
+		if err := apply(name, val); err != nil {
+			log.Printf("WARNING: Reload: %s = %s failed: %v", name, val, err)
+			settings[name] = last[name] // so the next reload tries again
+			continue
+		}
+		log.Printf("Reload: %s = %s applied", name, val)
+	}
+	if changed == 0 {
+		log.Printf("Reload: no changes in %s", path)
+	}
+	return settings
+}
@@ -9,4 +9,7 @@ const (
 	RRCFilterTaps    = 41  // Reduced for faster processing
 	InterleaveDepth  = 12
 	TSSyncByte       = 0x47
+	ConvG1           = 0x79 // 171 octal, DVB-S inner code generator X
+	ConvG2           = 0x5B // 133 octal, DVB-S inner code generator Y
+	ConvConstraint   = 7    // Constraint length K of the inner code
 )
\ No newline at end of file
@@ -2,19 +2,26 @@ package consts
 
 import "math"
 
-// Non-Standard DVB-S QPSK Gray mapping to match the SDRangel implementation.
-// The mappings for bits 01 and 10 are swapped compared to the ETSI standard.
+// QPSKAmplitude is each coordinate of a constellation point. At 1/√2 every
+// point has unit magnitude, so a symbol has unit energy and the transmit
+// level is set downstream, by the RRC filter's gain and the radio's
+// full-scale mapping, rather than here.
+const QPSKAmplitude = 1 / math.Sqrt2
+
+// DVB-S QPSK Gray mapping, as SDRangel has it. A symbol is X<<1 | Y, the
+// two outputs of the inner code, so X sets the sign of I and Y the sign of
+// Q: EN 300 421 figure 8, which puts 10 at (-1, 1) and 01 at (1, -1).
 var QPSKSymbolMap = map[byte]complex128{
-	0: complex(1/math.Sqrt2, 1/math.Sqrt2),   // bits 00 -> ( 1,  1)
-	1: complex(1/math.Sqrt2, -1/math.Sqrt2),  // bits 01 -> ( 1, -1) [SWAPPED]
-	2: complex(-1/math.Sqrt2, 1/math.Sqrt2), // bits 10 -> (-1,  1) [SWAPPED]
-	3: complex(-1/math.Sqrt2, -1/math.Sqrt2), // bits 11 -> (-1, -1)
+	0: complex(QPSKAmplitude, QPSKAmplitude),   // bits 00 -> ( 1,  1)
+	1: complex(QPSKAmplitude, -QPSKAmplitude),  // bits 01 -> ( 1, -1)
+	2: complex(-QPSKAmplitude, QPSKAmplitude),  // bits 10 -> (-1,  1)
+	3: complex(-QPSKAmplitude, -QPSKAmplitude), // bits 11 -> (-1, -1)
 }
 
 // Fast QPSK lookup - array is faster than map
 var QPSKFast = [4]complex64{
-	complex64(complex(1/math.Sqrt2, 1/math.Sqrt2)),
-	complex64(complex(1/math.Sqrt2, -1/math.Sqrt2)),
-	complex64(complex(-1/math.Sqrt2, 1/math.Sqrt2)),
-	complex64(complex(-1/math.Sqrt2, -1/math.Sqrt2)),
-}
\ No newline at end of file
+	complex64(complex(QPSKAmplitude, QPSKAmplitude)),
+	complex64(complex(QPSKAmplitude, -QPSKAmplitude)),
+	complex64(complex(-QPSKAmplitude, QPSKAmplitude)),
+	complex64(complex(-QPSKAmplitude, -QPSKAmplitude)),
+}
@@ -0,0 +1,32 @@
+package consts
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+// Every point must have unit magnitude and a quadrant of its own, and the
+// lookup array must agree with the map.
+func TestQPSK(t *testing.T) {
+	var quadrants [4]bool
+	for sym, p := range QPSKFast {
+		if m := cmplx.Abs(complex128(p)); math.Abs(m-1) > 1e-6 {
+			t.Errorf("QPSK point %d has magnitude %v, want 1", sym, m)
+		}
+		if cmplx.Abs(complex128(p)-QPSKSymbolMap[byte(sym)]) > 1e-6 {
+			t.Errorf("QPSK point %d is %v in the lookup array but %v in the map", sym, p, QPSKSymbolMap[byte(sym)])
+		}
+		q := 0
+		if real(p) < 0 {
+			q |= 1
+		}
+		if imag(p) < 0 {
+			q |= 2
+		}
+		if quadrants[q] {
+			t.Errorf("QPSK point %d shares a quadrant with another point", sym)
+		}
+		quadrants[q] = true
+	}
+}
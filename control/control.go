@@ -0,0 +1,143 @@
+// Package control serves a line-based command socket for driving the
+// transmitter from scripts and other processes.
+//
+// Each request is one line: a command name followed by space-separated
+// arguments. Each reply is one line, "OK" optionally followed by a result,
+// or "ERR" followed by the reason the command was not applied. A client may
+// send any number of commands on one connection.
+package control
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Handler runs a command with its arguments and returns the result text.
+// A returned error is reported to the client and nothing should have changed.
+type Handler func(args []string) (string, error)
+
+// Server accepts control connections and dispatches their commands.
+type Server struct {
+	ln   net.Listener
+	path string // socket file to remove on Close, for Unix sockets
+
+	mu       sync.Mutex // serialises commands across connections
+	handlers map[string]Handler
+	help     map[string]string
+}
+
+// Listen opens the control socket. addr is "unix:/path/to/socket" for a
+// Unix-domain socket, or a TCP address such as "127.0.0.1:5555". A stale
+// socket file left by an earlier run is replaced.
+func Listen(addr string) (*Server, error) {
+	network, address := "tcp", addr
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, address = "unix", path
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:       ln,
+		handlers: make(map[string]Handler),
+		help:     make(map[string]string),
+	}
+	if network == "unix" {
+		s.path = address
+	}
+	s.Handle("help", "help: list the commands", func([]string) (string, error) {
+		names := make([]string, 0, len(s.help))
+		for name := range s.help {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var b strings.Builder
+		for i, name := range names {
+			if i > 0 {
+				b.WriteString("; ")
+			}
+			b.WriteString(s.help[name])
+		}
+		return b.String(), nil
+	})
+	return s, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Handle registers a command. usage, such as "freq <MHz>: retune", is
+// shown by the help command.
+func (s *Server) Handle(name, usage string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = h
+	s.help[name] = usage
+}
+
+// Serve accepts connections until the server is closed.
+func (s *Server) Serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections and removes the socket file.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		reply := s.dispatch(fields[0], fields[1:])
+		if _, err := fmt.Fprintln(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(name string, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.handlers[strings.ToLower(name)]
+	if !ok {
+		return fmt.Sprintf("ERR unknown command %q (try help)", name)
+	}
+	result, err := h(args)
+	if err != nil {
+		log.Printf("Control: %s %s: %v", name, strings.Join(args, " "), err)
+		return "ERR " + err.Error()
+	}
+	if result == "" {
+		return "OK"
+	}
+	return "OK " + result
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"hackdvbs/ts"
+)
+
+const (
+	// -datapid range: below 0x20 is reserved for PSI/SI, and 0x1FFF is the
+	// null PID
+	minDataPID = 0x20
+	maxDataPID = 0x1FFE
+
+	// Messages -datasource reads ahead of the inserter; a full queue holds
+	// the reader back, which paces a looped file
+	dataQueue = 16
+
+	// Pause before a looped -datasource file is read again, so an empty
+	// or one-line file is not re-read in a tight loop
+	dataLoopDelay = 100 * time.Millisecond
+)
+
+// openDataSource starts reading -datasource messages in the background.
+// "udp:ADDR" takes each datagram received on ADDR as one message. Anything
+// else is a file or FIFO, read a line at a time. A regular file is read
+// again from the top when it ends, so a text crawl loops and can be edited
+// while running. A FIFO is read until the writer closes it.
+func openDataSource(spec string) (<-chan []byte, error) {
+	data := make(chan []byte, dataQueue)
+	if addr, ok := strings.CutPrefix(spec, "udp:"); ok {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			buf := make([]byte, 65536)
+			for {
+				n, _, err := conn.ReadFrom(buf)
+				if err != nil {
+					log.Printf("WARNING: Data source: %v", err)
+					return
+				}
+				data <- bytes.Clone(buf[:n])
+			}
+		}()
+		return data, nil
+	}
+
+	f, err := os.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	go func() {
+		for {
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(nil, ts.MaxDataMessage)
+			for scanner.Scan() {
+				if len(scanner.Bytes()) > 0 {
+					data <- bytes.Clone(scanner.Bytes())
+				}
+			}
+			f.Close()
+			if err := scanner.Err(); err != nil {
+				log.Printf("WARNING: Data source: %v", err)
+				return
+			}
+			if !info.Mode().IsRegular() {
+				log.Printf("Data source: %s closed", spec)
+				return
+			}
+			time.Sleep(dataLoopDelay)
+			if f, err = os.Open(spec); err != nil {
+				log.Printf("WARNING: Data source: %v", err)
+				return
+			}
+		}
+	}()
+	return data, nil
+}
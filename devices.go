@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// videoFormat is one capture format a device offers.
+type videoFormat struct {
+	PixFmt string            // FFmpeg pixel format / codec name (e.g. mjpeg, yuyv422)
+	Desc   string            // Human-readable description
+	Sizes  []string          // Supported resolutions, e.g. "640x480"
+	Rates  map[string]string // Frame rates per size, when known
+}
+
+var (
+	ffmpegFormatRe = regexp.MustCompile(`(Raw|Compressed)\s*:\s*(\S+)\s*:\s*(.*?)\s+:\s+(\d+x\d+.*)$`)
+	v4l2FormatRe   = regexp.MustCompile(`\[\d+\]: '(\w+)' \((.*)\)`)
+	v4l2SizeRe     = regexp.MustCompile(`Size: \w+ (\d+x\d+)`)
+	v4l2RateRe     = regexp.MustCompile(`\(([\d.]+) fps\)`)
+)
+
+// v4l2FourCC maps the V4L2 fourcc codes to FFmpeg's names for them.
+var v4l2FourCC = map[string]string{
+	"MJPG": "mjpeg",
+	"YUYV": "yuyv422",
+	"UYVY": "uyvy422",
+	"H264": "h264",
+	"NV12": "nv12",
+	"YU12": "yuv420p",
+	"RGB3": "rgb24",
+}
+
+// listVideoDevices prints the capture devices and the formats they support.
+func listVideoDevices() error {
+	switch runtime.GOOS {
+	case "linux":
+		if app, err := findRPiCamApp(); err == nil {
+			if cameras := listRPiCameras(app); len(cameras) > 0 {
+				fmt.Printf("Raspberry Pi cameras (-input rpicam, -device <index>)\n")
+				for _, c := range cameras {
+					fmt.Printf("  %s\n", c)
+				}
+				fmt.Println()
+			}
+		}
+		devices, _ := filepath.Glob("/dev/video*")
+		if len(devices) == 0 {
+			return fmt.Errorf("no /dev/video* devices found")
+		}
+		for _, dev := range devices {
+			formats, err := probeV4L2Formats(dev)
+			if err != nil {
+				fmt.Printf("%s: %v\n\n", dev, err)
+				continue
+			}
+			printVideoFormats(dev, formats)
+		}
+		return nil
+	case "windows":
+		return printFFmpegDeviceList("-list_devices", "true", "-f", "dshow", "-i", "dummy")
+	case "darwin":
+		return printFFmpegDeviceList("-f", "avfoundation", "-list_devices", "true", "-i", "")
+	}
+	return fmt.Errorf("device listing is not supported on %s", runtime.GOOS)
+}
+
+// probeV4L2Formats queries a V4L2 device, preferring v4l2-ctl (which also
+// reports frame rates) and falling back to FFmpeg's format listing.
+func probeV4L2Formats(device string) ([]videoFormat, error) {
+	if out, err := exec.Command("v4l2-ctl", "-d", device, "--list-formats-ext").Output(); err == nil {
+		if formats := parseV4L2CtlFormats(string(out)); len(formats) > 0 {
+			return formats, nil
+		}
+	}
+	// FFmpeg always exits non-zero here since there is no output; the listing is on stderr.
+	out, _ := exec.Command("ffmpeg", "-hide_banner", "-f", "v4l2", "-list_formats", "all", "-i", device).CombinedOutput()
+	formats := parseFFmpegFormats(string(out))
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no capture formats reported (not a capture device?)")
+	}
+	return formats, nil
+}
+
+// Capture formats to prefer, best first: MJPEG keeps USB bandwidth low at
+// larger sizes, YUYV is what every UVC camera offers.
+var preferredPixFmts = []string{"mjpeg", "yuyv422"}
+
+// choosePixelFormat picks the capture format to request from a device,
+// preferring formats that offer the wanted size.
+func choosePixelFormat(formats []videoFormat, size string) string {
+	candidates := formats
+	var withSize []videoFormat
+	for _, f := range formats {
+		for _, s := range f.Sizes {
+			if s == size {
+				withSize = append(withSize, f)
+				break
+			}
+		}
+	}
+	if len(withSize) > 0 {
+		candidates = withSize
+	}
+	for _, want := range preferredPixFmts {
+		for _, f := range candidates {
+			if f.PixFmt == want {
+				return want
+			}
+		}
+	}
+	return candidates[0].PixFmt
+}
+
+func parseV4L2CtlFormats(out string) []videoFormat {
+	var formats []videoFormat
+	var size string
+	for _, line := range strings.Split(out, "\n") {
+		if m := v4l2FormatRe.FindStringSubmatch(line); m != nil {
+			name, ok := v4l2FourCC[m[1]]
+			if !ok {
+				name = strings.ToLower(m[1])
+			}
+			formats = append(formats, videoFormat{PixFmt: name, Desc: m[2], Rates: map[string]string{}})
+			size = ""
+			continue
+		}
+		if len(formats) == 0 {
+			continue
+		}
+		f := &formats[len(formats)-1]
+		if m := v4l2SizeRe.FindStringSubmatch(line); m != nil {
+			size = m[1]
+			f.Sizes = append(f.Sizes, size)
+		} else if m := v4l2RateRe.FindStringSubmatch(line); m != nil && size != "" {
+			rate := strings.TrimSuffix(strings.TrimRight(m[1], "0"), ".")
+			if f.Rates[size] != "" {
+				f.Rates[size] += ","
+			}
+			f.Rates[size] += rate
+		}
+	}
+	return formats
+}
+
+func parseFFmpegFormats(out string) []videoFormat {
+	var formats []videoFormat
+	for _, line := range strings.Split(out, "\n") {
+		m := ffmpegFormatRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		formats = append(formats, videoFormat{
+			PixFmt: m[2],
+			Desc:   m[3],
+			Sizes:  strings.Fields(m[4]),
+		})
+	}
+	return formats
+}
+
+func printVideoFormats(device string, formats []videoFormat) {
+	fmt.Printf("%s\n", device)
+	fmt.Printf("  %-10s %-28s %-11s %s\n", "FORMAT", "DESCRIPTION", "SIZE", "FPS")
+	for _, f := range formats {
+		for i, size := range f.Sizes {
+			name, desc := f.PixFmt, f.Desc
+			if i > 0 {
+				name, desc = "", ""
+			}
+			rates := f.Rates[size]
+			if rates == "" {
+				rates = "-"
+			}
+			fmt.Printf("  %-10s %-28s %-11s %s\n", name, desc, size, rates)
+		}
+	}
+	fmt.Println()
+}
+
+func printFFmpegDeviceList(args ...string) error {
+	cmd := exec.Command("ffmpeg", append([]string{"-hide_banner"}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stdout
+	// The listing is printed as an error about the dummy input, so ignore the exit status.
+	cmd.Run()
+	return nil
+}
@@ -0,0 +1,45 @@
+package dvbs
+
+import "hackdvbs/consts"
+
+// InterleaveDelay is the end-to-end delay, in bytes, of Interleave followed
+// by Deinterleave: I*(I-1)*M, with M = 204/I bytes per branch cell.
+const InterleaveDelay = consts.InterleaveDepth * (consts.InterleaveDepth - 1) * (consts.RSPacketSize / consts.InterleaveDepth)
+
+// Deinterleaver is the receiver side of Interleave. Its branches mirror the
+// interleaver's: branch j delays by (I-1-j)*M cells where the interleaver's
+// delays by j*M, so every byte comes out after the same InterleaveDelay.
+type Deinterleaver struct {
+	fifos   [][]byte
+	indices []int
+	branch  int // branch the next byte goes through
+}
+
+// NewDeinterleaver creates a de-interleaver, with its delay lines zeroed like
+// the encoder's.
+func NewDeinterleaver() *Deinterleaver {
+	const I = consts.InterleaveDepth
+	const M = consts.RSPacketSize / I
+	d := &Deinterleaver{
+		fifos:   make([][]byte, I),
+		indices: make([]int, I),
+	}
+	for j := 0; j < I-1; j++ {
+		d.fifos[j] = make([]byte, (I-1-j)*M)
+	}
+	return d
+}
+
+// Deinterleave undoes Interleave in place on the next stretch of the byte
+// stream, which may be any length. The first byte ever passed in must be
+// the first byte of an interleaved packet, which goes through branch 0.
+func (d *Deinterleaver) Deinterleave(data []byte) {
+	for p := range data {
+		if fifo := d.fifos[d.branch]; fifo != nil {
+			idx := d.indices[d.branch]
+			data[p], fifo[idx] = fifo[idx], data[p]
+			d.indices[d.branch] = (idx + 1) % len(fifo)
+		}
+		d.branch = (d.branch + 1) % consts.InterleaveDepth
+	}
+}
@@ -0,0 +1,40 @@
+package dvbs
+
+import (
+	"math/rand"
+	"testing"
+
+	"hackdvbs/consts"
+)
+
+// RS packets through the interleaver round trip, several times its delay
+const roundTripPackets = 50
+
+// Interleaving random packets on a fresh encoder and de-interleaving the
+// result must give the input back exactly, delayed by InterleaveDelay, with
+// the zeroed delay lines in front of it, however the de-interleaver is fed.
+func TestInterleaveRoundTrip(t *testing.T) {
+	for _, chunk := range []int{consts.RSPacketSize, 1, 7, 1000} {
+		fec := NewDVBSEncoder().DVBSFEC()
+		rng := rand.New(rand.NewSource(1))
+		in := make([]byte, roundTripPackets*consts.RSPacketSize)
+		rng.Read(in)
+		out := make([]byte, 0, len(in))
+		for i := 0; i < len(in); i += consts.RSPacketSize {
+			out = append(out, fec.Interleave(in[i:i+consts.RSPacketSize])...)
+		}
+		d := NewDeinterleaver()
+		for i := 0; i < len(out); i += chunk {
+			d.Deinterleave(out[i:min(i+chunk, len(out))])
+		}
+		for k, b := range out {
+			want := byte(0)
+			if k >= InterleaveDelay {
+				want = in[k-InterleaveDelay]
+			}
+			if b != want {
+				t.Fatalf("%d-byte chunks: byte %d is %#02x, want %#02x (delay %d)", chunk, k, b, want, InterleaveDelay)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package dvbs
+
+import "hackdvbs/consts"
+
+// Descrambler is the receiver side of ScrambleTS. Like a real receiver it
+// anchors on the inverted sync byte that starts each 8-packet group rather
+// than counting packets from the start of the stream, so it shows whether
+// the framing the encoder produces stays aligned.
+type Descrambler struct {
+	locked    bool
+	pos       int // packet index within the current 8-packet group
+	prbsIndex int
+	errors    uint64
+}
+
+// Descramble undoes ScrambleTS in place. It returns false if the packet
+// breaks the 8-packet framing: an inverted sync byte anywhere but the start
+// of a group, a missing one at the start of a group, or a packet seen before
+// the first group start. The descrambler re-anchors on the next inverted
+// sync byte.
+func (d *Descrambler) Descramble(pkt []byte) bool {
+	inverted := pkt[0] == ^byte(consts.TSSyncByte)
+	if !inverted && pkt[0] != consts.TSSyncByte {
+		d.errors++
+		return false
+	}
+	ok := true
+	if inverted {
+		if d.locked && d.pos != 0 {
+			d.errors++
+			ok = false
+		}
+		d.locked = true
+		d.pos = 0
+		d.prbsIndex = 0
+		pkt[0] = consts.TSSyncByte
+	} else {
+		if !d.locked {
+			return false
+		}
+		if d.pos == 0 {
+			d.errors++
+			ok = false
+		}
+		// Same one-step advance over the unscrambled sync byte as ScrambleTS
+		d.prbsIndex++
+	}
+
+	for i := 1; i < consts.TSPacketSize; i++ {
+		if d.prbsIndex >= len(PrbsLUT) {
+			d.prbsIndex = 0
+		}
+		pkt[i] ^= PrbsLUT[d.prbsIndex]
+		d.prbsIndex++
+	}
+	d.pos = (d.pos + 1) % 8
+	return ok
+}
+
+// Errors returns the number of packets that broke the framing.
+func (d *Descrambler) Errors() uint64 {
+	return d.errors
+}
@@ -0,0 +1,87 @@
+package dvbs
+
+import (
+	"bytes"
+	"testing"
+
+	"hackdvbs/consts"
+)
+
+// TestDescramblerLongRun follows the scrambler for a long run of packets,
+// many times round the PRBS and the 8-packet group, and checks nothing
+// drifts.
+func TestDescramblerLongRun(t *testing.T) {
+	const packets = 200000
+	e := NewDVBSEncoder()
+	var d Descrambler
+	for i := 0; i < packets; i++ {
+		pkt := framingDataPacket(i)
+		got := e.ScrambleTS(pkt)
+		if !d.Descramble(got) {
+			t.Fatalf("packet %d broke the framing", i)
+		}
+		if !bytes.Equal(got, pkt) {
+			t.Fatalf("packet %d descrambles wrongly", i)
+		}
+	}
+	if n := d.Errors(); n != 0 {
+		t.Errorf("%d framing errors", n)
+	}
+}
+
+// packetRecorder is a FEC that keeps the scrambled packets and codes
+// nothing.
+type packetRecorder struct {
+	packets [][]byte
+}
+
+func (r *packetRecorder) Encode(packet []byte) ([]byte, error) {
+	r.packets = append(r.packets, bytes.Clone(packet))
+	return nil, nil
+}
+
+func (r *packetRecorder) CodedBits() int { return 0 }
+func (r *packetRecorder) Delay() int     { return 0 }
+func (r *packetRecorder) Reset()         {}
+
+type discard struct{}
+
+func (discard) WriteAll([]complex64) {}
+
+// TestStreamToIQResync breaks the input's packet alignment with junk that
+// holds a lone 0x47, as a payload would, and checks that StreamToIQ skips
+// to the true next packet rather than encoding one from the false sync:
+// descrambled, what reaches the FEC must be exactly the stream's packets.
+func TestStreamToIQResync(t *testing.T) {
+	var stream []byte
+	var want [][]byte
+	for i := 0; i < 40; i++ {
+		if i == 13 || i == 27 {
+			junk := bytes.Repeat([]byte{0xA5}, 97)
+			junk[40] = consts.TSSyncByte
+			stream = append(stream, junk...)
+		}
+		pkt := framingDataPacket(i)
+		stream = append(stream, pkt...)
+		want = append(want, pkt)
+	}
+
+	e := NewDVBSEncoder()
+	var rec packetRecorder
+	e.SetFEC(&rec)
+	if err := StreamToIQ(bytes.NewReader(stream), discard{}, e, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.packets) != len(want) {
+		t.Fatalf("encoded %d packets, want the %d in the stream", len(rec.packets), len(want))
+	}
+	var d Descrambler
+	for i, pkt := range rec.packets {
+		if !d.Descramble(pkt) {
+			t.Fatalf("packet %d broke the framing", i)
+		}
+		if !bytes.Equal(pkt, want[i]) {
+			t.Fatalf("packet %d is not the stream's packet %d", i, i)
+		}
+	}
+}
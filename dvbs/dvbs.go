@@ -1,43 +1,239 @@
 package dvbs
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/cmplx"
+	"sync/atomic"
 
 	"hackdvbs/consts"
 	"hackdvbs/filter"
 	"hackdvbs/utils"
 )
 
-// DVB-S encoder
+// Errors from the encoder pipeline. Failures of the underlying reader are
+// wrapped alongside them, so errors.Is matches either.
+var (
+	// ErrBadPacketSize is returned for a packet that is not the length the
+	// stage takes.
+	ErrBadPacketSize = errors.New("bad packet size")
+
+	// ErrSyncLost is returned when the stream ends or fails while hunting
+	// for the next TS sync byte.
+	ErrSyncLost = errors.New("TS sync lost")
+
+	// ErrReadFailed is returned when reading the TS stream fails other than
+	// at a packet boundary at the end.
+	ErrReadFailed = errors.New("reading TS stream failed")
+)
+
+// Stage identifies one step of the DVB-S channel coding chain.
+type Stage int
+
+const (
+	StageScramble Stage = 1 << iota
+	StageReedSolomon
+	StageInterleave
+	StageConvolutional
+	StageDispersal // the PRBS alone; the sync byte inversion is kept
+)
+
+// DVB-S encoder.
+//
+// The scrambler's 8-packet group (the inverted sync byte and the PRBS
+// restart) advances by one for every packet handed to EncodePacket, whatever
+// its origin. A receiver descrambles the packets in the order they go out,
+// so anything that adds packets (padding, SI, a frozen GOP, lead-in nulls)
+// must do it in the TS ahead of the encoder, where the packet takes the next
+// slot like any other. Nothing may encode around EncodePacket or drop a
+// packet after it is encoded.
 type DVBSEncoder struct {
-	rsEncoder          *RSEncoder
-	interleaverFIFOs   [][]byte
-	interleaverIndices []int
-	prbsIndex          int
-	packetCounter      int
+	fec           FEC
+	dvbs          *DVBSFEC // the standard chain, which SetFEC may replace
+	prbsIndex     int
+	packetCounter int
+	flushOnEnd    bool
+	constellation [4]complex64
+	bypass        Stage
+	framingCheck  *Descrambler
+	framingErrors atomic.Uint64
+	packets       atomic.Uint64
+	stall         stallWatch
+	pilotEvery    int
+	pilotCount    int
+	pilotBits     []byte
 }
 
-// NewDVBSEncoder creates a new encoder.
+// NewDVBSEncoder creates a new encoder with the standard DVB-S inner code
+// generators, 171 and 133 octal.
 func NewDVBSEncoder() *DVBSEncoder {
-	rsEnc := NewRSEncoder()
-	const I = consts.InterleaveDepth
-	const M = consts.RSPacketSize / I
-	fifos := make([][]byte, I)
-	indices := make([]int, I)
-	for i := 1; i < I; i++ {
-		fifos[i] = make([]byte, i*M)
+	e, _ := NewDVBSEncoderWithConv(consts.ConvG1, consts.ConvG2, false)
+	return e
+}
+
+// NewDVBSEncoderWithConv creates an encoder whose rate 1/2 inner code uses
+// the given 7-bit generators for the X and Y outputs; see NewDVBSFEC.
+func NewDVBSEncoderWithConv(g1, g2 byte, reversed bool) (*DVBSEncoder, error) {
+	fec, err := NewDVBSFEC(g1, g2, reversed)
+	if err != nil {
+		return nil, err
 	}
 	return &DVBSEncoder{
-		rsEncoder:          rsEnc,
-		interleaverFIFOs:   fifos,
-		interleaverIndices: indices,
-		prbsIndex:          0,
-		packetCounter:      0,
+		fec:           fec,
+		dvbs:          fec,
+		prbsIndex:     0,
+		packetCounter: 0,
+		constellation: consts.QPSKFast,
+	}, nil
+}
+
+// SetFEC replaces the channel coding after the scrambler. The scrambler and
+// its framing, the constellation and Flush stay the encoder's own. The
+// standard chain's settings (SetConvTermination and the RS, interleaver and
+// convolutional bypasses) only apply to it.
+func (e *DVBSEncoder) SetFEC(fec FEC) {
+	e.fec = fec
+}
+
+// DVBSFEC returns the encoder's standard DVB-S chain, even if SetFEC has
+// replaced it.
+func (e *DVBSEncoder) DVBSFEC() *DVBSFEC {
+	return e.dvbs
+}
+
+// Generators returns the inner code generators in standard form.
+func (e *DVBSEncoder) Generators() (g1, g2 byte) {
+	return e.dvbs.Generators()
+}
+
+// SetBypass skips the given stages in EncodePacket. This is a bring-up aid
+// for comparing against a reference decoder stage by stage: the output is
+// NOT a valid DVB-S signal. Bypassing RS sends zero parity bytes so the
+// 204-byte framing is kept; bypassing the convolutional code sends the
+// interleaved bits uncoded (half the symbols per packet). Bypassing
+// dispersal leaves the payload clear but still inverts every eighth sync
+// byte, so a receiver keeps its packet-group framing.
+func (e *DVBSEncoder) SetBypass(stages Stage) {
+	e.bypass = stages
+	e.dvbs.SetBypass(stages)
+}
+
+// SetFramingCheck runs every scrambled packet back through a Descrambler
+// that anchors on the inverted sync bytes, as a receiver would, and counts
+// packets that fail to descramble to the original. The 8-packet group is
+// counted on output packets, so dropped or resynced input can never shift
+// it; the check proves that at the cost of a second pass over each packet.
+func (e *DVBSEncoder) SetFramingCheck(on bool) {
+	e.framingCheck = nil
+	if on {
+		e.framingCheck = &Descrambler{}
+	}
+}
+
+// FramingErrors returns the number of packets the framing check rejected.
+// It is safe to call from any goroutine.
+func (e *DVBSEncoder) FramingErrors() uint64 {
+	return e.framingErrors.Load()
+}
+
+// GroupPosition returns the slot, 0-7, the next packet takes in the
+// scrambler's 8-packet group; slot 0 carries the inverted sync byte.
+func (e *DVBSEncoder) GroupPosition() int {
+	return e.packetCounter
+}
+
+// Packets returns the number of TS packets encoded so far. It is safe to
+// call from any goroutine.
+func (e *DVBSEncoder) Packets() uint64 {
+	return e.packets.Load()
+}
+
+// SetConvTermination enables trellis termination of the convolutional code.
+// The encoder resets its shift register at the start of every packet (as
+// SDRangel does), which a standard Viterbi decoder can only follow if each
+// packet's trellis is also flushed back to the zero state. When enabled,
+// K-1 = 6 zero tail bits are appended after every packet, adding 12 coded
+// bits (6 symbols). This is not part of EN 300 421; the default output is
+// unterminated and only decodable by SDRangel-style per-packet receivers.
+// SetConvContinuous is the standard alternative.
+func (e *DVBSEncoder) SetConvTermination(on bool) {
+	e.dvbs.SetConvTermination(on)
+}
+
+// SetConvContinuous carries the convolutional encoder's shift register over
+// from one packet to the next, as EN 300 421 has it, instead of starting
+// each packet from zero. A conformant receiver's Viterbi decoder then
+// follows the whole stream; SDRangel's per-packet decoder does not.
+func (e *DVBSEncoder) SetConvContinuous(on bool) {
+	e.dvbs.SetConvContinuous(on)
+}
+
+// SetFlushOnEnd makes StreamToIQ finish cleanly when its input ends: a
+// partial last packet is padded out with stuffing bytes and encoded, then
+// Flush drains the interleaver.
+func (e *DVBSEncoder) SetFlushOnEnd(on bool) {
+	e.flushOnEnd = on
+}
+
+// Flush encodes null packets until every byte still in the FEC (the
+// interleaver, for DVB-S) has come out, continuing to the end of the scrambler's 8-packet group, and
+// returns their coded bits as EncodePacket does. Afterwards the output ends
+// on a complete packet and group, and the interleaver holds only nulls.
+func (e *DVBSEncoder) Flush() []byte {
+	n := e.fec.Delay()
+	n += (8 - (e.packetCounter+n)%8) % 8
+
+	null := nullPacket()
+	var bits []byte
+	for i := 0; i < n; i++ {
+		b, _ := e.EncodePacket(null)
+		bits = append(bits, b...)
+	}
+	return bits
+}
+
+// nullPacket returns a null packet (PID 0x1FFF) stuffed with 0xFF.
+func nullPacket() []byte {
+	pkt := make([]byte, consts.TSPacketSize)
+	for i := range pkt {
+		pkt[i] = 0xFF
+	}
+	pkt[0], pkt[1], pkt[2], pkt[3] = consts.TSSyncByte, 0x1F, 0xFF, 0x10
+	return pkt
+}
+
+// SetPhaseOffset rotates the whole QPSK constellation by a fixed angle in
+// degrees, for receivers that expect a particular absolute phase.
+func (e *DVBSEncoder) SetPhaseOffset(degrees float64) {
+	rot := cmplx.Rect(1, degrees*math.Pi/180)
+	for i, p := range consts.QPSKFast {
+		e.constellation[i] = complex64(complex128(p) * rot)
 	}
 }
 
-// ScrambleTS scrambles a 188-byte TS packet to be bug-for-bug compatible with SDRangel.
+// Constellation returns the QPSK points the encoder maps symbols to,
+// including any phase offset.
+func (e *DVBSEncoder) Constellation() [4]complex64 {
+	return e.constellation
+}
+
+// NetBitrate returns the TS bitrate (bits/s) the channel can carry at the
+// given symbol rate: 2 bits per QPSK symbol, of which the FEC spends
+// CodedBits on each packet (for DVB-S, the rate 1/2 inner code less any
+// termination tail and the 188/204 Reed-Solomon overhead), and any pilots
+// their share.
+func (e *DVBSEncoder) NetBitrate(symbolRate float64) float64 {
+	return symbolRate * 2 * float64(consts.TSPacketSize*8) / (float64(e.fec.CodedBits()) + e.pilotOverhead())
+}
+
+// ScrambleTS scrambles a 188-byte TS packet as SDRangel does, which is also
+// EN 300 421's energy dispersal: PrbsLUT is the standard PRBS for one
+// 8-packet group, and it runs on, unapplied, through the sync bytes of
+// packets 2-8 (see CheckStrict).
 func (e *DVBSEncoder) ScrambleTS(tsPacket []byte) []byte {
 	scrambledPacket := make([]byte, consts.TSPacketSize)
 	copy(scrambledPacket, tsPacket)
@@ -47,10 +243,14 @@ func (e *DVBSEncoder) ScrambleTS(tsPacket []byte) []byte {
 		e.prbsIndex = 0 // Reset PRBS index for the first packet in a group of 8.
 		scrambledPacket[0] = ^scrambledPacket[0] // Invert sync byte.
 	} else {
-		// For packets 1-7, the PRBS index is incremented ONCE before the per-byte scrambling.
-		// THIS IS THE CRITICAL "BUG" TO REPLICATE.
+		// For packets 1-7, the PRBS index is incremented ONCE before the per-byte scrambling:
+		// the generator keeps running through the sync byte it leaves clear.
 		e.prbsIndex++
 	}
+	if e.bypass&StageDispersal != 0 {
+		e.packetCounter = (e.packetCounter + 1) % 8
+		return scrambledPacket
+	}
 
 	// The PRBS sequence is applied to the payload (bytes 1 to 187).
 	// We use a temporary index to ensure the "off-by-one" packet-level increment is handled correctly.
@@ -70,109 +270,149 @@ func (e *DVBSEncoder) ScrambleTS(tsPacket []byte) []byte {
 	return scrambledPacket
 }
 
-// ReedSolomon encodes the 188-byte packet into a 204-byte RS packet.
-func (e *DVBSEncoder) ReedSolomon(packet []byte) []byte {
-	return e.rsEncoder.Encode(packet)
-}
-
-// Interleave performs convolutional interleaving on the 204-byte RS packet.
-func (e *DVBSEncoder) Interleave(rsPacket []byte) []byte {
-	out := make([]byte, consts.RSPacketSize)
-	copy(out, rsPacket)
+// EncodePacket scrambles a TS packet and codes it through the FEC, the
+// full DVB-S pipeline in the standard order unless SetFEC replaced the
+// chain. tsPacket must be 188 bytes, or ErrBadPacketSize is returned.
+func (e *DVBSEncoder) EncodePacket(tsPacket []byte) ([]byte, error) {
+	if len(tsPacket) != consts.TSPacketSize {
+		return nil, fmt.Errorf("%w: %d bytes, want %d", ErrBadPacketSize, len(tsPacket), consts.TSPacketSize)
+	}
+	e.packets.Add(1)
 
-	const I = consts.InterleaveDepth
-	p := 0
-	for j := 0; j < consts.RSPacketSize; j += I {
-		p++
-		for i := 1; i < I; i++ {
-			if p < consts.RSPacketSize {
-				fifo := e.interleaverFIFOs[i]
-				idx := e.interleaverIndices[i]
-				out[p], fifo[idx] = fifo[idx], out[p]
-				e.interleaverIndices[i] = (idx + 1) % len(fifo)
-				p++
-			}
+	// 1. Scramble the 188-byte TS packet
+	scrambledPacket := tsPacket
+	if e.bypass&StageScramble == 0 {
+		scrambledPacket = e.ScrambleTS(tsPacket)
+		if e.framingCheck != nil && e.bypass&StageDispersal == 0 {
+			e.checkFraming(tsPacket, scrambledPacket)
 		}
 	}
-	return out
-}
 
-// ConvolutionalEncode performs rate 1/2 FEC.
-func (e *DVBSEncoder) ConvolutionalEncode(interleavedPacket []byte) []byte {
-	// Use bit-reversed generator polynomials to match the left-shifting
-	// register implementation with the original SDRangel C++ (right-shifting) output.
-	const g1 = 0x4F // Reversed 0x79
-	const g2 = 0x6D // Reversed 0x5B
+	// 2. Hand it to the FEC: for DVB-S, RS, interleaving and the
+	// convolutional code
+	bits, err := e.fec.Encode(scrambledPacket)
+	if err != nil {
+		return nil, err
+	}
 
-	// Pre-allocate exact size needed
-	out := make([]byte, consts.RSPacketSize*8*2)
-	outIdx := 0
-	delay := uint16(0)
-	
-	for i := 0; i < consts.RSPacketSize; i++ {
-		b := interleavedPacket[i]
-		for j := 7; j >= 0; j-- {
-			bit := (b >> uint(j)) & 1
-			delay = ((delay << 1) | uint16(bit)) & 0x7F
-			out[outIdx] = utils.Parity(delay & g1)
-			out[outIdx+1] = utils.Parity(delay & g2)
-			outIdx += 2
+	// 3. Follow it with the pilots, if it ends their interval
+	return e.addPilots(bits), nil
+}
+
+func (e *DVBSEncoder) checkFraming(original, scrambled []byte) {
+	pkt := make([]byte, consts.TSPacketSize)
+	copy(pkt, scrambled)
+	if !e.framingCheck.Descramble(pkt) || !bytes.Equal(pkt, original) {
+		if e.framingErrors.Add(1) == 1 {
+			log.Printf("WARNING: Scrambler framing check failed: the 8-packet group is misaligned")
 		}
 	}
-	return out
 }
 
-// EncodePacket runs the full DVB-S pipeline in the correct standard order.
-func (e *DVBSEncoder) EncodePacket(tsPacket []byte) []byte {
-	// 1. Scramble the 188-byte TS packet
-	scrambledPacket := e.ScrambleTS(tsPacket)
-
-	// 2. Add Reed-Solomon parity bytes
-	rsPacket := e.ReedSolomon(scrambledPacket)
-
-	// 3. Interleave the 204-byte packet
-	interleavedPacket := e.Interleave(rsPacket)
-
-	// 4. Convolve the interleaved packet
-	return e.ConvolutionalEncode(interleavedPacket)
+// SampleWriter receives modulated samples. WriteAll must not return until
+// every sample has been accepted, which is how backpressure reaches the encoder.
+type SampleWriter interface {
+	WriteAll(samples []complex64)
 }
 
-// StreamToIQ processes the TS stream and generates I/Q samples.
-func StreamToIQ(tsReader io.Reader, iqBuffer chan complex64, dvbsEncoder *DVBSEncoder, rrcFilter *filter.FIRFilter) {
-	defer close(iqBuffer)
-
+// StreamToIQ processes the TS stream and generates I/Q samples, returning
+// when the stream ends. It returns nil at a clean end of stream, and
+// otherwise ErrReadFailed or ErrSyncLost wrapping the reader's error.
+// With a nil rrcFilter, out receives the QPSK symbols themselves, one
+// sample per symbol, for pulse shaping elsewhere.
+func StreamToIQ(tsReader io.Reader, out SampleWriter, dvbsEncoder *DVBSEncoder, rrcFilter *filter.FIRFilter) error {
 	// Pre-allocate buffers to avoid GC pressure
 	tsPacket := make([]byte, consts.TSPacketSize)
 	maxSymbolsPerPacket := 2048
 	qpskSymbols := make([]complex64, maxSymbolsPerPacket)
 	
+	modulate := func(encodedBits []byte) {
+		symbolCount := len(encodedBits) / 2
+		if symbolCount > len(qpskSymbols) {
+			qpskSymbols = make([]complex64, symbolCount)
+		}
+
+		// Use fast QPSK lookup array (rotated by any phase offset)
+		for i := 0; i < symbolCount; i++ {
+			sym := (encodedBits[i*2] << 1) | encodedBits[i*2+1]
+			qpskSymbols[i] = dvbsEncoder.constellation[sym]
+		}
+
+		if rrcFilter == nil {
+			out.WriteAll(qpskSymbols[:symbolCount])
+			return
+		}
+		iqSamples := rrcFilter.Process(qpskSymbols[:symbolCount])
+
+		// Hand the whole packet's samples over in one operation
+		out.WriteAll(iqSamples)
+	}
+
+	started := false
 	for {
-		_, err := io.ReadFull(tsReader, tsPacket)
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("Error reading TS stream: %v", err)
+		dvbsEncoder.stall.begin(started)
+		n, err := io.ReadFull(tsReader, tsPacket)
+		dvbsEncoder.stall.end(err == nil)
+		started = true
+		if err != nil && dvbsEncoder.flushOnEnd {
+			if err == io.ErrUnexpectedEOF && tsPacket[0] == consts.TSSyncByte {
+				for i := n; i < len(tsPacket); i++ {
+					tsPacket[i] = 0xFF
+				}
+				if bits, err := dvbsEncoder.EncodePacket(tsPacket); err == nil {
+					modulate(bits)
+				}
 			}
-			return
+			modulate(dvbsEncoder.Flush())
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrReadFailed, err)
 		}
 		if tsPacket[0] != consts.TSSyncByte {
-			log.Println("Warning: Lost TS packet sync.")
-			continue
+			utils.LogLimited("Warning: Lost TS packet sync.")
+			if tsReader, err = resync(tsReader, tsPacket); err != nil {
+				if dvbsEncoder.flushOnEnd {
+					modulate(dvbsEncoder.Flush())
+				}
+				return fmt.Errorf("%w: %w", ErrSyncLost, err)
+			}
 		}
 		
-		encodedBits := dvbsEncoder.EncodePacket(tsPacket)
-		symbolCount := len(encodedBits) / 2
-		
-		// Use fast QPSK lookup array
-		for i := 0; i < symbolCount; i++ {
-			sym := (encodedBits[i*2] << 1) | encodedBits[i*2+1]
-			qpskSymbols[i] = consts.QPSKFast[sym]
+		encodedBits, err := dvbsEncoder.EncodePacket(tsPacket)
+		if err != nil {
+			return err
 		}
-		
-		iqSamples := rrcFilter.Process(qpskSymbols[:symbolCount])
-		
-		// Write samples
-		for _, sample := range iqSamples {
-			iqBuffer <- sample
+		modulate(encodedBits)
+	}
+}
+
+// resync slides pkt forward through the stream until it starts on a sync
+// byte that another follows a packet later, so a 0x47 inside a payload is
+// not taken for one. It returns the reader to carry on with, which first
+// gives back the bytes read ahead. Only the input realigns: the
+// scrambler's 8-packet group is counted on encoded packets, so the output
+// framing is unaffected.
+func resync(r io.Reader, pkt []byte) (io.Reader, error) {
+	size := len(pkt)
+	buf := make([]byte, 2*size)
+	copy(buf, pkt)
+	if _, err := io.ReadFull(r, buf[size:]); err != nil {
+		return nil, err
+	}
+	for {
+		for k := 1; k < size; k++ {
+			if buf[k] == consts.TSSyncByte && buf[k+size] == consts.TSSyncByte {
+				copy(pkt, buf[k:k+size])
+				return io.MultiReader(bytes.NewReader(buf[k+size:]), r), nil
+			}
+		}
+		// None yet: keep the last start tried, so the scan picks up after it
+		n := copy(buf, buf[size-1:])
+		if _, err := io.ReadFull(r, buf[n:]); err != nil {
+			return nil, err
 		}
 	}
-}
\ No newline at end of file
+}
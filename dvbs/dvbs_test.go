@@ -0,0 +1,105 @@
+package dvbs
+
+import (
+	"bytes"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"hackdvbs/consts"
+)
+
+// referenceConv is the DVB-S inner code as EN 300 421 draws it: a register
+// with the newest bit in the MSB, tapped by the standard 171/133 octal
+// generators, restarting from zero as ConvolutionalEncode does by default.
+func referenceConv(in []byte) []byte {
+	var out []byte
+	var reg uint8
+	for _, b := range in {
+		for j := 7; j >= 0; j-- {
+			reg = reg>>1 | (b>>uint(j)&1)<<(consts.ConvConstraint-1)
+			out = append(out,
+				byte(bits.OnesCount8(reg&consts.ConvG1)&1),
+				byte(bits.OnesCount8(reg&consts.ConvG2)&1))
+		}
+	}
+	return out
+}
+
+func TestConvolutionalEncodeStandardGenerators(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		in := make([]byte, consts.RSPacketSize)
+		rng.Read(in)
+		if i == 0 {
+			// Impulse: the output spells out the generators
+			clear(in)
+			in[0] = 0x80
+		}
+		got := NewDVBSEncoder().DVBSFEC().ConvolutionalEncode(in)
+		if want := referenceConv(in); !bytes.Equal(got, want) {
+			t.Fatalf("packet %d: reversed-register output differs from the 171/133 reference", i)
+		}
+	}
+}
+
+// The default encoder, its generators given in standard form, must code
+// exactly as one given the reversed 0x4F/0x6D the encoder once hardcoded.
+func TestDefaultGeneratorsMatchReversed(t *testing.T) {
+	std, err := NewDVBSEncoderWithConv(consts.ConvG1, consts.ConvG2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed, err := NewDVBSEncoderWithConv(0x4F, 0x6D, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		pkt := make([]byte, consts.TSPacketSize)
+		rng.Read(pkt)
+		pkt[0] = consts.TSSyncByte
+		got, err := std.EncodePacket(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := reversed.EncodePacket(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("packet %d codes differently from the reversed 0x4F/0x6D encoder", i)
+		}
+	}
+}
+
+// A single 1 bit through the inner code must spell out the generators in
+// X and Y, newest-bit tap first, whichever form they were given in.
+func TestConvImpulse(t *testing.T) {
+	tests := []struct {
+		g1, g2   byte
+		reversed bool
+	}{
+		{consts.ConvG1, consts.ConvG2, false},
+		{0x4F, 0x6D, true},
+		{0x5B, 0x79, false},
+		{0x45, 0x7F, false},
+	}
+	for _, tt := range tests {
+		enc, err := NewDVBSEncoderWithConv(tt.g1, tt.g2, tt.reversed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in := make([]byte, consts.RSPacketSize)
+		in[0] = 0x80
+		out := enc.DVBSFEC().ConvolutionalEncode(in)
+		g1, g2 := enc.Generators()
+		for k := 0; k < consts.ConvConstraint; k++ {
+			shift := consts.ConvConstraint - 1 - k
+			if out[2*k] != (g1>>shift)&1 || out[2*k+1] != (g2>>shift)&1 {
+				t.Errorf("generators %#x,%#x (reversed %v): impulse response differs from %o,%o at bit %d", tt.g1, tt.g2, tt.reversed, g1, g2, k)
+				break
+			}
+		}
+	}
+}
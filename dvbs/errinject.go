@@ -0,0 +1,133 @@
+package dvbs
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+
+	"hackdvbs/consts"
+)
+
+// ErrorInjector corrupts the DVB-S chain's output after one stage, so a
+// decoder's correction can be measured against a known number of errors.
+// After StageReedSolomon or StageInterleave it corrupts whole bytes of the
+// 204-byte packet, XORing in a random non-zero value; after
+// StageConvolutional it flips coded bits, as the channel would. The output
+// is NOT a valid transmission.
+//
+// Errors come either as a fixed number per packet, at distinct random
+// positions, or independently at a rate per byte or bit. The random source is
+// seeded the same every run, so a run is repeatable.
+type ErrorInjector struct {
+	stage     Stage
+	perPacket int
+	rate      float64
+
+	rng  *rand.Rand
+	skip int // clean positions before the next error, at a rate
+
+	injected atomic.Uint64
+	packets  atomic.Uint64
+}
+
+// NewErrorInjector creates an injector after stage, one of StageReedSolomon,
+// StageInterleave and StageConvolutional. Give perPacket for a fixed count
+// or rate, between 0 and 1, for random errors; the other must be 0.
+func NewErrorInjector(stage Stage, perPacket int, rate float64) (*ErrorInjector, error) {
+	units := consts.RSPacketSize
+	switch stage {
+	case StageReedSolomon, StageInterleave:
+	case StageConvolutional:
+		units = consts.RSPacketSize * 8 * 2
+	default:
+		return nil, fmt.Errorf("cannot inject errors after stage %d", stage)
+	}
+	if perPacket < 0 || perPacket > units {
+		return nil, fmt.Errorf("%d errors per packet: must be 0-%d", perPacket, units)
+	}
+	if !(rate >= 0 && rate < 1) {
+		return nil, fmt.Errorf("error rate %v: must be at least 0 and below 1", rate)
+	}
+	if perPacket > 0 && rate > 0 {
+		return nil, fmt.Errorf("give errors per packet or a rate, not both")
+	}
+	inj := &ErrorInjector{stage: stage, perPacket: perPacket, rate: rate, rng: rand.New(rand.NewSource(1))}
+	inj.skip = inj.gap()
+	return inj, nil
+}
+
+// Stage returns the stage errors are injected after.
+func (inj *ErrorInjector) Stage() Stage {
+	return inj.stage
+}
+
+// Injected returns the number of bytes or bits corrupted so far.
+func (inj *ErrorInjector) Injected() uint64 {
+	return inj.injected.Load()
+}
+
+// Packets returns the number of packets that have passed the injector.
+func (inj *ErrorInjector) Packets() uint64 {
+	return inj.packets.Load()
+}
+
+// corrupt injects errors into one packet's bytes, or one packet's coded
+// bits (one per byte) after StageConvolutional. The termination tail, if
+// any, counts as part of the packet.
+func (inj *ErrorInjector) corrupt(data []byte) {
+	flip := func(i int) {
+		if inj.stage == StageConvolutional {
+			data[i] ^= 1
+		} else {
+			data[i] ^= byte(1 + inj.rng.Intn(255))
+		}
+	}
+	n := 0
+	if inj.perPacket > 0 {
+		// Fewer coded bits than the count allows if the inner code is bypassed
+		n = min(inj.perPacket, len(data))
+		for _, i := range inj.rng.Perm(len(data))[:n] {
+			flip(i)
+		}
+	} else if inj.rate > 0 {
+		i := inj.skip
+		for ; i < len(data); i += inj.gap() + 1 {
+			flip(i)
+			n++
+		}
+		// Carry the gap on into the next packet, so the rate holds across
+		// packet boundaries
+		inj.skip = i - len(data)
+	}
+	inj.injected.Add(uint64(n))
+	inj.packets.Add(1)
+}
+
+// gap draws the number of clean positions before the next error: a
+// geometric variable, so each position is in error with probability rate
+// without a random draw for every bit.
+func (inj *ErrorInjector) gap() int {
+	if inj.rate == 0 {
+		return math.MaxInt32
+	}
+	g := math.Floor(math.Log(1-inj.rng.Float64()) / math.Log1p(-inj.rate))
+	return int(min(g, math.MaxInt32))
+}
+
+// SetErrorInjector corrupts the output after inj's stage; nil stops it.
+// Only the standard chain takes one; see DVBSFEC.SetErrorInjector.
+func (e *DVBSEncoder) SetErrorInjector(inj *ErrorInjector) {
+	e.dvbs.SetErrorInjector(inj)
+}
+
+// ErrorInjector returns the injector SetErrorInjector set, or nil.
+func (e *DVBSEncoder) ErrorInjector() *ErrorInjector {
+	return e.dvbs.inject
+}
+
+// SetErrorInjector corrupts Encode's output after inj's stage; nil stops
+// it. A bypassed stage still counts as the place to inject.
+func (f *DVBSFEC) SetErrorInjector(inj *ErrorInjector) {
+	f.inject = inj
+}
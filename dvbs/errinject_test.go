@@ -0,0 +1,77 @@
+package dvbs
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"hackdvbs/consts"
+)
+
+// TestErrorInjector runs random packets through the DVB-S chain with and
+// without an injector at each stage and checks that the output differs in
+// exactly the bytes or bits the injector counted, so a decoder's
+// corrections can be compared with it.
+func TestErrorInjector(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	packets := make([][]byte, 40)
+	for i := range packets {
+		packets[i] = make([]byte, consts.TSPacketSize)
+		rng.Read(packets[i])
+	}
+	for _, c := range []struct {
+		stage     Stage
+		perPacket int
+		rate      float64
+	}{
+		{StageReedSolomon, 8, 0},
+		{StageInterleave, 9, 0},
+		{StageConvolutional, 0, 1e-3},
+	} {
+		inj, err := NewErrorInjector(c.stage, c.perPacket, c.rate)
+		if err != nil {
+			t.Fatalf("stage %d: %v", c.stage, err)
+		}
+		// Bypass the stages after the injector, so the differences show
+		// up one byte (eight unpacked bits) or one bit each
+		unit, after := 8, StageInterleave|StageConvolutional
+		switch c.stage {
+		case StageInterleave:
+			after = StageConvolutional
+		case StageConvolutional:
+			unit, after = 1, 0
+		}
+		clean, _ := NewDVBSFEC(consts.ConvG1, consts.ConvG2, false)
+		dirty, _ := NewDVBSFEC(consts.ConvG1, consts.ConvG2, false)
+		clean.SetBypass(after)
+		dirty.SetBypass(after)
+		dirty.SetErrorInjector(inj)
+		var diff uint64
+		for i, pkt := range packets {
+			want, err := clean.Encode(pkt)
+			if err != nil {
+				t.Fatalf("stage %d: packet %d: %v", c.stage, i, err)
+			}
+			got, err := dirty.Encode(pkt)
+			if err != nil {
+				t.Fatalf("stage %d: packet %d: %v", c.stage, i, err)
+			}
+			n := 0
+			for j := 0; j < len(want); j += unit {
+				if !bytes.Equal(want[j:j+unit], got[j:j+unit]) {
+					n++
+				}
+			}
+			if c.perPacket > 0 && n != c.perPacket {
+				t.Errorf("stage %d: packet %d has %d errors, want %d", c.stage, i, n, c.perPacket)
+			}
+			diff += uint64(n)
+		}
+		if diff != inj.Injected() {
+			t.Errorf("stage %d: output differs in %d places, injector counted %d", c.stage, diff, inj.Injected())
+		}
+		if c.rate > 0 && diff == 0 {
+			t.Errorf("stage %d: no errors at rate %v", c.stage, c.rate)
+		}
+	}
+}
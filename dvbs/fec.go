@@ -0,0 +1,237 @@
+package dvbs
+
+import (
+	"fmt"
+
+	"hackdvbs/consts"
+	"hackdvbs/utils"
+)
+
+// FEC is the channel coding between the scrambler and the QPSK mapper.
+// DVBSEncoder keeps the scrambler and its 8-packet framing to itself and
+// hands each scrambled packet to its FEC, so another chain (different
+// puncturing, LDPC for DVB-S2) can be slotted in with SetFEC without
+// touching the framing or the streaming around it.
+type FEC interface {
+	// Encode codes one scrambled 188-byte packet into bits, one per byte,
+	// two to a QPSK symbol. It may keep state from packet to packet, as an
+	// interleaver does.
+	Encode(packet []byte) ([]byte, error)
+
+	// CodedBits is the number of bits Encode returns per packet.
+	CodedBits() int
+
+	// Delay is how many packets' worth of input are still inside after
+	// Encode returns, which Flush pushes out with null packets.
+	Delay() int
+
+	// Reset drops whatever state Encode has built up, so the chain codes
+	// as it did when new.
+	Reset()
+}
+
+// DVBSFEC is the EN 300 421 chain: RS(204,188), the 12-branch convolutional
+// interleaver and the rate 1/2, constraint length 7 convolutional code.
+type DVBSFEC struct {
+	rsEncoder          *RSEncoder
+	interleaverFIFOs   [][]byte
+	interleaverIndices []int
+	convTerminate      bool
+	convContinuous     bool
+	convState          uint16 // register carried between packets when convContinuous
+	convG1, convG2     uint16 // generators in shift-register form, see NewDVBSFEC
+	bypass             Stage
+	inject             *ErrorInjector
+}
+
+// NewDVBSFEC creates the DVB-S chain whose rate 1/2 inner code uses the
+// given 7-bit generators for the X and Y outputs. In the standard form, as
+// the DVB-S 171/133 octal (0x79/0x5B) are written, the MSB taps the newest
+// bit. The shift register in ConvolutionalEncode takes the newest bit into
+// bit 0 instead, so standard generators are mirrored across the 7 bits:
+// 0x79 becomes 0x4F and 0x5B becomes 0x6D. Pass reversed if g1 and g2 are
+// already in that mirrored form.
+func NewDVBSFEC(g1, g2 byte, reversed bool) (*DVBSFEC, error) {
+	for _, g := range []byte{g1, g2} {
+		if g >= 1<<consts.ConvConstraint || g == 0 {
+			return nil, fmt.Errorf("generator %#x does not fit a constraint length %d code", g, consts.ConvConstraint)
+		}
+	}
+	r1, r2 := uint16(g1), uint16(g2)
+	if !reversed {
+		r1 = utils.ReverseBits(r1, consts.ConvConstraint)
+		r2 = utils.ReverseBits(r2, consts.ConvConstraint)
+	}
+
+	const I = consts.InterleaveDepth
+	const M = consts.RSPacketSize / I
+	fifos := make([][]byte, I)
+	indices := make([]int, I)
+	for i := 1; i < I; i++ {
+		fifos[i] = make([]byte, i*M)
+	}
+	return &DVBSFEC{
+		rsEncoder:          NewRSEncoder(),
+		interleaverFIFOs:   fifos,
+		interleaverIndices: indices,
+		convG1:             r1,
+		convG2:             r2,
+	}, nil
+}
+
+// Generators returns the inner code generators in standard form.
+func (f *DVBSFEC) Generators() (g1, g2 byte) {
+	return byte(utils.ReverseBits(f.convG1, consts.ConvConstraint)), byte(utils.ReverseBits(f.convG2, consts.ConvConstraint))
+}
+
+// SetConvTermination is DVBSEncoder.SetConvTermination.
+func (f *DVBSFEC) SetConvTermination(on bool) {
+	f.convTerminate = on
+}
+
+// SetConvContinuous is DVBSEncoder.SetConvContinuous.
+func (f *DVBSFEC) SetConvContinuous(on bool) {
+	f.convContinuous = on
+}
+
+// SetBypass skips the RS, interleaver and convolutional stages among
+// stages; see DVBSEncoder.SetBypass.
+func (f *DVBSFEC) SetBypass(stages Stage) {
+	f.bypass = stages & (StageReedSolomon | StageInterleave | StageConvolutional)
+}
+
+// Encode implements FEC.
+func (f *DVBSFEC) Encode(scrambledPacket []byte) ([]byte, error) {
+	// 1. Add Reed-Solomon parity bytes
+	var rsPacket []byte
+	if f.bypass&StageReedSolomon == 0 {
+		var err error
+		if rsPacket, err = f.ReedSolomon(scrambledPacket); err != nil {
+			return nil, err
+		}
+	} else {
+		// Zero parity keeps the 204-byte framing for the later stages
+		rsPacket = make([]byte, consts.RSPacketSize)
+		copy(rsPacket, scrambledPacket)
+	}
+	f.injectAfter(StageReedSolomon, rsPacket)
+
+	// 2. Interleave the 204-byte packet
+	interleavedPacket := rsPacket
+	if f.bypass&StageInterleave == 0 {
+		interleavedPacket = f.Interleave(rsPacket)
+	}
+	f.injectAfter(StageInterleave, interleavedPacket)
+
+	// 3. Convolve the interleaved packet
+	var bits []byte
+	if f.bypass&StageConvolutional != 0 {
+		bits = unpackBits(interleavedPacket)
+	} else {
+		bits = f.ConvolutionalEncode(interleavedPacket)
+	}
+	f.injectAfter(StageConvolutional, bits)
+	return bits, nil
+}
+
+// injectAfter hands data to the error injector if it is set for stage.
+func (f *DVBSFEC) injectAfter(stage Stage, data []byte) {
+	if f.inject != nil && f.inject.stage == stage {
+		f.inject.corrupt(data)
+	}
+}
+
+// CodedBits implements FEC: two coded bits for each of the 204 bytes' bits,
+// plus the termination tail if enabled. Bypassed stages are not counted, as
+// they are only for bring-up.
+func (f *DVBSFEC) CodedBits() int {
+	bits := consts.RSPacketSize * 8 * 2
+	if f.convTerminate {
+		bits += (consts.ConvConstraint - 1) * 2
+	}
+	return bits
+}
+
+// Delay implements FEC: the interleaver holds InterleaveDelay bytes.
+func (f *DVBSFEC) Delay() int {
+	return InterleaveDelay / consts.RSPacketSize
+}
+
+// ReedSolomon encodes the 188-byte packet into a 204-byte RS packet.
+func (f *DVBSFEC) ReedSolomon(packet []byte) ([]byte, error) {
+	return f.rsEncoder.Encode(packet)
+}
+
+// Interleave performs convolutional interleaving on the 204-byte RS packet.
+func (f *DVBSFEC) Interleave(rsPacket []byte) []byte {
+	out := make([]byte, consts.RSPacketSize)
+	copy(out, rsPacket)
+
+	const I = consts.InterleaveDepth
+	p := 0
+	for j := 0; j < consts.RSPacketSize; j += I {
+		p++
+		for i := 1; i < I; i++ {
+			if p < consts.RSPacketSize {
+				fifo := f.interleaverFIFOs[i]
+				idx := f.interleaverIndices[i]
+				out[p], fifo[idx] = fifo[idx], out[p]
+				f.interleaverIndices[i] = (idx + 1) % len(fifo)
+				p++
+			}
+		}
+	}
+	return out
+}
+
+// ConvolutionalEncode performs rate 1/2 FEC.
+func (f *DVBSFEC) ConvolutionalEncode(interleavedPacket []byte) []byte {
+	// Generators in the register's bit order (0x4F/0x6D for DVB-S), to
+	// match the original SDRangel C++ (right-shifting) output
+	g1 := f.convG1
+	g2 := f.convG2
+
+	// Pre-allocate exact size needed
+	tailBits := 0
+	if f.convTerminate {
+		tailBits = consts.ConvConstraint - 1
+	}
+	out := make([]byte, (consts.RSPacketSize*8+tailBits)*2)
+	outIdx := 0
+	delay := uint16(0)
+	if f.convContinuous {
+		delay = f.convState
+	}
+
+	for i := 0; i < consts.RSPacketSize; i++ {
+		b := interleavedPacket[i]
+		for j := 7; j >= 0; j-- {
+			bit := (b >> uint(j)) & 1
+			delay = ((delay << 1) | uint16(bit)) & 0x7F
+			out[outIdx] = utils.Parity(delay & g1)
+			out[outIdx+1] = utils.Parity(delay & g2)
+			outIdx += 2
+		}
+	}
+	// Flush the register with zero tail bits so the trellis ends in state 0.
+	for j := 0; j < tailBits; j++ {
+		delay = (delay << 1) & 0x7F
+		out[outIdx] = utils.Parity(delay & g1)
+		out[outIdx+1] = utils.Parity(delay & g2)
+		outIdx += 2
+	}
+	f.convState = delay
+	return out
+}
+
+// unpackBits expands bytes into one bit per byte, MSB first, in the same
+// layout ConvolutionalEncode produces.
+func unpackBits(data []byte) []byte {
+	out := make([]byte, len(data)*8)
+	for i, b := range data {
+		for j := 0; j < 8; j++ {
+			out[i*8+j] = (b >> uint(7-j)) & 1
+		}
+	}
+	return out
+}
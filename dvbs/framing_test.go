@@ -0,0 +1,125 @@
+package dvbs
+
+import (
+	"bytes"
+	"testing"
+
+	"hackdvbs/consts"
+)
+
+// framingStream returns a run of numbered data packets with null packets
+// inserted, as padding, SI or a frozen GOP would be, in runs of 1 to 9
+// starting at every slot of the 8-packet group.
+func framingStream() [][]byte {
+	var stream [][]byte
+	var seq int
+	for run := 1; run <= 9; run++ {
+		for slot := 0; slot < 8; slot++ {
+			stream = append(stream, framingDataPacket(seq))
+			seq++
+			for len(stream)%8 != slot {
+				stream = append(stream, framingDataPacket(seq))
+				seq++
+			}
+			for i := 0; i < run; i++ {
+				stream = append(stream, nullPacket())
+			}
+		}
+	}
+	return stream
+}
+
+// A descrambler following the encoder from the start must recover every
+// packet across the insertions with no framing error, and Flush must end
+// on a complete group.
+func TestFramingAcrossInsertions(t *testing.T) {
+	stream := framingStream()
+	e := NewDVBSEncoder()
+	e.SetFramingCheck(true)
+	for i, pkt := range stream {
+		if _, err := e.EncodePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+		if n := e.FramingErrors(); n != 0 {
+			t.Fatalf("descrambler lost the framing at packet %d, %d nulls inserted so far", i, framingNulls(stream[:i+1]))
+		}
+	}
+	e.Flush()
+	if n := e.FramingErrors(); n != 0 {
+		t.Fatal("descrambler lost the framing in the flush packets")
+	}
+	if pos := e.GroupPosition(); pos != 0 {
+		t.Fatalf("flush ended at slot %d of the 8-packet group, want 0", pos)
+	}
+}
+
+// A receiver joining part way through a group must re-anchor within 8
+// packets and agree from there on.
+func TestFramingJoinMidGroup(t *testing.T) {
+	stream := framingStream()
+	ref := NewDVBSEncoder()
+	scrambled := make([][]byte, len(stream))
+	for i, pkt := range stream {
+		scrambled[i] = ref.ScrambleTS(pkt)
+	}
+	const join = 3
+	var d Descrambler
+	anchored := -1
+	for i := join; i < len(scrambled); i++ {
+		pkt := bytes.Clone(scrambled[i])
+		ok := d.Descramble(pkt)
+		if anchored < 0 {
+			if !ok {
+				continue
+			}
+			anchored = i
+			if anchored-join > 8 {
+				t.Fatalf("descrambler joining at packet %d took %d packets to anchor", join, anchored-join)
+			}
+		}
+		if !ok || !bytes.Equal(pkt, stream[i]) {
+			t.Fatalf("descrambler joining at packet %d disagrees at packet %d", join, i)
+		}
+	}
+	if anchored < 0 {
+		t.Fatalf("descrambler joining at packet %d never anchored", join)
+	}
+}
+
+// As a control, one packet lost between scrambler and receiver must show.
+func TestFramingCatchesDroppedPacket(t *testing.T) {
+	ref := NewDVBSEncoder()
+	const drop = 21
+	var d Descrambler
+	for i, pkt := range framingStream() {
+		scrambled := ref.ScrambleTS(pkt)
+		if i != drop {
+			d.Descramble(scrambled)
+		}
+	}
+	if d.Errors() == 0 {
+		t.Fatalf("descrambler missed packet %d dropped from a group", drop)
+	}
+}
+
+// framingDataPacket returns a packet on PID 0x100 whose payload is derived
+// from seq, so every packet in a test is distinct.
+func framingDataPacket(seq int) []byte {
+	pkt := make([]byte, consts.TSPacketSize)
+	pkt[0], pkt[1], pkt[2], pkt[3] = consts.TSSyncByte, 0x01, 0x00, 0x10|byte(seq&0x0F)
+	for i := 4; i < len(pkt); i++ {
+		pkt[i] = byte(seq*31 + i)
+	}
+	return pkt
+}
+
+// framingNulls counts the null packets in stream.
+func framingNulls(stream [][]byte) int {
+	n := 0
+	for _, pkt := range stream {
+		if pkt[1] == 0x1F && pkt[2] == 0xFF {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,40 @@
+package dvbs
+
+// MaxPilotSymbols is the longest pilot pattern SetPilots takes.
+const MaxPilotSymbols = 1024
+
+// SetPilots inserts a known run of QPSK symbols (0-3, as the constellation
+// numbers them) into the output after every `every` packets, as an aid to
+// finding the signal by hand; every 0 turns them off. This is not DVB-S2's
+// pilots, nor part of EN 300 421: a receiver that does not strip them
+// loses sync at each one. They are counted in NetBitrate, so the channel
+// capacity falls by their share of the symbols.
+func (e *DVBSEncoder) SetPilots(every int, pattern []byte) {
+	e.pilotEvery = every
+	e.pilotCount = 0
+	e.pilotBits = e.pilotBits[:0]
+	for _, sym := range pattern {
+		e.pilotBits = append(e.pilotBits, sym>>1&1, sym&1)
+	}
+}
+
+// pilotOverhead returns the coded bits pilots add per packet, on average.
+func (e *DVBSEncoder) pilotOverhead() float64 {
+	if e.pilotEvery == 0 {
+		return 0
+	}
+	return float64(len(e.pilotBits)) / float64(e.pilotEvery)
+}
+
+// addPilots appends the pilot pattern to a packet's coded bits if it is
+// the last of its interval.
+func (e *DVBSEncoder) addPilots(bits []byte) []byte {
+	if e.pilotEvery == 0 {
+		return bits
+	}
+	if e.pilotCount++; e.pilotCount < e.pilotEvery {
+		return bits
+	}
+	e.pilotCount = 0
+	return append(bits[:len(bits):len(bits)], e.pilotBits...)
+}
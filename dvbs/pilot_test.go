@@ -0,0 +1,50 @@
+package dvbs
+
+import (
+	"bytes"
+	"testing"
+
+	"hackdvbs/consts"
+)
+
+// TestPilots checks that pilots go in after every interval's last packet,
+// and nowhere else, without disturbing the coded packets around them, and
+// that NetBitrate allows for them.
+func TestPilots(t *testing.T) {
+	const every = 3
+	pattern := []byte{0, 3, 1, 2}
+	plain := NewDVBSEncoder()
+	piloted := NewDVBSEncoder()
+	piloted.SetPilots(every, pattern)
+
+	var want, got []byte
+	for i := 0; i < 2*every+1; i++ {
+		pkt := make([]byte, consts.TSPacketSize)
+		pkt[0] = consts.TSSyncByte
+		pkt[1] = byte(i)
+		bits, err := plain.EncodePacket(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, bits...)
+		if (i+1)%every == 0 {
+			for _, sym := range pattern {
+				want = append(want, sym>>1, sym&1)
+			}
+		}
+		bits, err = piloted.EncodePacket(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, bits...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pilots are not inserted after every %d packets as given", every)
+	}
+
+	coded := float64(plain.fec.CodedBits())
+	ratio := piloted.NetBitrate(consts.SymbolRate) / plain.NetBitrate(consts.SymbolRate)
+	if wantRatio := coded / (coded + float64(2*len(pattern))/every); ratio < wantRatio-1e-9 || ratio > wantRatio+1e-9 {
+		t.Errorf("capacity with pilots is %.6f of that without, want %.6f", ratio, wantRatio)
+	}
+}
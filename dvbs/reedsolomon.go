@@ -1,5 +1,11 @@
 package dvbs
 
+import (
+	"fmt"
+
+	"hackdvbs/consts"
+)
+
 // DVB-S Reed-Solomon RS(204, 188, T=8) Encoder
 // Based on the DVB-S standard (ETSI EN 300 421) which uses the CCSDS polynomial.
 
@@ -10,12 +16,29 @@ type RSEncoder struct {
 
 // NewRSEncoder creates a new encoder for DVB-S.
 func NewRSEncoder() *RSEncoder {
-	// Use the exact hardcoded generator polynomial from the SDRangel source
-	// to ensure a perfect "bug-for-bug" compatible match.
-	generatorPoly := []byte{
-		59, 13, 104, 189, 68, 209, 30, 8, 163, 65, 41, 229, 98, 50, 36, 59,
+	return &RSEncoder{generator: rsGenerator(16)}
+}
+
+// rsGenerator builds the code generator polynomial g(x) = (x+a^0)(x+a^1)...(x+a^(n-1))
+// over GF(256) with field polynomial x^8+x^4+x^3+x^2+1, as specified in
+// EN 300 421 section 4.4.2. The leading (monic) coefficient is dropped, so
+// the result holds the coefficients of x^(n-1) down to x^0.
+//
+// For n=16 this is {59, 13, 104, 189, 68, 209, 30, 8, 163, 65, 41, 229, 98,
+// 50, 36, 59}, exactly the table hardcoded in SDRangel, and Encode below is
+// the ordinary systematic (shortened RS(255,239)) division. Despite the
+// "bug-for-bug" comments elsewhere, the outer code is standards-conformant.
+func rsGenerator(n int) []byte {
+	g := []byte{1}
+	for i := 0; i < n; i++ {
+		next := make([]byte, len(g)+1)
+		for j, c := range g {
+			next[j] ^= c
+			next[j+1] ^= gfMul(c, gfExp[i])
+		}
+		g = next
 	}
-	return &RSEncoder{generator: generatorPoly}
+	return g[1:]
 }
 
 // gfMul performs multiplication in the DVB-S specific GF(256) field.
@@ -26,12 +49,12 @@ func gfMul(a, b byte) byte {
 	return gfExp[int(gfLog[a])+int(gfLog[b])]
 }
 
-// Encode takes a 188-byte data packet and returns a 204-byte packet with parity.
-// **FIX**: This function now perfectly replicates the non-standard polynomial
-// division algorithm used in SDRangel's DVB-S transmitter.
-func (e *RSEncoder) Encode(data []byte) []byte {
-	if len(data) != 188 {
-		return nil // Or handle error appropriately
+// Encode takes a 188-byte data packet and returns a 204-byte packet with
+// parity, or ErrBadPacketSize for a packet of any other length. The
+// division is SDRangel's, and the standard one; see rsGenerator.
+func (e *RSEncoder) Encode(data []byte) ([]byte, error) {
+	if len(data) != consts.TSPacketSize {
+		return nil, fmt.Errorf("%w: %d bytes, want %d", ErrBadPacketSize, len(data), consts.TSPacketSize)
 	}
 
 	// Create a temporary buffer of 204 bytes to work in, mimicking the C++ implementation.
@@ -55,5 +78,5 @@ func (e *RSEncoder) Encode(data []byte) []byte {
 	copy(out, data)
 	copy(out[188:], tmp[188:])
 
-	return out
+	return out, nil
 }
\ No newline at end of file
@@ -0,0 +1,66 @@
+package dvbs
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"hackdvbs/consts"
+)
+
+// The RS(204,188) generator coefficients, x^15 down to x^0, as tabled in
+// SDRangel's DVB-S modulator.
+var sdrangelRSGenerator = []byte{59, 13, 104, 189, 68, 209, 30, 8, 163, 65, 41, 229, 98, 50, 36, 59}
+
+func TestRSGenerator(t *testing.T) {
+	if got := rsGenerator(16); !bytes.Equal(got, sdrangelRSGenerator) {
+		t.Errorf("rsGenerator(16) = %v, want %v", got, sdrangelRSGenerator)
+	}
+}
+
+// refMul multiplies in GF(256) with x^8+x^4+x^3+x^2+1 bit by bit, without
+// the package's log tables.
+func refMul(a, b byte) byte {
+	var p byte
+	for ; b != 0; b >>= 1 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1D
+		}
+	}
+	return p
+}
+
+// TestRSEncodeRoots checks that every codeword, as a polynomial with the
+// first byte the highest power, vanishes at the generator's roots a^0 to
+// a^15, which is what makes it an RS codeword whatever the tables say.
+func TestRSEncodeRoots(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	enc := NewRSEncoder()
+	for i := 0; i < 20; i++ {
+		data := make([]byte, consts.TSPacketSize)
+		rng.Read(data)
+		cw, err := enc.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(cw[:consts.TSPacketSize], data) {
+			t.Fatalf("packet %d: the code is not systematic", i)
+		}
+		root := byte(1) // a^0
+		for r := 0; r < 16; r++ {
+			var v byte
+			for _, c := range cw {
+				v = refMul(v, root) ^ c
+			}
+			if v != 0 {
+				t.Fatalf("packet %d: codeword is %d, not 0, at a^%d", i, v, r)
+			}
+			root = refMul(root, 2)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package dvbs
+
+import "math/rand"
+
+// Reset returns the encoder to the state NewDVBSEncoder leaves it in: the
+// scrambler at the start of an 8-packet group, the FEC emptied, the pilot
+// interval restarted and any error injector back at the start of its
+// sequence, so the same TS encodes to the same bits again. Settings
+// (bypasses, generators, termination, pilots, phase offset, the framing
+// check) are kept, as are the running counts of packets, framing errors
+// and stalls.
+func (e *DVBSEncoder) Reset() {
+	e.prbsIndex = 0
+	e.packetCounter = 0
+	e.pilotCount = 0
+	if e.framingCheck != nil {
+		e.framingCheck = &Descrambler{}
+	}
+	e.fec.Reset()
+}
+
+// Reset implements FEC: the interleaver's delay lines and the convolutional
+// encoder's register are zeroed, as NewDVBSFEC makes them, and the error
+// injector, if any, restarted. The RS encoder keeps nothing between packets.
+func (f *DVBSFEC) Reset() {
+	f.convState = 0
+	for i := range f.interleaverFIFOs {
+		clear(f.interleaverFIFOs[i])
+		f.interleaverIndices[i] = 0
+	}
+	if f.inject != nil {
+		f.inject.reset()
+	}
+}
+
+// reset restarts the injector's random sequence, so the same errors fall
+// in the same places again. The counts carry on.
+func (inj *ErrorInjector) reset() {
+	inj.rng = rand.New(rand.NewSource(1))
+	inj.skip = inj.gap()
+}
@@ -0,0 +1,71 @@
+package dvbs
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// stallWatch times StreamToIQ's reads of the TS, the producer side of the
+// pipeline: a read that waits longer than the threshold is a stall, such as
+// FFmpeg held up by a USB webcam. The radio's underruns show the consumer
+// side; this tells the two apart.
+type stallWatch struct {
+	threshold atomic.Int64 // ns; 0 is off
+	waiting   atomic.Int64 // UnixNano the current read began, or 0
+	stalls    atomic.Uint64
+	longest   atomic.Int64 // ns
+}
+
+// SetStallThreshold makes StreamToIQ count and log every read of the TS
+// that takes longer than d once the first packet has arrived; 0 turns it
+// off. Derive d from the muxrate, well above the packet interval, as the
+// producer delivers in bursts.
+func (e *DVBSEncoder) SetStallThreshold(d time.Duration) {
+	e.stall.threshold.Store(int64(d))
+}
+
+// Stalls returns the number of stalls so far and the longest.
+func (e *DVBSEncoder) Stalls() (n uint64, longest time.Duration) {
+	return e.stall.stalls.Load(), time.Duration(e.stall.longest.Load())
+}
+
+// Stalled returns how long StreamToIQ has been waiting for the current
+// packet if that is already a stall, and otherwise 0.
+func (e *DVBSEncoder) Stalled() time.Duration {
+	since := e.stall.waiting.Load()
+	threshold := time.Duration(e.stall.threshold.Load())
+	if since == 0 || threshold == 0 {
+		return 0
+	}
+	if d := time.Since(time.Unix(0, since)); d > threshold {
+		return d
+	}
+	return 0
+}
+
+// begin marks the start of a read, unless the stream has yet to start.
+func (w *stallWatch) begin(started bool) {
+	if started && w.threshold.Load() != 0 {
+		w.waiting.Store(time.Now().UnixNano())
+	}
+}
+
+// end closes the read begin marked, logging it if it was a stall. A read
+// that ended the stream is not counted.
+func (w *stallWatch) end(ok bool) {
+	since := w.waiting.Swap(0)
+	if since == 0 || !ok {
+		return
+	}
+	d := time.Since(time.Unix(0, since))
+	threshold := time.Duration(w.threshold.Load())
+	if d <= threshold {
+		return
+	}
+	w.stalls.Add(1)
+	if int64(d) > w.longest.Load() {
+		w.longest.Store(int64(d))
+	}
+	log.Printf("WARNING: TS input stalled for %v (no packet within %v); the producer, not the radio, held things up", d.Round(time.Millisecond), threshold.Round(time.Millisecond))
+}
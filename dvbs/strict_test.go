@@ -0,0 +1,69 @@
+package dvbs
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"hackdvbs/consts"
+	"hackdvbs/utils"
+)
+
+// prbsInit is the energy dispersal generator's load at the start of every
+// 8-packet group, 100101010000000 in stages 1 to 15 (EN 300 421 figure 2),
+// with stage 1 in bit 14.
+const prbsInit = 0x4A80
+
+// TestStrict checks what -strict leaves to the defaults and what it
+// changes. PrbsLUT must be EN 300 421's 1+x^14+x^15 sequence from
+// prbsInit for the whole group, sync byte gaps included, so the scrambler
+// needs no strict mode. With SetConvContinuous, the inner code of
+// consecutive packets must be one unbroken run of the shift register, and
+// Reset must start it again from zero.
+func TestStrict(t *testing.T) {
+	reg := uint16(prbsInit)
+	for i, want := range PrbsLUT {
+		var b byte
+		for k := 0; k < 8; k++ {
+			out := (reg>>1 ^ reg) & 1 // stages 14 and 15
+			reg = reg>>1 | out<<14
+			b = b<<1 | byte(out)
+		}
+		if b != want {
+			t.Fatalf("PRBS byte %d is %#02x, want %#02x from the EN 300 421 generator", i, want, b)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(4))
+	packets := make([][]byte, 3)
+	for i := range packets {
+		packets[i] = make([]byte, consts.RSPacketSize)
+		rng.Read(packets[i])
+	}
+	fec, err := NewDVBSFEC(consts.ConvG1, consts.ConvG2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fec.SetConvContinuous(true)
+	var got []byte
+	for _, pkt := range packets {
+		got = append(got, fec.ConvolutionalEncode(pkt)...)
+	}
+	// The reference: one register, never reset
+	var want []byte
+	delay := uint16(0)
+	for _, b := range bytes.Join(packets, nil) {
+		for j := 7; j >= 0; j-- {
+			delay = (delay<<1 | uint16(b>>j&1)) & 0x7F
+			want = append(want, utils.Parity(delay&fec.convG1), utils.Parity(delay&fec.convG2))
+		}
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("continuous convolutional code breaks between packets")
+	}
+	fec.Reset()
+	fresh, _ := NewDVBSFEC(consts.ConvG1, consts.ConvG2, false)
+	if !bytes.Equal(fec.ConvolutionalEncode(packets[1]), fresh.ConvolutionalEncode(packets[1])) {
+		t.Errorf("continuous convolutional code does not restart from zero after Reset")
+	}
+}
@@ -0,0 +1,217 @@
+package dvbs2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"hackdvbs/consts"
+	"hackdvbs/utils"
+)
+
+const (
+	// BBHeaderSize is the length of the baseband header in bytes.
+	BBHeaderSize = 10
+
+	// crc8Poly is g(X) = X^8 + X^7 + X^6 + X^4 + X^2 + 1, MSB first.
+	crc8Poly = 0xD5
+
+	// MATYPE-1 for a single transport stream in constant coding and
+	// modulation: TS/GS = 11, SIS/MIS = 1, CCM/ACM = 1, ISSYI = 0, NPD = 0.
+	matypeTS = 0xF0
+
+	// SYNCD value when no user packet starts in the data field
+	noSyncD = 0xFFFF
+)
+
+// BBHeader is the 80-bit baseband header at the start of every BBFRAME.
+type BBHeader struct {
+	MAType1 byte
+	MAType2 byte
+	UPL     uint16 // user packet length in bits
+	DFL     uint16 // data field length in bits
+	Sync    byte   // user packet sync byte, replaced by a CRC-8 in the stream
+	SyncD   uint16 // bits from the data field start to the first user packet
+}
+
+// Marshal encodes the header with its CRC-8.
+func (h BBHeader) Marshal() [BBHeaderSize]byte {
+	var b [BBHeaderSize]byte
+	b[0], b[1] = h.MAType1, h.MAType2
+	b[2], b[3] = byte(h.UPL>>8), byte(h.UPL)
+	b[4], b[5] = byte(h.DFL>>8), byte(h.DFL)
+	b[6] = h.Sync
+	b[7], b[8] = byte(h.SyncD>>8), byte(h.SyncD)
+	b[9] = CRC8(b[:9])
+	return b
+}
+
+// ParseBBHeader decodes a header from the start of a descrambled BBFRAME.
+func ParseBBHeader(b []byte) (BBHeader, error) {
+	if len(b) < BBHeaderSize {
+		return BBHeader{}, errors.New("short BBHEADER")
+	}
+	if crc := CRC8(b[:9]); crc != b[9] {
+		return BBHeader{}, fmt.Errorf("BBHEADER CRC-8 is %#02x, want %#02x", b[9], crc)
+	}
+	return BBHeader{
+		MAType1: b[0],
+		MAType2: b[1],
+		UPL:     uint16(b[2])<<8 | uint16(b[3]),
+		DFL:     uint16(b[4])<<8 | uint16(b[5]),
+		Sync:    b[6],
+		SyncD:   uint16(b[7])<<8 | uint16(b[8]),
+	}, nil
+}
+
+// CRC8 returns the DVB-S2 CRC-8 of data.
+func CRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for range 8 {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ crc8Poly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// BBFrameBuilder packs 188-byte TS packets into BBFRAMEs. Each packet's
+// sync byte is replaced by the CRC-8 of the previous packet's 187 other
+// bytes, packets run on from one frame's data field into the next, and
+// every frame is scrambled with the BB scrambling sequence.
+type BBFrameBuilder struct {
+	header   BBHeader
+	frame    []byte
+	scramble []byte
+
+	crc   byte   // CRC-8 of the previous packet, for the next one's sync byte
+	up    []byte // current user packet, sync byte already replaced
+	upPos int    // bytes of up already placed in a frame
+	pkt   []byte
+}
+
+// NewBBFrameBuilder returns a builder for the given code rate, frame size
+// and roll-off factor (0.35, 0.25 or 0.20).
+func NewBBFrameBuilder(rate CodeRate, size FrameSize, rollOff float64) (*BBFrameBuilder, error) {
+	bits, err := BBFrameBits(rate, size)
+	if err != nil {
+		return nil, err
+	}
+	ro, ok := rollOffBits[rollOff]
+	if !ok {
+		return nil, fmt.Errorf("roll-off %.2f is not one of 0.35, 0.25, 0.20", rollOff)
+	}
+	b := &BBFrameBuilder{
+		header: BBHeader{
+			MAType1: matypeTS | ro,
+			UPL:     consts.TSPacketSize * 8,
+			DFL:     uint16(bits - BBHeaderSize*8),
+			Sync:    consts.TSSyncByte,
+		},
+		frame:    make([]byte, bits/8),
+		scramble: scrambleSequence(bits / 8),
+		up:       make([]byte, consts.TSPacketSize),
+		upPos:    consts.TSPacketSize,
+		pkt:      make([]byte, consts.TSPacketSize),
+	}
+	return b, nil
+}
+
+// FrameBytes returns the length of each BBFRAME in bytes (Kbch/8).
+func (b *BBFrameBuilder) FrameBytes() int {
+	return len(b.frame)
+}
+
+// Next reads as many TS packets from r as the next BBFRAME needs and
+// returns the scrambled frame. The slice is reused by the following call.
+func (b *BBFrameBuilder) Next(r io.Reader) ([]byte, error) {
+	data := b.frame[BBHeaderSize:]
+	h := b.header
+	h.SyncD = noSyncD
+	if b.upPos == len(b.up) {
+		h.SyncD = 0
+	} else if d := (len(b.up) - b.upPos) * 8; d < len(data)*8 {
+		h.SyncD = uint16(d)
+	}
+
+	for filled := 0; filled < len(data); {
+		if b.upPos == len(b.up) {
+			if err := b.nextPacket(r); err != nil {
+				return nil, err
+			}
+		}
+		n := copy(data[filled:], b.up[b.upPos:])
+		filled += n
+		b.upPos += n
+	}
+
+	hdr := h.Marshal()
+	copy(b.frame, hdr[:])
+	for i := range b.frame {
+		b.frame[i] ^= b.scramble[i]
+	}
+	return b.frame, nil
+}
+
+// nextPacket reads the next TS packet into up, replacing its sync byte.
+func (b *BBFrameBuilder) nextPacket(r io.Reader) error {
+	if _, err := io.ReadFull(r, b.pkt); err != nil {
+		return err
+	}
+	if b.pkt[0] != consts.TSSyncByte {
+		utils.LogLimited("Warning: Lost TS packet sync.")
+		if err := resync(r, b.pkt); err != nil {
+			return err
+		}
+	}
+	b.up[0] = b.crc
+	copy(b.up[1:], b.pkt[1:])
+	b.crc = CRC8(b.pkt[1:])
+	b.upPos = 0
+	return nil
+}
+
+// resync slides pkt forward through the stream until it starts on a sync byte.
+func resync(r io.Reader, pkt []byte) error {
+	for pkt[0] != consts.TSSyncByte {
+		k := bytes.IndexByte(pkt[1:], consts.TSSyncByte) + 1
+		if k == 0 {
+			k = len(pkt)
+		}
+		n := copy(pkt, pkt[k:])
+		if _, err := io.ReadFull(r, pkt[n:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Descramble undoes the BB scrambling of a frame in place (the scrambling
+// is its own inverse).
+func Descramble(frame []byte) {
+	seq := scrambleSequence(len(frame))
+	for i := range frame {
+		frame[i] ^= seq[i]
+	}
+}
+
+// scrambleSequence returns n bytes of the BB scrambling PRBS,
+// 1 + X^14 + X^15 initialised to 100101010000000 at every frame start.
+func scrambleSequence(n int) []byte {
+	seq := make([]byte, n)
+	sr := 0x4A80
+	for i := range seq {
+		for bit := 7; bit >= 0; bit-- {
+			fb := (sr ^ sr>>1) & 1
+			sr = sr>>1 | fb<<14
+			seq[i] |= byte(fb) << bit
+		}
+	}
+	return seq
+}
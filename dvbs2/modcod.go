@@ -0,0 +1,51 @@
+// Package dvbs2 builds DVB-S2 baseband frames (ETSI EN 302 307-1) from an
+// MPEG transport stream. Only mode adaptation and stream adaptation are
+// implemented so far: the BCH and LDPC outer/inner codes, bit interleaving
+// and PL framing needed to put the frames on air are not.
+package dvbs2
+
+import "fmt"
+
+// FrameSize selects normal (64800-bit) or short (16200-bit) FECFRAMEs.
+type FrameSize int
+
+const (
+	NormalFrame FrameSize = iota
+	ShortFrame
+)
+
+// CodeRate is an LDPC code rate, written as in the standard (e.g. "3/4").
+type CodeRate string
+
+// kbch is the BCH-uncoded block length, which is the BBFRAME length, in
+// bits for each code rate (EN 302 307-1 tables 5a and 5b).
+var kbch = map[FrameSize]map[CodeRate]int{
+	NormalFrame: {
+		"1/4": 16008, "1/3": 21408, "2/5": 25728, "1/2": 32208, "3/5": 38688,
+		"2/3": 43040, "3/4": 48408, "4/5": 51648, "5/6": 53840, "8/9": 57472,
+		"9/10": 58192,
+	},
+	ShortFrame: {
+		"1/4": 3072, "1/3": 5232, "2/5": 6312, "1/2": 7032, "3/5": 9552,
+		"2/3": 10632, "3/4": 11712, "4/5": 12432, "5/6": 13152, "8/9": 14232,
+	},
+}
+
+// BBFrameBits returns the BBFRAME length in bits for a code rate and frame size.
+func BBFrameBits(rate CodeRate, size FrameSize) (int, error) {
+	k, ok := kbch[size][rate]
+	if !ok {
+		return 0, fmt.Errorf("no %s code rate for %s frames", rate, size)
+	}
+	return k, nil
+}
+
+func (s FrameSize) String() string {
+	if s == ShortFrame {
+		return "short"
+	}
+	return "normal"
+}
+
+// rollOffBits is the MATYPE-1 RO field for each roll-off factor.
+var rollOffBits = map[float64]byte{0.35: 0, 0.25: 1, 0.20: 2}
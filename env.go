@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix namespaces the environment variables that mirror the flags.
+const envPrefix = "HACKDVBS_"
+
+// envName returns the environment variable for a flag, e.g. -freeze-on-stall
+// becomes HACKDVBS_FREEZE_ON_STALL.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets flags from their environment variables. It must run before
+// flag.Parse so that command-line flags still take precedence over the
+// environment, which takes precedence over the defaults.
+func applyEnv(fs *flag.FlagSet) ([]string, error) {
+	var applied []string
+	var firstErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, val); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s=%q: %v", name, val, err)
+			return
+		}
+		applied = append(applied, name)
+	})
+	return applied, firstErr
+}
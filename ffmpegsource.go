@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hackdvbs/ts"
+	"hackdvbs/utils"
+)
+
+const (
+	// FFmpeg gives up on a network stream that delivers nothing for this long
+	streamStallTimeout = 5 * time.Second
+
+	// Reconnection attempts back off from the first delay up to the last.
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+)
+
+// ffmpegSource runs the FFmpeg encoder and reads its TS output. A live
+// encoder can be restarted with new settings while the stream keeps
+// flowing: the ring buffer covers the restart, the new output is picked up
+// at its first keyframe and its first PCR is flagged as a discontinuity.
+type ffmpegSource struct {
+	mu      sync.Mutex
+	opts    ffmpegOptions
+	live    bool // built from opts, so it can be rebuilt with new ones
+	cmd     *exec.Cmd
+	camera  *exec.Cmd // libcamera capture feeding cmd, if any
+	out     io.Reader
+	gen     int // bumped on every restart
+	restart bool
+
+	// Network stream input: FFmpeg is restarted whenever it drops
+	killed     bool
+	redial     time.Duration // next reconnection delay; 0 after a good packet
+	reconnects atomic.Uint64
+
+	pkt     []byte
+	pending []byte
+}
+
+// startFFmpegSource starts cmd. If live is set, cmd was built from opts
+// with buildFFmpegCommand and Restart may replace it.
+func startFFmpegSource(cmd *exec.Cmd, opts ffmpegOptions, live bool) (*ffmpegSource, error) {
+	s := &ffmpegSource{opts: opts, live: live, pkt: make([]byte, ts.PacketSize)}
+	out, err := s.start(cmd, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.out = out
+	return s, nil
+}
+
+// start starts cmd, and first the camera capture feeding it if opts uses one.
+func (s *ffmpegSource) start(cmd *exec.Cmd, opts ffmpegOptions) (io.Reader, error) {
+	s.camera = nil
+	if s.live && opts.Camera != "" {
+		camera := buildCameraCommand(opts)
+		video, err := camera.StdoutPipe()
+		if err != nil {
+			return nil, fmt.Errorf("camera stdout pipe: %w", err)
+		}
+		stderr, err := camera.StderrPipe()
+		if err != nil {
+			return nil, fmt.Errorf("camera stderr pipe: %w", err)
+		}
+		if err := camera.Start(); err != nil {
+			return nil, fmt.Errorf("starting %s: %w", opts.Camera, err)
+		}
+		go utils.LogProcess("rpicam", stderr)
+		cmd.Stdin = video
+		s.camera = camera
+	}
+	out, err := startFFmpeg(cmd)
+	if err != nil {
+		s.stopCamera()
+		return nil, err
+	}
+	s.cmd = cmd
+	return out, nil
+}
+
+func (s *ffmpegSource) stopCamera() {
+	if s.camera != nil {
+		s.camera.Process.Kill()
+		s.camera.Wait()
+	}
+}
+
+func startFFmpeg(cmd *exec.Cmd) (io.Reader, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	// Log FFmpeg output in background
+	go utils.LogFFmpeg(stderr)
+	return stdout, nil
+}
+
+// Read implements io.Reader.
+func (s *ffmpegSource) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		s.mu.Lock()
+		out, gen := s.out, s.gen
+		s.mu.Unlock()
+
+		if _, err := io.ReadFull(out, s.pkt); err != nil {
+			s.mu.Lock()
+			replaced := s.gen != gen
+			s.mu.Unlock()
+			if replaced {
+				// The old process was killed by Restart; carry on with the new one
+				continue
+			}
+			if s.Options().Stream != "" {
+				if err := s.reconnect(err); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			return 0, err
+		}
+
+		s.mu.Lock()
+		s.redial = 0
+		if s.gen == gen && s.restart && ts.HasPCR(s.pkt) {
+			// The new encoder's clock does not follow on from the old one's
+			ts.SetDiscontinuity(s.pkt)
+			s.restart = false
+		}
+		s.mu.Unlock()
+		s.pending = s.pkt
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Restart replaces the running encoder with one built from opts. The old
+// process is stopped first, since a capture device can only be opened once.
+func (s *ffmpegSource) Restart(opts ffmpegOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.live {
+		return errors.New("only a live encoder can be restarted")
+	}
+	if s.killed {
+		return errors.New("FFmpeg was stopped")
+	}
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+	s.stopCamera()
+
+	cmd := buildFFmpegCommand(opts)
+	out, err := s.start(cmd, opts)
+	if err != nil {
+		return fmt.Errorf("restarting FFmpeg: %w", err)
+	}
+	s.opts = opts
+	s.out = ts.NewKeyframeGate(out, softStartTimeout)
+	s.gen++
+	s.restart = true
+	return nil
+}
+
+// reconnect restarts FFmpeg after the network stream it was pulling ended
+// with err, backing off while the server stays unreachable. The encoder
+// settings are kept, so the stream comes back as it was.
+func (s *ffmpegSource) reconnect(err error) error {
+	s.mu.Lock()
+	if s.killed {
+		s.mu.Unlock()
+		return err
+	}
+	delay := max(s.redial, minReconnectDelay)
+	s.redial = min(2*delay, maxReconnectDelay)
+	opts := s.opts
+	s.mu.Unlock()
+
+	log.Printf("Stream input: %s dropped (%v), reconnecting in %v", streamName(opts.Stream), err, delay)
+	time.Sleep(delay)
+	s.reconnects.Add(1)
+	return s.Restart(opts)
+}
+
+// Reconnects returns the number of times a network stream was reconnected.
+func (s *ffmpegSource) Reconnects() uint64 {
+	return s.reconnects.Load()
+}
+
+// SetVideoBitrate restarts the encoder with a new video bitrate.
+func (s *ffmpegSource) SetVideoBitrate(rate string) error {
+	if _, err := utils.ParseBitrate(rate); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	opts := s.opts
+	s.mu.Unlock()
+	if opts.AudioOnly {
+		return errors.New("no video stream")
+	}
+	log.Printf("Restarting FFmpeg with video bitrate %s (was %s)", rate, opts.VideoBitrate)
+	opts.VideoBitrate = rate
+	return s.Restart(opts)
+}
+
+// Options returns the settings the encoder is running with.
+func (s *ffmpegSource) Options() ffmpegOptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts
+}
+
+// VideoBitrate returns the current video bitrate setting.
+func (s *ffmpegSource) VideoBitrate() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts.VideoBitrate
+}
+
+// Kill stops the encoder and the camera feeding it.
+func (s *ffmpegSource) Kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.killed = true
+	s.cmd.Process.Kill()
+	if s.camera != nil {
+		s.camera.Process.Kill()
+	}
+}
@@ -4,8 +4,26 @@ import "math"
 
 type FIRFilter struct {
 	Taps           []float32
-	State          []complex64
+	State          []complex64 // circular, stored twice over: State[pos:pos+len/2] runs newest to oldest
 	UpsampleFactor int
+
+	pos int
+}
+
+func newFIRFilter(taps []float32, sps int) *FIRFilter {
+	return &FIRFilter{
+		Taps:           taps,
+		State:          make([]complex64, 2*stateLen(len(taps), sps)),
+		UpsampleFactor: sps,
+	}
+}
+
+// stateLen is the number of symbols a filter of numTaps taps at sps samples
+// per symbol spans: the newest symbol meets taps 0 to sps-1, and the oldest
+// must reach the last tap, numTaps-1, whether or not numTaps-1 is a multiple
+// of sps. The branches that run past the end simply have fewer taps.
+func stateLen(numTaps, sps int) int {
+	return (numTaps-1)/sps + 1
 }
 
 func NewRRCFilter(symbolRate, sampleRate, rollOff float64, numTaps int) *FIRFilter {
@@ -34,27 +52,42 @@ func NewRRCFilter(symbolRate, sampleRate, rollOff float64, numTaps int) *FIRFilt
 	for i := range taps {
 		taps[i] /= float32(gain)
 	}
-	return &FIRFilter{
-		Taps:           taps,
-		State:          make([]complex64, (numTaps-1)/int(sampleRate/symbolRate)+1),
-		UpsampleFactor: int(sampleRate / symbolRate),
-	}
+	return newFIRFilter(taps, int(sampleRate/symbolRate))
 }
 
+// Reset empties the filter's state, so the next Process starts from
+// silence as a new filter's does.
+func (f *FIRFilter) Reset() {
+	clear(f.State)
+	f.pos = 0
+}
+
+// Process filters and upsamples symbols, carrying the state over from the
+// previous call. Output sample j of a symbol is polyphase branch j, taps j,
+// j+UpsampleFactor, ..., against the newest symbols; a State sized by hand
+// too short to reach every tap is replaced, empty, on the first call.
 func (f *FIRFilter) Process(symbols []complex64) []complex64 {
+	if need := 2 * stateLen(len(f.Taps), f.UpsampleFactor); len(f.State) < need {
+		f.State, f.pos = make([]complex64, need), 0
+	}
 	outputLen := len(symbols) * f.UpsampleFactor
 	outputSamples := make([]complex64, outputLen)
 	
-	stateLen := len(f.State)
+	stateLen := len(f.State) / 2
 	tapsLen := len(f.Taps)
 	upFactor := f.UpsampleFactor
 	
 	for symIdx := 0; symIdx < len(symbols); symIdx++ {
-		// Shift state
-		for k := stateLen - 1; k > 0; k-- {
-			f.State[k] = f.State[k-1]
+		// Step the write position back rather than shifting the state. Each
+		// symbol is written to both halves, so the window starting at pos is
+		// always contiguous.
+		f.pos--
+		if f.pos < 0 {
+			f.pos = stateLen - 1
 		}
-		f.State[0] = symbols[symIdx]
+		f.State[f.pos] = symbols[symIdx]
+		f.State[f.pos+stateLen] = symbols[symIdx]
+		window := f.State[f.pos : f.pos+stateLen]
 		
 		baseOut := symIdx * upFactor
 		
@@ -62,13 +95,14 @@ func (f *FIRFilter) Process(symbols []complex64) []complex64 {
 		for j := 0; j < upFactor; j++ {
 			var outR, outI float32
 			
-			for k := 0; k < stateLen; k++ {
+			for k, s := range window {
 				tapIndex := k*upFactor + j
-				if tapIndex < tapsLen {
-					tap := f.Taps[tapIndex]
-					outR += real(f.State[k]) * tap
-					outI += imag(f.State[k]) * tap
+				if tapIndex >= tapsLen {
+					break
 				}
+				tap := f.Taps[tapIndex]
+				outR += real(s) * tap
+				outI += imag(s) * tap
 			}
 			outputSamples[baseOut+j] = complex(outR, outI)
 		}
@@ -0,0 +1,218 @@
+package filter
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// tolerance allows for float32 accumulation order in the comparisons.
+const tolerance = 1e-5
+
+// testFilters are the filters the Process tests run on: the default RRC
+// and others whose last polyphase branch is short or full.
+var testFilters = []struct {
+	name    string
+	sps     int
+	numTaps int
+	rollOff float64
+}{
+	{"default", 2, 41, 0.35},
+	{"short branch", 2, 40, 0.35},
+	{"4 samples/symbol", 4, 81, 0.35},
+	{"3 samples/symbol, short", 3, 23, 0.2},
+}
+
+// forEachFilter runs fn on a new filter of every testFilters entry.
+func forEachFilter(t *testing.T, fn func(t *testing.T, f *FIRFilter)) {
+	for _, tf := range testFilters {
+		t.Run(tf.name, func(t *testing.T) {
+			fn(t, NewRRCFilter(1, float64(tf.sps), tf.rollOff, tf.numTaps))
+		})
+	}
+}
+
+// symbolsToFill returns one more symbol than f's state holds.
+func symbolsToFill(f *FIRFilter) int {
+	return stateLen(len(f.Taps), f.UpsampleFactor) + 1
+}
+
+// A single impulse symbol must come out as the tap sequence.
+func TestProcessImpulse(t *testing.T) {
+	forEachFilter(t, func(t *testing.T, f *FIRFilter) {
+		impulse := make([]complex64, symbolsToFill(f))
+		impulse[0] = 1
+		for i, got := range f.Process(impulse) {
+			var want float32
+			if i < len(f.Taps) {
+				want = f.Taps[i]
+			}
+			if !closeTo(got, complex(want, 0)) {
+				t.Fatalf("impulse response sample %d is %v, want tap %v", i, got, want)
+			}
+		}
+	})
+}
+
+// Once the state is full of a constant symbol, every output phase j is the
+// sum of the taps j, j+up, j+2*up, ...
+func TestProcessStep(t *testing.T) {
+	forEachFilter(t, func(t *testing.T, f *FIRFilter) {
+		up := f.UpsampleFactor
+		n := symbolsToFill(f)
+		step := make([]complex64, n)
+		for i := range step {
+			step[i] = complex(1, -1)
+		}
+		out := f.Process(step)
+		for j := 0; j < up; j++ {
+			var sum float32
+			for k := j; k < len(f.Taps); k += up {
+				sum += f.Taps[k]
+			}
+			if got := out[(n-1)*up+j]; !closeTo(got, complex(sum, -sum)) {
+				t.Errorf("step response phase %d settles at %v, want %v", j, got, complex(sum, -sum))
+			}
+		}
+	})
+}
+
+// A stream split across several Process calls must come out the same as in
+// one call.
+func TestProcessSplitCalls(t *testing.T) {
+	forEachFilter(t, func(t *testing.T, f *FIRFilter) {
+		rng := rand.New(rand.NewSource(1))
+		n := symbolsToFill(f)
+		symbols := randomSymbols(rng, 4*n)
+		whole := fresh(f).Process(symbols)
+		var pieces []complex64
+		for start := 0; start < len(symbols); {
+			end := min(start+1+rng.Intn(n), len(symbols))
+			pieces = append(pieces, f.Process(symbols[start:end])...)
+			start = end
+		}
+		for i := range whole {
+			if !closeTo(whole[i], pieces[i]) {
+				t.Fatalf("output sample %d is %v when processed in pieces, %v in one call", i, pieces[i], whole[i])
+			}
+		}
+	})
+}
+
+// The taps Process applies to an impulse must sum to the filter's for every
+// tap count up to a span of 8 symbols at 2 to 5 samples per symbol, odd and
+// even, whether or not the last polyphase branch is full, and for a filter
+// built by hand with no state, so no tap is dropped for any combination a
+// change of -taps or symbol rate could give.
+func TestAppliedTapSum(t *testing.T) {
+	for sps := 2; sps <= 5; sps++ {
+		for numTaps := 1; numTaps <= 8*sps+1; numTaps++ {
+			f := NewRRCFilter(1, float64(sps), 0.35, numTaps)
+			bare := &FIRFilter{Taps: f.Taps, UpsampleFactor: sps}
+			for _, g := range []*FIRFilter{f, bare} {
+				impulse := make([]complex64, symbolsToFill(f))
+				impulse[0] = 1
+				var applied, total float64
+				for _, s := range g.Process(impulse) {
+					applied += float64(real(s))
+				}
+				for _, tap := range g.Taps {
+					total += float64(tap)
+				}
+				if math.Abs(applied-total) > tolerance*float64(numTaps) {
+					t.Errorf("%d taps at %d samples/symbol, state given %t: the taps applied to an impulse sum to %v, the filter's to %v",
+						numTaps, sps, g == f, applied, total)
+				}
+			}
+		}
+	}
+}
+
+// shiftRegister is Process as it was before its state went circular,
+// shifting every symbol along the state by a copy, kept as the reference
+// Process must agree with and be faster than.
+type shiftRegister struct {
+	taps  []float32
+	up    int
+	state []complex64 // state[0] is the newest symbol
+}
+
+func newShiftRegister(f *FIRFilter) *shiftRegister {
+	return &shiftRegister{
+		taps:  f.Taps,
+		up:    f.UpsampleFactor,
+		state: make([]complex64, stateLen(len(f.Taps), f.UpsampleFactor)),
+	}
+}
+
+func (r *shiftRegister) process(symbols []complex64) []complex64 {
+	out := make([]complex64, 0, len(symbols)*r.up)
+	for _, sym := range symbols {
+		copy(r.state[1:], r.state)
+		r.state[0] = sym
+		for j := 0; j < r.up; j++ {
+			var acc complex64
+			for k, s := range r.state {
+				if t := k*r.up + j; t < len(r.taps) {
+					acc += s * complex(r.taps[t], 0)
+				}
+			}
+			out = append(out, acc)
+		}
+	}
+	return out
+}
+
+func TestProcessMatchesShiftRegister(t *testing.T) {
+	forEachFilter(t, func(t *testing.T, f *FIRFilter) {
+		rng := rand.New(rand.NewSource(1))
+		ref := newShiftRegister(f)
+		for call := 0; call < 20; call++ {
+			symbols := randomSymbols(rng, 1+rng.Intn(100))
+			got, want := f.Process(symbols), ref.process(symbols)
+			for i := range want {
+				if !closeTo(got[i], want[i]) {
+					t.Fatalf("call %d, output sample %d is %v, the shift-register filter gives %v", call, i, got[i], want[i])
+				}
+			}
+		}
+	})
+}
+
+// The benchmarks filter one DVB-S packet's worth of symbols per operation.
+const benchSymbols = 1632
+
+func BenchmarkProcess(b *testing.B) {
+	f := NewRRCFilter(1, 2, 0.35, 41)
+	symbols := randomSymbols(rand.New(rand.NewSource(1)), benchSymbols)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Process(symbols)
+	}
+}
+
+func BenchmarkShiftRegister(b *testing.B) {
+	r := newShiftRegister(NewRRCFilter(1, 2, 0.35, 41))
+	symbols := randomSymbols(rand.New(rand.NewSource(1)), benchSymbols)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.process(symbols)
+	}
+}
+
+func randomSymbols(rng *rand.Rand, n int) []complex64 {
+	symbols := make([]complex64, n)
+	for i := range symbols {
+		symbols[i] = complex(float32(rng.NormFloat64()), float32(rng.NormFloat64()))
+	}
+	return symbols
+}
+
+// fresh returns a filter with f's taps and an empty state.
+func fresh(f *FIRFilter) *FIRFilter {
+	return newFIRFilter(f.Taps, f.UpsampleFactor)
+}
+
+func closeTo(a, b complex64) bool {
+	return math.Abs(float64(real(a)-real(b))) < tolerance && math.Abs(float64(imag(a)-imag(b))) < tolerance
+}
@@ -0,0 +1,82 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+)
+
+// Pulse shapes for NewShapingFilter. Only ShapeRRC gives standard DVB-S:
+// a receiver's matched filter is RRC, and the pair together make the
+// raised-cosine pulse with no inter-symbol interference.
+const (
+	// ShapeRRC is the root raised cosine of EN 300 421.
+	ShapeRRC = "rrc"
+
+	// ShapeRC is the full raised cosine. Its tails fall off faster than
+	// the RRC's, so a short filter keeps more of its stopband, but after a
+	// receiver's RRC the pulse is no longer ISI-free and the MER suffers.
+	ShapeRC = "rc"
+
+	// ShapeRect holds each symbol for a symbol period: no filtering at all,
+	// one tap per output sample, and a sin(x)/x spectrum whose first
+	// sidelobes are only 13 dB down in the neighbouring channels.
+	ShapeRect = "rect"
+)
+
+// NewShapingFilter returns the pulse shaping filter for shape: numTaps taps
+// of RRC or RC at the given roll-off, or for ShapeRect one tap per sample of
+// a symbol, whatever numTaps is.
+func NewShapingFilter(shape string, symbolRate, sampleRate, rollOff float64, numTaps int) (*FIRFilter, error) {
+	switch shape {
+	case ShapeRRC:
+		return NewRRCFilter(symbolRate, sampleRate, rollOff, numTaps), nil
+	case ShapeRC:
+		return NewRCFilter(symbolRate, sampleRate, rollOff, numTaps), nil
+	case ShapeRect:
+		return NewRectFilter(symbolRate, sampleRate), nil
+	}
+	return nil, fmt.Errorf("unknown pulse shape %q, expected rrc, rc or rect", shape)
+}
+
+// NewRCFilter creates a raised cosine filter, normalised like NewRRCFilter.
+func NewRCFilter(symbolRate, sampleRate, rollOff float64, numTaps int) *FIRFilter {
+	sps := int(sampleRate / symbolRate)
+	taps := make([]float32, numTaps)
+	var gain float64
+	for i := 0; i < numTaps; i++ {
+		// Time in symbol periods from the pulse centre
+		t := (float64(i) - float64(numTaps-1)/2.0) * symbolRate / sampleRate
+		var tapVal float64
+		if math.Abs(math.Abs(2*rollOff*t)-1) < 1e-9 {
+			tapVal = math.Pi / 4 * sinc(1/(2*rollOff))
+		} else {
+			tapVal = sinc(t) * math.Cos(math.Pi*rollOff*t) / (1 - (2*rollOff*t)*(2*rollOff*t))
+		}
+		taps[i] = float32(tapVal)
+		if i%sps == 0 {
+			gain += tapVal
+		}
+	}
+	for i := range taps {
+		taps[i] /= float32(gain)
+	}
+	return newFIRFilter(taps, sps)
+}
+
+// NewRectFilter creates the rectangular pulse: each symbol repeated for
+// every sample of its period.
+func NewRectFilter(symbolRate, sampleRate float64) *FIRFilter {
+	sps := int(sampleRate / symbolRate)
+	taps := make([]float32, sps)
+	for i := range taps {
+		taps[i] = 1
+	}
+	return newFIRFilter(taps, sps)
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
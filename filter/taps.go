@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+)
+
+// MaxOccupiedFraction is the largest share of the sample rate the shaped
+// signal may occupy. Beyond it the roll-off skirts reach the band edge and
+// fold back on themselves, and the DAC's images close in on the signal
+// faster than the HackRF's baseband filter can separate them.
+const MaxOccupiedFraction = 0.8
+
+// MinSpanSymbols is the shortest RRC filter accepted, in symbols. Below
+// this the truncated pulse no longer suppresses ISI or out-of-band power.
+const MinSpanSymbols = 4
+
+// Span returns how many symbol periods a filter of numTaps taps covers at
+// the given samples per symbol: (numTaps-1) / samplesPerSymbol.
+func Span(numTaps, samplesPerSymbol int) float64 {
+	return float64(numTaps-1) / float64(samplesPerSymbol)
+}
+
+// ValidateRates checks that a signal at symbolRate with the given roll-off
+// can be generated at sampleRate: a whole number of samples per symbol, as
+// the polyphase filter needs, and an occupied bandwidth symbolRate*(1+rollOff)
+// within MaxOccupiedFraction of the sample rate.
+func ValidateRates(symbolRate, sampleRate, rollOff float64) error {
+	if rollOff <= 0 || rollOff > 1 {
+		return fmt.Errorf("roll-off %v must be in (0, 1]", rollOff)
+	}
+	sps := sampleRate / symbolRate
+	if sps < 2 || sps != math.Trunc(sps) {
+		return fmt.Errorf("%.0f samples/s is %.3f samples per symbol at %.0f symbols/s; need a whole number, at least 2", sampleRate, sps, symbolRate)
+	}
+	occupied := symbolRate * (1 + rollOff)
+	if occupied > MaxOccupiedFraction*sampleRate {
+		return fmt.Errorf("the signal occupies %.3f MHz (%.0f%% of the %.3f MHz sample rate, limit %.0f%%) and would alias; lower the symbol rate or roll-off, or raise the sample rate",
+			occupied/1e6, occupied/sampleRate*100, sampleRate/1e6, MaxOccupiedFraction*100)
+	}
+	return nil
+}
+
+// ValidateTaps checks that numTaps gives a symmetric filter (an odd count
+// puts a tap on the pulse centre) spanning at least MinSpanSymbols.
+func ValidateTaps(numTaps, samplesPerSymbol int) error {
+	if numTaps%2 == 0 {
+		return fmt.Errorf("%d taps: must be odd so the filter is symmetric about its centre tap", numTaps)
+	}
+	if span := Span(numTaps, samplesPerSymbol); span < MinSpanSymbols {
+		return fmt.Errorf("%d taps span only %.1f symbols at %d samples/symbol; need at least %d (%d taps)",
+			numTaps, span, samplesPerSymbol, MinSpanSymbols, MinSpanSymbols*samplesPerSymbol+1)
+	}
+	return nil
+}
+
+// PeakGain returns the largest factor the filter can scale one component
+// of its input by: the biggest sum of absolute taps over the polyphase
+// branches, reached when every symbol in the window has the sign of the tap
+// it meets. The taps are normalised so a constant input passes at gain 1,
+// but a worst-case symbol pattern overshoots that by half again or more.
+func (f *FIRFilter) PeakGain() float64 {
+	var peak float64
+	for j := 0; j < f.UpsampleFactor; j++ {
+		var sum float64
+		for k := j; k < len(f.Taps); k += f.UpsampleFactor {
+			sum += math.Abs(float64(f.Taps[k]))
+		}
+		peak = math.Max(peak, sum)
+	}
+	return peak
+}
@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ReadTaps reads filter taps written one per line, as numpy.savetxt and
+// MATLAB's writematrix write a column vector. Blank lines and lines
+// starting with # are skipped; anything else must be a finite number.
+func ReadTaps(r io.Reader) ([]float32, error) {
+	var taps []float32
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		v, err := strconv.ParseFloat(text, 32)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("line %d: %q is not a tap value; expected one number per line", line, text)
+		}
+		taps = append(taps, float32(v))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(taps) == 0 {
+		return nil, errors.New("no taps found")
+	}
+	var sum float64
+	for _, t := range taps {
+		sum += math.Abs(float64(t))
+	}
+	if sum == 0 {
+		return nil, errors.New("all taps are zero")
+	}
+	return taps, nil
+}
+
+// NewFIRFilterFromTaps creates a filter with the given taps, designed at
+// sampleRate, in place of a computed pulse. The scale of the taps does not
+// matter to the transmitter, which sets its level from PeakGain.
+func NewFIRFilterFromTaps(taps []float32, symbolRate, sampleRate float64) *FIRFilter {
+	return newFIRFilter(taps, int(sampleRate/symbolRate))
+}
+
+// Symmetric reports whether the taps read the same reversed, as a linear
+// phase pulse shaping filter's do.
+func (f *FIRFilter) Symmetric() bool {
+	n := len(f.Taps)
+	var peak float64
+	for _, t := range f.Taps {
+		peak = math.Max(peak, math.Abs(float64(t)))
+	}
+	for i := 0; i < n/2; i++ {
+		if math.Abs(float64(f.Taps[i]-f.Taps[n-1-i])) > 1e-6*peak {
+			return false
+		}
+	}
+	return true
+}
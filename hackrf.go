@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/samuel/go-hackrf/hackrf"
+	"hackdvbs/radio"
+)
+
+// hackrfDevice is a HackRF as a radio.Device.
+type hackrfDevice struct {
+	*hackrf.Device
+	amp string // -amp setting, re-applied on every retune for auto
+}
+
+func (d hackrfDevice) Format() radio.SampleFormat {
+	return txFormat
+}
+
+// SetFreq refuses what the HackRF cannot tune, which the driver would
+// otherwise pass on to the firmware.
+func (d hackrfDevice) SetFreq(hz uint64) error {
+	if lo, hi := d.FreqRange(); hz < lo || hz > hi {
+		return fmt.Errorf("frequency must be %.0f-%.0f MHz on a HackRF", minFreqMHz, maxFreqMHz)
+	}
+	if err := d.Device.SetFreq(hz); err != nil {
+		return err
+	}
+	if d.amp == ampAuto {
+		return d.applyAmp(float64(hz) / 1e6)
+	}
+	return nil
+}
+
+func (d hackrfDevice) FreqRange() (min, max uint64) {
+	return minFreqMHz * 1_000_000, maxFreqMHz * 1_000_000
+}
+
+func (d hackrfDevice) SetGain(db int) error {
+	return d.SetTXVGAGain(db)
+}
+
+func (d hackrfDevice) GainRange() (min, max int) {
+	return 0, maxTXGain
+}
+
+func (d hackrfDevice) StartTX(fill func(buf []byte) error) error {
+	return d.Device.StartTX(fill)
+}
@@ -0,0 +1,204 @@
+//go:build hil
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Hardware-in-the-loop settings; see TestHILLoopback
+const (
+	hilRxRate     = 2400000
+	hilSymbolRate = 1000000
+	hilStartup    = 30 * time.Second
+)
+
+// TestHILLoopback checks the whole chain on real radios: it transmits one
+// known TS packet on repeat with the HackRF at minimum gain, -strict so a
+// standard decoder can follow the inner code, receives it with an RTL-SDR
+// or a second HackRF, decodes the capture with leandvb and checks the
+// packet comes back intact. It keys a transmitter, so it needs the hil
+// build tag and HACKDVBS_HIL=1; use a dummy load or attenuators between
+// the radios.
+//
+//	HACKDVBS_HIL=1 go test -tags hil -run HIL -v .
+//
+// Environment:
+//
+//	HIL_FREQ        frequency in Hz (default 1250000000)
+//	HIL_PACKET      the packet to send (default single_packet.ts)
+//	HIL_RX          rtlsdr or hackrf, the receiver (default rtlsdr)
+//	HIL_RX_SERIAL   serial of the receiving HackRF; hackdvbs transmits on
+//	                the first HackRF found
+//	HIL_SECONDS     capture length (default 10)
+//	LEANDVB         path to leandvb (default: on $PATH)
+func TestHILLoopback(t *testing.T) {
+	if os.Getenv("HACKDVBS_HIL") != "1" {
+		t.Skip("set HACKDVBS_HIL=1 to key the transmitter")
+	}
+	freq := hilEnv("HIL_FREQ", "1250000000")
+	packet := hilEnv("HIL_PACKET", "single_packet.ts")
+	rx := hilEnv("HIL_RX", "rtlsdr")
+	seconds, err := strconv.Atoi(hilEnv("HIL_SECONDS", "10"))
+	if err != nil || seconds <= 0 {
+		t.Fatalf("HIL_SECONDS %q: must be a positive number of seconds", os.Getenv("HIL_SECONDS"))
+	}
+	leandvb := hilEnv("LEANDVB", "leandvb")
+	hz, err := strconv.ParseFloat(freq, 64)
+	if err != nil {
+		t.Fatalf("HIL_FREQ %q: must be a frequency in Hz", freq)
+	}
+	want, err := os.ReadFile(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tools := []string{leandvb}
+	switch rx {
+	case "rtlsdr":
+		tools = append(tools, "rtl_sdr")
+	case "hackrf":
+		tools = append(tools, "hackrf_transfer")
+	default:
+		t.Fatalf("HIL_RX %q: must be rtlsdr or hackrf", rx)
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Fatalf("%s not found", tool)
+		}
+	}
+
+	work := t.TempDir()
+	bin := filepath.Join(work, "hackdvbs")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build hackdvbs: %v\n%s", err, out)
+	}
+
+	t.Logf("Transmitting %s on %s Hz at minimum gain...", packet, freq)
+	var txLog lockedBuffer
+	tx := exec.Command(bin, "-strict", "-freq", strconv.FormatFloat(hz/1e6, 'f', -1, 64), "-gain", "0", "-repeat-packet", packet)
+	tx.Stdout, tx.Stderr = &txLog, &txLog
+	if err := tx.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- tx.Wait() }()
+	running := true
+	stopTX := func() {
+		if running {
+			tx.Process.Signal(os.Interrupt)
+			<-exited
+			running = false
+		}
+	}
+	defer stopTX()
+
+	// Let the prefill finish and the carrier come up
+	deadline := time.Now().Add(hilStartup)
+	for !strings.Contains(txLog.String(), "Transmission is live") {
+		select {
+		case err := <-exited:
+			running = false
+			t.Fatalf("transmitter exited: %v\n%s", err, txLog.String())
+		case <-time.After(time.Second):
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transmitter not live after %v\n%s", hilStartup, txLog.String())
+		}
+	}
+
+	t.Logf("Receiving %d s with %s...", seconds, rx)
+	samples := strconv.Itoa(hilRxRate * seconds)
+	rate := strconv.Itoa(hilRxRate)
+	var capture []byte
+	switch rx {
+	case "rtlsdr":
+		path := filepath.Join(work, "rx.u8")
+		hilRun(t, exec.Command("rtl_sdr", "-f", freq, "-s", rate, "-n", samples, path))
+		capture, err = os.ReadFile(path)
+	case "hackrf":
+		path := filepath.Join(work, "rx.s8")
+		args := []string{"-r", path, "-f", freq, "-s", rate, "-n", samples, "-l", "16", "-g", "20"}
+		if serial := os.Getenv("HIL_RX_SERIAL"); serial != "" {
+			args = append([]string{"-d", serial}, args...)
+		}
+		hilRun(t, exec.Command("hackrf_transfer", args...))
+		capture, err = os.ReadFile(path)
+		// hackrf_transfer writes signed 8-bit; leandvb reads rtl_sdr's
+		// offset binary
+		for i := range capture {
+			capture[i] ^= 0x80
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopTX()
+
+	t.Log("Decoding...")
+	var decoded, leandvbLog bytes.Buffer
+	dec := exec.Command(leandvb, "--sr", strconv.Itoa(hilSymbolRate), "--cr", "1/2", "-f", rate)
+	dec.Stdin, dec.Stdout, dec.Stderr = bytes.NewReader(capture), &decoded, &leandvbLog
+	dec.Run() // it exits non-zero at the end of its input
+
+	got := decoded.Bytes()
+	n, good := len(got)/len(want), 0
+	for i := 0; i < n; i++ {
+		if bytes.Equal(got[i*len(want):(i+1)*len(want)], want) {
+			good++
+		}
+	}
+	t.Logf("Decoded %d packets, %d match the transmitted packet", n, good)
+	if n == 0 {
+		t.Fatalf("nothing decoded; leandvb said:\n%s", hilTail(leandvbLog.String(), 20))
+	}
+	if float64(good) < 0.99*float64(n) {
+		t.Fatalf("more than 1%% of decoded packets differ; leandvb said:\n%s", hilTail(leandvbLog.String(), 20))
+	}
+}
+
+func hilEnv(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func hilRun(t *testing.T, cmd *exec.Cmd) {
+	t.Helper()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s failed: %v\n%s", cmd.Path, err, out)
+	}
+}
+
+// hilTail returns the last n lines of s.
+func hilTail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return strings.Join(lines[max(0, len(lines)-n):], "\n")
+}
+
+// lockedBuffer collects a command's output while the test reads it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
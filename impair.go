@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"hackdvbs/dvbs"
+)
+
+const (
+	// Taps of the windowed-sinc filter that applies the timing offset
+	impairDelayTaps = 24
+
+	// Fractional positions the symbol clock resampler has filters for; the
+	// nearest is used, which is accurate to well below the int8 noise floor
+	clockPhases = 256
+
+	// Largest -symclock-ppm accepted, far beyond any real oscillator
+	maxClockPPM = 1000
+)
+
+// impairments are deliberate signal defects for characterising receivers.
+type impairments struct {
+	esN0   float64 // dB; NaN for no noise
+	cfo    float64 // Hz
+	timing float64 // symbols
+
+	clockPPM float64 // symbol clock offset, set by -symclock-ppm
+}
+
+// parseImpairments parses "noise=20dB,cfo=1000,timing=0.1": the Es/N0 of
+// added white Gaussian noise, a carrier frequency offset in Hz and a
+// timing offset as a fraction of a symbol. Each key is optional.
+func parseImpairments(spec string, sampleRate float64) (impairments, error) {
+	imp := impairments{esN0: math.NaN()}
+	for _, part := range strings.Split(spec, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return imp, fmt.Errorf("expected key=value, got %q", part)
+		}
+		var err error
+		switch key {
+		case "noise":
+			imp.esN0, err = strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(val), "db"), 64)
+		case "cfo":
+			imp.cfo, err = strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(val), "hz"), 64)
+			if err == nil && math.Abs(imp.cfo) >= sampleRate/4 {
+				return imp, fmt.Errorf("cfo %v Hz would push the signal out of the %.0f Hz sample band", imp.cfo, sampleRate)
+			}
+		case "timing":
+			imp.timing, err = strconv.ParseFloat(val, 64)
+			if err == nil && (imp.timing < 0 || imp.timing >= 1) {
+				return imp, fmt.Errorf("timing %v must be a fraction of a symbol, 0 <= timing < 1", imp.timing)
+			}
+		default:
+			return imp, fmt.Errorf("unknown impairment %q (want noise, cfo, timing)", key)
+		}
+		if err != nil {
+			return imp, fmt.Errorf("invalid %s value %q", key, val)
+		}
+	}
+	return imp, nil
+}
+
+func (imp impairments) String() string {
+	var parts []string
+	if !math.IsNaN(imp.esN0) {
+		parts = append(parts, fmt.Sprintf("Es/N0 %.1f dB", imp.esN0))
+	}
+	if imp.cfo != 0 {
+		parts = append(parts, fmt.Sprintf("carrier offset %+.0f Hz", imp.cfo))
+	}
+	if imp.timing != 0 {
+		parts = append(parts, fmt.Sprintf("timing offset %.2f symbols", imp.timing))
+	}
+	if imp.clockPPM != 0 {
+		parts = append(parts, fmt.Sprintf("symbol clock %+.1f ppm", imp.clockPPM))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// impairer is a dvbs.SampleWriter that applies the symbol clock offset,
+// timing offset, carrier offset and noise, in that order, on the way to the
+// next writer.
+type impairer struct {
+	out dvbs.SampleWriter
+	imp impairments
+	sps float64
+
+	// Symbol clock: resampler and its output
+	clock    *clockResampler
+	clockOut []complex64
+
+	// Timing: fractional delay filter and the samples it still needs
+	delay []float32
+	hist  []complex64
+
+	// Carrier offset, nil if none
+	cfo *rotator
+
+	// Noise: scaled to the average signal power seen so far
+	rng      *rand.Rand
+	power    float64
+	powerN   float64
+	noiseLin float64 // noise power per unit signal power
+
+	buf []complex64
+}
+
+func newImpairer(out dvbs.SampleWriter, imp impairments, sampleRate, symbolRate float64) *impairer {
+	w := &impairer{
+		out: out,
+		imp: imp,
+		sps: sampleRate / symbolRate,
+		rng: rand.New(rand.NewSource(1)),
+	}
+	if imp.clockPPM != 0 {
+		w.clock = newClockResampler(imp.clockPPM)
+	}
+	if imp.timing != 0 {
+		w.delay = fractionalDelay(imp.timing*w.sps, impairDelayTaps)
+		w.hist = make([]complex64, impairDelayTaps-1)
+	}
+	if imp.cfo != 0 {
+		w.cfo = newRotator(imp.cfo, sampleRate)
+	}
+	if !math.IsNaN(imp.esN0) {
+		// Es/N0 = Ps*Fs / (Pn*Rs), with the noise spread over the sample rate
+		w.noiseLin = w.sps / math.Pow(10, imp.esN0/10)
+	}
+	return w
+}
+
+// fractionalDelay returns a Hann-windowed sinc that delays by d samples
+// (plus the filter's own fixed delay of n/2-1).
+func fractionalDelay(d float64, n int) []float32 {
+	centre := float64(n/2-1) + d
+	taps := make([]float32, n)
+	var sum float64
+	for k := range taps {
+		x := float64(k) - centre
+		if math.Abs(x) >= float64(n)/2 {
+			continue
+		}
+		v := 1.0
+		if x != 0 {
+			v = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		v *= 0.5 + 0.5*math.Cos(math.Pi*x/(float64(n)/2))
+		taps[k] = float32(v)
+		sum += v
+	}
+	for k := range taps {
+		taps[k] /= float32(sum)
+	}
+	return taps
+}
+
+// WriteAll implements dvbs.SampleWriter.
+func (w *impairer) WriteAll(samples []complex64) {
+	if w.clock != nil {
+		w.clockOut = w.clock.Process(samples, w.clockOut[:0])
+		samples = w.clockOut
+	}
+	if cap(w.buf) < len(samples) {
+		w.buf = make([]complex64, len(samples))
+	}
+	out := w.buf[:len(samples)]
+	copy(out, samples)
+
+	if w.delay != nil {
+		in := append(w.hist, samples...)
+		n := len(w.delay)
+		for i := range out {
+			var acc complex64
+			for k, t := range w.delay {
+				acc += in[i+n-1-k] * complex(t, 0)
+			}
+			out[i] = acc
+		}
+		w.hist = append(w.hist[:0], in[len(in)-(n-1):]...)
+	}
+
+	if w.cfo != nil {
+		w.cfo.Rotate(out)
+	}
+
+	if w.noiseLin != 0 {
+		for _, s := range out {
+			w.power += float64(real(s)*real(s) + imag(s)*imag(s))
+		}
+		w.powerN += float64(len(out))
+		sigma := float32(math.Sqrt(w.power / w.powerN * w.noiseLin / 2))
+		for i := range out {
+			out[i] += complex(sigma*float32(w.rng.NormFloat64()), sigma*float32(w.rng.NormFloat64()))
+		}
+	}
+	w.out.WriteAll(out)
+}
+
+// clockResampler runs the symbol clock fast or slow by resampling the
+// stream: each output sample is read from the input step = 1+ppm/1e6
+// samples after the last, so every symbol comes out ppm shorter (or
+// longer) while the sample rate stays put.
+type clockResampler struct {
+	step float64
+	pos  float64 // input position of the next output, relative to hist[0]
+	hist []complex64
+	bank [clockPhases + 1][]float32
+}
+
+func newClockResampler(ppm float64) *clockResampler {
+	r := &clockResampler{step: 1 + ppm/1e6}
+	for j := range r.bank {
+		r.bank[j] = fractionalDelay(-float64(j)/clockPhases, impairDelayTaps)
+	}
+	return r
+}
+
+// Process appends the resampled input to out and returns it.
+func (r *clockResampler) Process(in, out []complex64) []complex64 {
+	r.hist = append(r.hist, in...)
+	for {
+		i := int(r.pos)
+		if i+impairDelayTaps > len(r.hist) {
+			break
+		}
+		taps := r.bank[int((r.pos-float64(i))*clockPhases+0.5)]
+		window := r.hist[i : i+impairDelayTaps]
+		var acc complex64
+		for k, t := range taps {
+			acc += window[impairDelayTaps-1-k] * complex(t, 0)
+		}
+		out = append(out, acc)
+		r.pos += r.step
+	}
+	used := int(r.pos)
+	r.hist = append(r.hist[:0], r.hist[used:]...)
+	r.pos -= float64(used)
+	return out
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+	"sort"
+	"strings"
+
+	"hackdvbs/filter"
+	"hackdvbs/spectrum"
+)
+
+const (
+	// Samples analysed from the start of the capture; half a second at
+	// 2 Msps is plenty for the estimates and keeps the FFT small.
+	inspectMaxSamples = 1 << 20
+
+	// Welch segment size for the occupied-bandwidth measurement
+	inspectPSDSize = 1024
+
+	// Level at which the occupied bandwidth is measured for the roll-off
+	// estimate; deep enough to be on the skirt, shallow enough to stay clear
+	// of the noise floor in an off-air capture.
+	inspectRollOffLevel = 0.1 // -10 dB
+
+	// Taps of the matched filter used to recover the constellation
+	inspectMatchedTaps = 65
+
+	// Symbols per carrier phase estimate when recovering the constellation
+	inspectPhaseBlock = 256
+
+	constellationCols = 41
+	constellationRows = 21
+)
+
+// inspectIQ reads an 8-bit interleaved I/Q capture (as written by
+// hackrf_transfer -r) and prints estimates of what was transmitted.
+func inspectIQ(path string, sampleRate float64) error {
+	samples, err := readInt8IQ(path, inspectMaxSamples)
+	if err != nil {
+		return err
+	}
+	if len(samples) < 4*inspectPSDSize {
+		return fmt.Errorf("%s: only %d samples, need at least %d", path, len(samples), 4*inspectPSDSize)
+	}
+	removeDC(samples)
+
+	fmt.Printf("File:         %s\n", path)
+	fmt.Printf("Samples:      %d (%.3f s at %.3f Msps)\n", len(samples), float64(len(samples))/sampleRate, sampleRate/1e6)
+
+	sr := estimateSymbolRate(samples, sampleRate)
+	if sr == 0 {
+		return fmt.Errorf("no symbol rate line found; is this a single-carrier PSK signal?")
+	}
+	fmt.Printf("Symbol rate:  %.1f ksps (cyclostationary)\n", sr/1e3)
+
+	psd := spectrum.Welch(samples, inspectPSDSize)
+	bw3 := occupiedBandwidth(psd, sampleRate, 0.5)
+	fmt.Printf("Bandwidth:    %.1f kHz at -3 dB\n", bw3/1e3)
+	rollOff := estimateRollOff(psd, sampleRate, sr)
+	fmt.Printf("Roll-off:     %.2f (estimated from the -10 dB bandwidth)\n", rollOff)
+	lower, upper := spectrum.ACPR(psd, sampleRate, sr*(1+rollOff))
+	fmt.Printf("ACPR:         lower %.1f dB, upper %.1f dB\n", lower, upper)
+
+	symbols, offset := recoverSymbols(samples, sampleRate, sr, rollOff)
+	fmt.Printf("Carrier:      %+.1f Hz from the capture centre\n", offset)
+	mer := measureMER(symbols)
+	fmt.Printf("Symbols:      %d recovered, MER %.1f dB\n", len(symbols), mer)
+	fmt.Println()
+	printConstellation(symbols)
+	return nil
+}
+
+// readInt8IQ reads up to max complex samples of signed 8-bit I/Q.
+func readInt8IQ(path string, max int) ([]complex64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 2*max)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	samples := make([]complex64, n/2)
+	for i := range samples {
+		samples[i] = complex(float32(int8(buf[2*i]))/128, float32(int8(buf[2*i+1]))/128)
+	}
+	return samples, nil
+}
+
+func removeDC(samples []complex64) {
+	var sum complex128
+	for _, s := range samples {
+		sum += complex128(s)
+	}
+	dc := complex64(sum / complex(float64(len(samples)), 0))
+	for i := range samples {
+		samples[i] -= dc
+	}
+}
+
+// estimateSymbolRate finds the spectral line a linearly modulated signal's
+// envelope |x|^2 carries at the symbol rate.
+func estimateSymbolRate(samples []complex64, sampleRate float64) float64 {
+	n := 1
+	for n*2 <= len(samples) {
+		n *= 2
+	}
+	env := make([]complex128, n)
+	var mean float64
+	for i := range env {
+		p := float64(real(samples[i])*real(samples[i]) + imag(samples[i])*imag(samples[i]))
+		env[i] = complex(p, 0)
+		mean += p
+	}
+	mean /= float64(n)
+	for i := range env {
+		env[i] -= complex(mean, 0)
+	}
+	spectrum.FFT(env)
+
+	// Skip the lowest bins, where the envelope's own low-frequency
+	// fluctuation (fading, AGC) lives.
+	lo := n / 100
+	best, bestMag := 0, 0.0
+	for k := lo; k <= n/2; k++ {
+		if m := cmplx.Abs(env[k]); m > bestMag {
+			best, bestMag = k, m
+		}
+	}
+	if best == 0 {
+		return 0
+	}
+
+	// Parabolic interpolation around the peak (the spectrum of a real
+	// signal is symmetric, so bin n/2+1 mirrors n/2-1).
+	a := cmplx.Abs(env[best-1])
+	c := cmplx.Abs(env[(best+1)%n])
+	offset := 0.0
+	if d := a - 2*bestMag + c; d != 0 {
+		offset = 0.5 * (a - c) / d
+	}
+	return (float64(best) + offset) * sampleRate / float64(n)
+}
+
+// occupiedBandwidth returns the width of the spectrum above level (a linear
+// fraction of the in-band power).
+func occupiedBandwidth(psd []float64, sampleRate, level float64) float64 {
+	sorted := append([]float64(nil), psd...)
+	sort.Float64s(sorted)
+	// The 90th percentile is a robust estimate of the flat top of the spectrum
+	ref := sorted[len(sorted)*9/10]
+	threshold := ref * level
+
+	lo, hi := -1, -1
+	for i, p := range psd {
+		if p >= threshold {
+			if lo < 0 {
+				lo = i
+			}
+			hi = i
+		}
+	}
+	if lo < 0 {
+		return 0
+	}
+	return float64(hi-lo+1) * sampleRate / float64(len(psd))
+}
+
+// estimateRollOff inverts the raised-cosine power spectrum: at linear level
+// L the spectrum is W = SR*(1 + alpha*(2*acos(2L-1)/pi - 1)) wide.
+func estimateRollOff(psd []float64, sampleRate, symbolRate float64) float64 {
+	w := occupiedBandwidth(psd, sampleRate, inspectRollOffLevel)
+	k := 2*math.Acos(2*inspectRollOffLevel-1)/math.Pi - 1
+	alpha := (w/symbolRate - 1) / k
+	return math.Max(0, math.Min(1, alpha))
+}
+
+// recoverSymbols matched-filters the capture, picks the symbol timing phase
+// and removes the carrier offset and phase with the QPSK fourth-power method.
+// The symbols are normalised to unit RMS amplitude; the carrier offset is
+// returned in Hz (unambiguous up to an eighth of the symbol rate).
+func recoverSymbols(samples []complex64, sampleRate, symbolRate, rollOff float64) ([]complex128, float64) {
+	taps := filter.NewRRCFilter(symbolRate, sampleRate, math.Max(rollOff, 0.05), inspectMatchedTaps).Taps
+	mf := make([]complex128, len(samples)-len(taps)+1)
+	for i := range mf {
+		var acc complex128
+		for k, t := range taps {
+			acc += complex128(samples[i+k]) * complex(float64(t), 0)
+		}
+		mf[i] = acc
+	}
+
+	sps := sampleRate / symbolRate
+	at := func(t float64) complex128 {
+		i := int(t)
+		frac := t - float64(i)
+		return mf[i]*complex(1-frac, 0) + mf[i+1]*complex(frac, 0)
+	}
+	count := int((float64(len(mf)) - 2) / sps)
+
+	// At the right timing phase every QPSK symbol has the same magnitude,
+	// so pick the phase with the least envelope spread. Unlike maximising
+	// energy this is not fooled by the filter's between-symbol overshoot.
+	const phases = 16
+	bestPhase, bestSpread := 0.0, math.Inf(1)
+	for p := 0; p < phases; p++ {
+		phase := sps * float64(p) / phases
+		var sum, sumSq float64
+		for k := 0; k < count-1; k++ {
+			v := at(phase + float64(k)*sps)
+			e := real(v)*real(v) + imag(v)*imag(v)
+			sum += e
+			sumSq += e * e
+		}
+		mean := sum / float64(count-1)
+		if spread := sumSq/float64(count-1)/(mean*mean) - 1; spread < bestSpread {
+			bestPhase, bestSpread = phase, spread
+		}
+	}
+
+	symbols := make([]complex128, count-1)
+	for k := range symbols {
+		symbols[k] = at(bestPhase + float64(k)*sps)
+	}
+
+	// Frequency offset from the symbol-to-symbol rotation of z^4
+	var rot complex128
+	for k := 1; k < len(symbols); k++ {
+		a, b := symbols[k-1], symbols[k]
+		rot += b * b * b * b * cmplx.Conj(a*a*a*a)
+	}
+	dphi := cmplx.Phase(rot) / 4
+	for k := range symbols {
+		symbols[k] *= cmplx.Rect(1, -dphi*float64(k))
+	}
+
+	// Residual phase, tracked per block so that the leftover frequency error
+	// and the radio's phase noise do not smear the plot: QPSK points at 45
+	// degrees raise to -1. Block phases are unwrapped modulo 90 degrees so
+	// the constellation does not jump between blocks.
+	var power float64
+	for _, s := range symbols {
+		power += real(s)*real(s) + imag(s)*imag(s)
+	}
+	scale := 1 / math.Sqrt(power/float64(len(symbols)))
+	prev := 0.0
+	for start := 0; start < len(symbols); start += inspectPhaseBlock {
+		block := symbols[start:min(start+inspectPhaseBlock, len(symbols))]
+		var m4 complex128
+		for _, s := range block {
+			m4 += s * s * s * s
+		}
+		phase := (cmplx.Phase(m4) - math.Pi) / 4
+		if start > 0 {
+			phase -= math.Round((phase-prev)/(math.Pi/2)) * math.Pi / 2
+		}
+		prev = phase
+		rotate := cmplx.Rect(scale, -phase)
+		for k := range block {
+			block[k] *= rotate
+		}
+	}
+	return symbols, dphi * symbolRate / (2 * math.Pi)
+}
+
+// measureMER returns the modulation error ratio in dB against the ideal
+// QPSK points.
+func measureMER(symbols []complex128) float64 {
+	ideal := 1 / math.Sqrt2
+	var sig, errPow float64
+	for _, s := range symbols {
+		ref := complex(math.Copysign(ideal, real(s)), math.Copysign(ideal, imag(s)))
+		d := s - ref
+		sig += 1
+		errPow += real(d)*real(d) + imag(d)*imag(d)
+	}
+	return 10 * math.Log10(sig/errPow)
+}
+
+// printConstellation draws a density plot of the symbols in the terminal.
+func printConstellation(symbols []complex128) {
+	const span = 1.5 // plot covers -span..+span on both axes
+	var grid [constellationRows][constellationCols]int
+	peak := 0
+	for _, s := range symbols {
+		c := int((real(s) + span) / (2 * span) * constellationCols)
+		r := int((span - imag(s)) / (2 * span) * constellationRows)
+		if c < 0 || c >= constellationCols || r < 0 || r >= constellationRows {
+			continue
+		}
+		grid[r][c]++
+		peak = max(peak, grid[r][c])
+	}
+
+	const shades = " .:-=+*#%@"
+	border := "+" + strings.Repeat("-", constellationCols) + "+"
+	fmt.Println(border)
+	for r := range grid {
+		var line strings.Builder
+		line.WriteByte('|')
+		for c := range grid[r] {
+			n := grid[r][c]
+			switch {
+			case n > 0:
+				idx := 1 + int(math.Log1p(float64(n))/math.Log1p(float64(peak))*float64(len(shades)-2))
+				line.WriteByte(shades[idx])
+			case r == constellationRows/2:
+				line.WriteByte('-')
+			case c == constellationCols/2:
+				line.WriteByte('|')
+			default:
+				line.WriteByte(' ')
+			}
+		}
+		line.WriteByte('|')
+		fmt.Println(line.String())
+	}
+	fmt.Println(border)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"hackdvbs/ts"
+)
+
+const (
+	// Bytes searched for the packet size at the start of the file
+	inspectTSHead = 64 << 10
+
+	// Longest PCR interval ISO/IEC 13818-1 allows, and the interval DVB
+	// (TR 101 290) recommends, beyond which some receivers lose lock
+	maxPCRGap         = 100 * time.Millisecond
+	recommendedPCRGap = 40 * time.Millisecond
+)
+
+// inspectTS reads a whole TS file and prints its packet size, PAT and PMT,
+// each PID's bitrate and contents, and the continuity, TEI, CRC and PCR
+// problems found, then whether it is fit to transmit at capacity bits/s.
+// ok is false if it is not.
+func inspectTS(path string, capacity float64) (ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	r := bufio.NewReaderSize(f, inspectTSHead)
+	head, err := r.Peek(inspectTSHead)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if len(head) < ts.PacketSize {
+		return false, fmt.Errorf("the file is %d bytes, not even one TS packet", len(head))
+	}
+	size, offset, err := ts.DetectPacketSize(head)
+	if err != nil {
+		return false, err
+	}
+	r.Discard(offset)
+
+	in := ts.NewInspector()
+	var syncErrors uint64
+	unit := make([]byte, size)
+	for {
+		if _, err := io.ReadFull(r, unit); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return false, err
+		}
+		// The sync byte starts the 188 bytes of MPEG-TS in every variant
+		// DetectPacketSize finds
+		if unit[0] != ts.SyncByte {
+			syncErrors++
+			continue
+		}
+		in.Add(unit[:ts.PacketSize])
+	}
+	if in.Packets == 0 {
+		return false, errors.New("no TS packets found")
+	}
+
+	layout := &in.Layout
+	programs := make([]uint16, 0, len(layout.PMTPIDs))
+	for num := range layout.PMTPIDs {
+		programs = append(programs, num)
+	}
+	sort.Slice(programs, func(i, j int) bool { return programs[i] < programs[j] })
+	pcrPID := uint16(ts.NullPID)
+	if len(programs) > 0 {
+		pcrPID = layout.PCRPIDs[layout.PMTPIDs[programs[0]]]
+	}
+	bitrate, duration, haveRate := in.Bitrate(pcrPID)
+
+	fmt.Printf("File:         %s (%d bytes)\n", path, info.Size())
+	fmt.Printf("Packet size:  %d bytes (%s)\n", size, ts.PacketFormat(size))
+	fmt.Printf("Packets:      %d\n", in.Packets)
+	if haveRate {
+		fmt.Printf("Duration:     %.1f s (from the PCRs)\n", duration.Seconds())
+		fmt.Printf("Bitrate:      %.1f kbps\n", bitrate/1000)
+	} else {
+		fmt.Printf("Bitrate:      unknown, no PCRs to time the stream by\n")
+	}
+
+	// What each PID is, from the PAT and PMTs, and the fixed PIDs of the
+	// DVB service information (EN 300 468)
+	contents := map[uint16]string{
+		ts.PATPID:  "PAT",
+		0x0010:     "NIT (DVB)",
+		0x0011:     "SDT/BAT (DVB)",
+		0x0012:     "EIT (DVB)",
+		0x0014:     "TDT/TOT (DVB)",
+		ts.NullPID: "null packets",
+	}
+	if layout.PMTPIDs == nil {
+		fmt.Printf("PAT:          not found\n")
+	}
+	for _, num := range programs {
+		pmt := layout.PMTPIDs[num]
+		contents[pmt] = fmt.Sprintf("PMT, program %d", num)
+		streams, found := layout.Streams[pmt]
+		if !found {
+			fmt.Printf("Program %-5d PMT %#x not found\n", num, pmt)
+			continue
+		}
+		fmt.Printf("Program %-5d PMT %#x, PCR PID %#x\n", num, pmt, layout.PCRPIDs[pmt])
+		for _, st := range streams {
+			name := ts.StreamTypeName(st.Type)
+			if name == "" {
+				name = "unknown"
+			}
+			fmt.Printf("              %#x: stream type 0x%02x, %s\n", st.PID, st.Type, name)
+			contents[st.PID] = name
+		}
+	}
+
+	stats := in.PIDs()
+	var ccErrors, tei uint64
+	fmt.Println()
+	fmt.Printf("PID      Packets       kbps  CC errors  TEI  Contents\n")
+	for _, st := range stats {
+		kbps := "-"
+		if haveRate {
+			kbps = fmt.Sprintf("%.1f", bitrate*float64(st.Packets)/float64(in.Packets)/1000)
+		}
+		what := contents[st.PID]
+		if what == "" {
+			what = "not in any PMT"
+		}
+		if st.PCRs > 0 {
+			what += fmt.Sprintf(", %d PCRs at most %v apart", st.PCRs, st.MaxPCRGap.Round(time.Millisecond))
+		}
+		fmt.Printf("%-7s  %7d  %9s  %9d  %3d  %s\n", fmt.Sprintf("%#04x", st.PID), st.Packets, kbps, st.CCErrors, st.TEI, what)
+		ccErrors += st.CCErrors
+		tei += st.TEI
+	}
+	fmt.Println()
+	fmt.Printf("Continuity:   %d errors\n", ccErrors)
+	fmt.Printf("TEI:          %d packets\n", tei)
+	fmt.Printf("PSI CRC:      %d errors\n", in.CRCErrors)
+	if syncErrors > 0 {
+		fmt.Printf("Sync lost:    %d packets\n", syncErrors)
+	}
+
+	// Anything in problems stops the file transmitting properly; warnings
+	// are worth knowing but receivers cope
+	var problems, warnings []string
+	if size != ts.PacketSize {
+		problems = append(problems, fmt.Sprintf("%d-byte packets; remux to 188-byte MPEG-TS (e.g. ffmpeg -i in -c copy -f mpegts out.ts)", size))
+	}
+	if syncErrors > 0 {
+		problems = append(problems, fmt.Sprintf("sync byte missing from %d packets; the file is truncated or corrupt in places", syncErrors))
+	}
+	if layout.PMTPIDs == nil {
+		problems = append(problems, "no PAT; receivers will not find the programme")
+	}
+	for _, num := range programs {
+		if pmt := layout.PMTPIDs[num]; layout.Streams[pmt] == nil {
+			problems = append(problems, fmt.Sprintf("no PMT for program %d on PID %#x", num, pmt))
+		}
+	}
+	if len(programs) > 0 && layout.Complete() {
+		var pcrs uint64
+		var gap time.Duration
+		for _, st := range stats {
+			if st.PID == pcrPID {
+				pcrs, gap = st.PCRs, st.MaxPCRGap
+			}
+		}
+		switch {
+		case pcrs == 0:
+			problems = append(problems, fmt.Sprintf("no PCRs on the PCR PID %#x; receivers cannot lock to the stream's clock", pcrPID))
+		case gap > maxPCRGap:
+			problems = append(problems, fmt.Sprintf("PCRs up to %v apart, beyond the %v limit", gap.Round(time.Millisecond), maxPCRGap))
+		case gap > recommendedPCRGap:
+			warnings = append(warnings, fmt.Sprintf("PCRs up to %v apart; DVB recommends %v", gap.Round(time.Millisecond), recommendedPCRGap))
+		}
+	}
+	if ccErrors > 0 {
+		problems = append(problems, fmt.Sprintf("%d continuity errors; packets are missing, and receivers will show glitches", ccErrors))
+	}
+	if tei > 0 {
+		problems = append(problems, fmt.Sprintf("transport_error_indicator set on %d packets", tei))
+	}
+	if in.CRCErrors > 0 {
+		problems = append(problems, fmt.Sprintf("%d PAT or PMT sections fail their CRC", in.CRCErrors))
+	}
+	if haveRate && bitrate > capacity {
+		problems = append(problems, fmt.Sprintf("%.1f kbps is more than the channel's %.1f kbps; re-encode it lower, or it plays slowly", bitrate/1000, capacity/1000))
+	}
+
+	fmt.Println()
+	if len(problems) == 0 {
+		fmt.Printf("Verdict:      OK for DVB-S (channel capacity %.1f kbps)\n", capacity/1000)
+	} else {
+		fmt.Printf("Verdict:      NOT ready for DVB-S\n")
+	}
+	for _, p := range problems {
+		fmt.Printf("  problem: %s\n", p)
+	}
+	for _, w := range warnings {
+		fmt.Printf("  warning: %s\n", w)
+	}
+	return len(problems) == 0, nil
+}
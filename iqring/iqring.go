@@ -0,0 +1,120 @@
+// Package iqring provides a fixed-size ring buffer of I/Q samples that is
+// safe for exactly one producer goroutine and one consumer goroutine.
+package iqring
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// pollInterval is how long WriteAll sleeps while waiting for room.
+const pollInterval = time.Millisecond
+
+// Ring is a single-producer, single-consumer sample FIFO.
+//
+// The read and write positions are monotonically increasing counters; only
+// the producer stores the write position and only the consumer stores the
+// read position, so no locks are needed.
+type Ring struct {
+	buf   []complex64
+	write atomic.Uint64
+	read  atomic.Uint64
+
+	underruns atomic.Uint64
+	overruns  atomic.Uint64
+}
+
+// New returns an empty ring holding up to capacity samples.
+func New(capacity int) *Ring {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Ring{buf: make([]complex64, capacity)}
+}
+
+// Cap returns the capacity in samples.
+func (r *Ring) Cap() int {
+	return len(r.buf)
+}
+
+// Fill returns the number of samples waiting to be read.
+func (r *Ring) Fill() int {
+	return int(r.write.Load() - r.read.Load())
+}
+
+// Write copies as many samples as fit. It returns the number written and
+// false if the ring was too full to take them all, which counts as an overrun.
+// Only the producer may call Write.
+func (r *Ring) Write(samples []complex64) (int, bool) {
+	w := r.write.Load()
+	free := len(r.buf) - int(w-r.read.Load())
+	n := len(samples)
+	if n > free {
+		n = free
+	}
+	pos := int(w % uint64(len(r.buf)))
+	c := copy(r.buf[pos:], samples[:n])
+	copy(r.buf, samples[c:n])
+	r.write.Store(w + uint64(n))
+
+	if n < len(samples) {
+		r.overruns.Add(1)
+		return n, false
+	}
+	return n, true
+}
+
+// WriteAll writes every sample, waiting for the consumer to make room when
+// the ring is full. Each wait is counted as an overrun. Only the producer
+// may call WriteAll.
+func (r *Ring) WriteAll(samples []complex64) {
+	for {
+		n, ok := r.Write(samples)
+		if ok {
+			return
+		}
+		samples = samples[n:]
+		time.Sleep(pollInterval)
+	}
+}
+
+// Read copies up to len(dst) samples into dst and returns the number read.
+// A short read counts as an underrun. Only the consumer may call Read.
+func (r *Ring) Read(dst []complex64) int {
+	rd := r.read.Load()
+	avail := int(r.write.Load() - rd)
+	n := len(dst)
+	if n > avail {
+		n = avail
+	}
+	pos := int(rd % uint64(len(r.buf)))
+	c := copy(dst[:n], r.buf[pos:])
+	copy(dst[c:n], r.buf)
+	r.read.Store(rd + uint64(n))
+
+	if n < len(dst) {
+		r.underruns.Add(1)
+	}
+	return n
+}
+
+// Written returns the total number of samples ever written.
+func (r *Ring) Written() uint64 {
+	return r.write.Load()
+}
+
+// Consumed returns the total number of samples ever read.
+func (r *Ring) Consumed() uint64 {
+	return r.read.Load()
+}
+
+// Underruns returns the number of reads that could not be fully satisfied.
+func (r *Ring) Underruns() uint64 {
+	return r.underruns.Load()
+}
+
+// Overruns returns the number of writes that did not fit (for WriteAll, the
+// number of times the producer had to wait).
+func (r *Ring) Overruns() uint64 {
+	return r.overruns.Load()
+}
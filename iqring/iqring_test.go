@@ -0,0 +1,157 @@
+package iqring
+
+import (
+	"sync"
+	"testing"
+)
+
+// seq returns n samples counting up from start, so any sample out of
+// place or repeated is visible.
+func seq(start, n int) []complex64 {
+	s := make([]complex64, n)
+	for i := range s {
+		s[i] = complex(float32(start+i), -float32(start+i))
+	}
+	return s
+}
+
+func TestRing(t *testing.T) {
+	type op struct {
+		write, read int // samples offered / asked for
+		wantN       int // samples written or read
+		wantFill    int
+	}
+	tests := []struct {
+		name          string
+		capacity      int
+		ops           []op
+		wantUnderruns uint64
+		wantOverruns  uint64
+	}{
+		{
+			name:          "empty",
+			capacity:      8,
+			ops:           []op{{read: 4, wantN: 0, wantFill: 0}},
+			wantUnderruns: 1,
+		},
+		{
+			name:     "exact",
+			capacity: 8,
+			ops: []op{
+				{write: 5, wantN: 5, wantFill: 5},
+				{read: 5, wantN: 5, wantFill: 0},
+			},
+		},
+		{
+			name:     "full",
+			capacity: 8,
+			ops: []op{
+				{write: 8, wantN: 8, wantFill: 8},
+				{write: 1, wantN: 0, wantFill: 8},
+				{read: 8, wantN: 8, wantFill: 0},
+			},
+			wantOverruns: 1,
+		},
+		{
+			name:     "overfull write",
+			capacity: 8,
+			ops: []op{
+				{write: 11, wantN: 8, wantFill: 8},
+				{read: 10, wantN: 8, wantFill: 0},
+			},
+			wantUnderruns: 1,
+			wantOverruns:  1,
+		},
+		{
+			name:     "wraparound",
+			capacity: 8,
+			ops: []op{
+				{write: 6, wantN: 6, wantFill: 6},
+				{read: 5, wantN: 5, wantFill: 1},
+				{write: 6, wantN: 6, wantFill: 7}, // 2 at the end, 4 at the start
+				{read: 7, wantN: 7, wantFill: 0},
+				{write: 8, wantN: 8, wantFill: 8},
+				{read: 8, wantN: 8, wantFill: 0},
+			},
+		},
+		{
+			name:     "capacity below one",
+			capacity: 0,
+			ops: []op{
+				{write: 2, wantN: 1, wantFill: 1},
+				{read: 1, wantN: 1, wantFill: 0},
+			},
+			wantOverruns: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(tt.capacity)
+			written, read := 0, 0
+			for i, o := range tt.ops {
+				if o.write > 0 {
+					n, ok := r.Write(seq(written, o.write))
+					if n != o.wantN || ok != (n == o.write) {
+						t.Fatalf("op %d: Write(%d) = %d, %v, want %d", i, o.write, n, ok, o.wantN)
+					}
+					written += n
+				} else {
+					dst := make([]complex64, o.read)
+					n := r.Read(dst)
+					if n != o.wantN {
+						t.Fatalf("op %d: Read(%d) = %d, want %d", i, o.read, n, o.wantN)
+					}
+					for k, s := range dst[:n] {
+						if want := seq(read+k, 1)[0]; s != want {
+							t.Fatalf("op %d: sample %d is %v, want %v", i, read+k, s, want)
+						}
+					}
+					read += n
+				}
+				if fill := r.Fill(); fill != o.wantFill {
+					t.Fatalf("op %d: Fill() = %d, want %d", i, fill, o.wantFill)
+				}
+			}
+			if r.Written() != uint64(written) || r.Consumed() != uint64(read) {
+				t.Errorf("Written, Consumed = %d, %d, want %d, %d", r.Written(), r.Consumed(), written, read)
+			}
+			if r.Underruns() != tt.wantUnderruns || r.Overruns() != tt.wantOverruns {
+				t.Errorf("underruns, overruns = %d, %d, want %d, %d", r.Underruns(), r.Overruns(), tt.wantUnderruns, tt.wantOverruns)
+			}
+		})
+	}
+}
+
+// TestRingConcurrent streams a counting sequence through a small ring from
+// one goroutine to another, in chunks that do not divide its capacity, so
+// that run under -race it also checks the positions publish the samples.
+func TestRingConcurrent(t *testing.T) {
+	const total = 50000
+	r := New(1000)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for sent := 0; sent < total; {
+			n := min(337, total-sent)
+			r.WriteAll(seq(sent, n))
+			sent += n
+		}
+	}()
+
+	dst := make([]complex64, 251)
+	for got := 0; got < total; {
+		n := r.Read(dst)
+		for k, s := range dst[:n] {
+			if want := seq(got+k, 1)[0]; s != want {
+				t.Fatalf("sample %d is %v, want %v", got+k, s, want)
+			}
+		}
+		got += n
+	}
+	wg.Wait()
+	if fill := r.Fill(); fill != 0 {
+		t.Errorf("Fill() = %d after reading everything", fill)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"hackdvbs/iqring"
+)
+
+// latencyProbe measures how long samples take from leaving the encoder to
+// being handed to the radio. It tags the last sample of one packet at a
+// time and times it until the TX callback consumes it, then tags the next.
+type latencyProbe struct {
+	ring  *iqring.Ring
+	index atomic.Uint64 // ring position of the tagged sample, 0 when idle
+	start atomic.Int64  // UnixNano when the tagged packet left the encoder
+	last  atomic.Int64  // most recent measurement in nanoseconds
+}
+
+func newLatencyProbe(ring *iqring.Ring) *latencyProbe {
+	return &latencyProbe{ring: ring}
+}
+
+// WriteAll implements dvbs.SampleWriter, tagging a packet when idle.
+func (p *latencyProbe) WriteAll(samples []complex64) {
+	if p.index.Load() == 0 {
+		p.start.Store(time.Now().UnixNano())
+		p.index.Store(p.ring.Written() + uint64(len(samples)))
+	}
+	p.ring.WriteAll(samples)
+}
+
+// Check completes the measurement once the tagged sample has been consumed.
+// It is called from the TX callback after reading from the ring.
+func (p *latencyProbe) Check() {
+	idx := p.index.Load()
+	if idx == 0 || p.ring.Consumed() < idx {
+		return
+	}
+	p.last.Store(time.Now().UnixNano() - p.start.Load())
+	p.index.Store(0)
+}
+
+// Last returns the most recent latency, or 0 before the first measurement.
+func (p *latencyProbe) Last() time.Duration {
+	return time.Duration(p.last.Load())
+}
@@ -1,279 +1,1409 @@
 package main
 
 import (
+    "bytes"
     "context"
     "errors"
     "flag"
+    "fmt"
+    "io"
     "log"
+    "log/slog"
+    "math"
+    "net/url"
+    "os"
     "os/exec"
+    "path/filepath"
+    "runtime"
+    "slices"
     "strconv"
+    "strings"
+    "sync/atomic"
     "time"
 
     "github.com/samuel/go-hackrf/hackrf"
     "hackdvbs/consts"
+    "hackdvbs/control"
     "hackdvbs/dvbs"
     "hackdvbs/filter"
+    "hackdvbs/iqring"
+    "hackdvbs/netin"
+    "hackdvbs/radio"
+    "hackdvbs/ts"
     "hackdvbs/utils"
 )
 
 const (
     // Buffer size for streaming mode - back to 2Msps
     streamBufferSize = 8 * 1024 * 1024 // ~4 seconds at 2 Msps
+
+    // Fraction of the buffer to fill before keying up when -prefill auto
+    // cannot watch the source (without a radio); half full leaves equal
+    // margin for encoder bursts and encoder stalls
+    prefillFraction = 0.5
+
+    // Allowed deviation of the measured TX sample rate before warning
+    sampleRateTolerance = 0.02
+
+    // HackRF baseband (anti-image) filter, the narrowest that passes the
+    // 1.35 MHz signal
+    basebandFilterBW = 1750000
+
+    // How long the input may go quiet before -freeze-on-stall loops the last GOP
+    freezeStallTimeout = 250 * time.Millisecond
+
+    // A read of the TS counts as a producer stall once it has waited as
+    // long as this much TS takes at the mux rate, twice FFmpeg's 32 KiB
+    // output buffer, which it writes in one go; and never sooner than
+    // minProducerStall
+    producerStallBytes = 64 << 10
+    minProducerStall   = 250 * time.Millisecond
+
+    // The HackRF takes 8-bit I/Q. The level a unit sample is packed at is
+    // worked out from the filter's worst-case peak, less -backoff; see
+    // Config.Level.
+    txFormat = radio.Int8
+
+    // clipFreeLevel's allowance for rounding, 0.001 dB
+    clipFreeMargin = 0.9999
+
+    // Largest -backoff; beyond it the 8-bit samples keep too few levels
+    maxBackoffDB = 20
+
+    // -taps-file length beyond which the filter is likely too slow to keep up
+    maxCustomTaps = 255
+
+    // Factor each SIGUSR2 (SIGUSR1) raises (lowers) the video bitrate by,
+    // and the floor below which MPEG-2 is not worth watching
+    bitrateStepUp   = 1.25
+    minVideoBitrate = 100e3
+
+    // Samples per write when -no-radio stands in for the HackRF
+    noRadioChunk = 128 * 1024
+
+    // How long to wait for the first keyframe before filling the buffer anyway
+    softStartTimeout = 5 * time.Second
+
+    // Network input read ahead to ride out jitter, and how long it may go
+    // quiet before the gap is bridged with null packets
+    netBufferDepth  = 500 * time.Millisecond
+    netStallTimeout = 500 * time.Millisecond
+
+    // Encoder output -smooth can hold back while spreading out a burst
+    smootherDepth = 1 * time.Second
+
+    // While -max-latency skips to a keyframe, the buffer is kept at least
+    // this full with null packets; -max-latency must be at least twice it
+    latencyFloor = 150 * time.Millisecond
 )
 
 func main() {
-    freq := flag.Float64("freq", 1250.0, "Transmit frequency in MHz")
-    gain := flag.Int("gain", 30, "TX VGA gain (0-47)")
-    device := flag.String("device", "/dev/video0", "Video device (Linux) or device index (e.g., '0' for Windows/Mac)")
-    videoSize := flag.String("size", "640x480", "Video resolution (e.g., 640x480, 1280x720)")
-    videoBitrate := flag.String("vbitrate", "700k", "Video bitrate (e.g., 500k, 700k, 1M)")
-    audioBitrate := flag.String("abitrate", "128k", "Audio bitrate (e.g., 64k, 128k)")
-    fps := flag.Int("fps", 30, "Frames per second")
-    colorBars := flag.Bool("colorbars", false, "Use SMPTE color bars instead of webcam")
-    inputFile := flag.String("file", "", "Transmit a pre-recorded .ts file instead of live source")
+    cfg := Defaults()
+    cfg.RegisterFlags(flag.CommandLine)
+    envApplied, envErr := applyEnv(flag.CommandLine)
     flag.Parse()
+    // The config file fills in whatever the command line and environment left
+    var config map[string]string
+    var configErr error
+    if cfg.ConfigFile != "" {
+        config, configErr = applyConfig(cfg.ConfigFile, flag.CommandLine)
+    }
+    if err := utils.SetupLogging(cfg.LogFormat, cfg.Quiet); err != nil {
+        utils.Fatalf("Invalid -log-format: %v", err)
+    }
+    if envErr != nil {
+        utils.Fatalf("Invalid environment: %v", envErr)
+    }
+    if configErr != nil {
+        utils.Fatalf("Invalid -config: %v", configErr)
+    }
+
+    if cfg.ListDevices {
+        if err := listVideoDevices(); err != nil {
+            utils.Fatalf("Failed to list devices: %v", err)
+        }
+        os.Exit(0)
+    }
+    if cfg.InspectIQ != "" {
+        if err := inspectIQ(cfg.InspectIQ, cfg.IQRate); err != nil {
+            utils.Fatalf("Failed to inspect I/Q capture: %v", err)
+        }
+        os.Exit(0)
+    }
+    // "hackdvbs inspect FILE" is short for -inspect-ts FILE
+    if flag.Arg(0) == "inspect" {
+        if flag.NArg() != 2 {
+            utils.Fatal("Usage: hackdvbs inspect FILE.ts")
+        }
+        cfg.InspectTS = flag.Arg(1)
+    }
+    if cfg.InspectTS != "" {
+        ok, err := inspectTS(cfg.InspectTS, cfg.Capacity())
+        if err != nil {
+            utils.Fatalf("Failed to inspect TS: %v", err)
+        }
+        if !ok {
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+
+    if err := cfg.Validate(); err != nil {
+        utils.Fatalf("Invalid settings: %v", err)
+    }
+    samplesPerSymbol := int(consts.HackRFSampleRate / consts.SymbolRate)
+
+    // Parsed again for their values; Validate has already checked them
+    rampShape, _ := parseRampShape(cfg.RampShape)
+    imp := impairments{esN0: math.NaN()}
+    if cfg.Impair != "" {
+        imp, _ = parseImpairments(cfg.Impair, consts.HackRFSampleRate)
+    }
+    imp.clockPPM = cfg.SymClockPPM
+    var streamTypes map[uint16]byte
+    if cfg.StreamType != "" {
+        streamTypes, _ = parseStreamTypes(cfg.StreamType)
+    }
+    dataRate, _ := utils.ParseBitrate(cfg.DataRate)
+    level := cfg.Level()
+    var startAt time.Time
+    if cfg.StartAt != "" {
+        startAt, _ = time.Parse(time.RFC3339, cfg.StartAt)
+    }
+    var keyer *burstKeyer
+    if cfg.Burst != "" {
+        keyer, _ = parseBurst(cfg.Burst, consts.HackRFSampleRate, cfg.RampTime, rampShape)
+    }
+
+    if cfg.Power != "" {
+        gainSet := false
+        flag.Visit(func(f *flag.Flag) { gainSet = gainSet || f.Name == "gain" })
+        if gainSet {
+            utils.Fatal("-power and -gain cannot be combined")
+        }
+        target, _ := parsePower(cfg.Power)
+        cal := nominalPowerCal
+        if cfg.PowerCal != "" {
+            var err error
+            if cal, err = loadPowerCal(cfg.PowerCal); err != nil {
+                utils.Fatalf("Invalid -power-cal: %v", err)
+            }
+        }
+        // The tables hold at powerCalLevel with the amp on; the level in
+        // use shifts them, and so does the amp if -amp turns it off
+        shift := 20 * math.Log10(float64(level)/powerCalLevel)
+        if !ampEnabled(cfg.Amp, cfg.Freq) {
+            shift -= ampGainAt(cfg.Freq)
+        }
+        cfg.Gain = cal.GainFor(target-shift, cfg.Freq)
+        expected := cal.Output(cfg.Gain, cfg.Freq) + shift
+        log.Printf("Power: %.1f dBm requested, gain %d dB gives an estimated %.1f dBm at %.2f MHz", target, cfg.Gain, expected, cfg.Freq)
+        if math.Abs(expected-target) > 1 {
+            log.Printf("WARNING: %.1f dBm is outside what the calibration table reaches at this frequency", target)
+        }
+        if cal.nominal {
+            log.Println("Note: using the nominal HackRF One table; units vary by several dB, so measure yours and pass -power-cal")
+        }
+    }
 
     log.Println("--- Starting DVB-S Webcam Transmitter ---")
-    log.Printf("Frequency: %.2f MHz, Gain: %d dB", *freq, *gain)
+    if len(envApplied) > 0 {
+        log.Printf("Settings from environment: %s", strings.Join(envApplied, ", "))
+    }
+    log.Printf("Frequency: %.2f MHz, Gain: %d dB", cfg.Freq, cfg.Gain)
+    if cfg.TapsFile != "" {
+        custom, _ := cfg.Filter()
+        log.Printf("Custom filter: %d taps from %s, spanning %.1f symbols", len(custom.Taps), cfg.TapsFile, filter.Span(len(custom.Taps), samplesPerSymbol))
+        for _, w := range customTapsWarnings(custom) {
+            log.Printf("WARNING: -taps-file: %s", w)
+        }
+    } else if cfg.Shaping == filter.ShapeRect {
+        log.Println("WARNING: Rectangular pulses (-shaping rect): unfiltered, with strong sidelobes in the neighbouring channels. For cabled tests only.")
+    } else {
+        log.Printf("%s filter: %d taps, spanning %.0f symbols", strings.ToUpper(cfg.Shaping), cfg.Taps, filter.Span(cfg.Taps, samplesPerSymbol))
+    }
+    if cfg.Shaping == filter.ShapeRC {
+        log.Println("Note: Raised-cosine pulses (-shaping rc) are not what a DVB-S receiver's RRC filter expects; expect a lower MER")
+    }
+    log.Printf("Output level: %.0f of 127 counts per unit sample, %.1f dB below the filter's worst-case peak", level*127, cfg.Backoff)
+
+    g1, g2, _ := parseConvGenerators(cfg.ConvGen)
+    dvbsEncoder, err := dvbs.NewDVBSEncoderWithConv(g1, g2, false)
+    if err != nil {
+        utils.Fatalf("Invalid -conv-gen: %v", err)
+    }
+    if g1 != consts.ConvG1 || g2 != consts.ConvG2 {
+        requireDebugOverride(cfg.AllowInvalid, fmt.Sprintf("inner code generators %o,%o", g1, g2))
+    }
+    if cfg.CheckFraming {
+        log.Println("Scrambler framing check enabled")
+        dvbsEncoder.SetFramingCheck(true)
+    }
+    if cfg.ConvTerminate {
+        log.Println("Convolutional trellis termination enabled (6 tail bits per packet, non-standard)")
+        dvbsEncoder.SetConvTermination(true)
+    }
+    if cfg.PilotEvery > 0 {
+        pattern, _ := parsePilotPattern(cfg.PilotPattern)
+        log.Printf("Pilots: %d symbols after every %d packets (non-standard; receivers must strip them)", len(pattern), cfg.PilotEvery)
+        dvbsEncoder.SetPilots(cfg.PilotEvery, pattern)
+    }
+    if cfg.Strict {
+        log.Println("Strict EN 300 421 output: the inner code runs on across packets; SDRangel's receiver will not decode it")
+        dvbsEncoder.SetConvContinuous(true)
+    }
+    dvbsEncoder.SetFlushOnEnd(cfg.FlushOnEnd)
+    var bypass dvbs.Stage
+    var bypassed []string
+    for _, st := range []struct {
+        on    bool
+        stage dvbs.Stage
+        name  string
+    }{
+        {cfg.NoScramble, dvbs.StageScramble, "scrambler"},
+        {cfg.NoDispersal && !cfg.NoScramble, dvbs.StageDispersal, "energy dispersal PRBS"},
+        {cfg.NoRS, dvbs.StageReedSolomon, "Reed-Solomon"},
+        {cfg.NoInterleave, dvbs.StageInterleave, "interleaver"},
+        {cfg.NoConv, dvbs.StageConvolutional, "convolutional code"},
+    } {
+        if st.on {
+            bypass |= st.stage
+            bypassed = append(bypassed, st.name)
+        }
+    }
+    if bypass != 0 {
+        requireDebugOverride(cfg.AllowInvalid, "bypassing the "+strings.Join(bypassed, ", "))
+        dvbsEncoder.SetBypass(bypass)
+    }
+    var errInjector *dvbs.ErrorInjector
+    if cfg.InjectErrors != "" {
+        errInjector, _ = parseErrorInjection(cfg.InjectErrors)
+        requireDebugOverride(cfg.AllowInvalid, "injecting errors ("+cfg.InjectErrors+")")
+        dvbsEncoder.SetErrorInjector(errInjector)
+    }
+    if cfg.Phase != 0 {
+        log.Printf("Constellation phase offset: %.1f degrees", cfg.Phase)
+        dvbsEncoder.SetPhaseOffset(cfg.Phase)
+    }
+    if cfg.Benchmark != "" {
+        rrc, _ := cfg.Filter()
+        if err := benchmark(cfg.Benchmark, dvbsEncoder, rrc, level); err != nil {
+            utils.Fatalf("Benchmark failed: %v", err)
+        }
+        return
+    }
+    if cfg.SelfTest {
+        var out io.Writer
+        if cfg.IQOut != "" {
+            f, err := os.Create(cfg.IQOut)
+            if err != nil {
+                utils.Fatalf("Failed to create -iqout file: %v", err)
+            }
+            defer f.Close()
+            out = f
+        }
+        rrc, _ := cfg.Filter()
+        if err := selfTest(dvbsEncoder, rrc, cfg.Shaping == filter.ShapeRRC && cfg.TapsFile == "", level, out); err != nil {
+            utils.Fatalf("Self-test FAILED: %v", err)
+        }
+        return
+    }
+
+    // The TS must never arrive faster than the channel can carry it, or the
+    // buffer overflows and video stutters (Validate has checked a given -muxrate)
+    capacity := dvbsEncoder.NetBitrate(consts.SymbolRate)
+    if cfg.Muxrate == "" {
+        cfg.Muxrate = strconv.Itoa(int(capacity/1000)) + "k"
+    }
+    muxrateBps, _ := utils.ParseBitrate(cfg.Muxrate)
+    log.Printf("Channel capacity: %.1f kbps, mux rate: %s", capacity/1000, cfg.Muxrate)
+    dvbsEncoder.SetStallThreshold(max(minProducerStall, time.Duration(producerStallBytes*8/muxrateBps*float64(time.Second))))
+    if cfg.File == "" {
+        vbps, verr := utils.ParseBitrate(cfg.VideoBitrate)
+        abps, aerr := utils.ParseBitrate(cfg.AudioBitrate)
+        if cfg.AudioOnly {
+            vbps = 0
+        }
+        if verr == nil && aerr == nil && vbps+abps > muxrateBps*0.95 {
+            log.Printf("WARNING: Video + audio bitrate (%.0f kbps) leaves little headroom in the %s mux", (vbps+abps)/1000, cfg.Muxrate)
+        }
+    }
+
+    encOpts := ffmpegOptions{
+        Device:       cfg.Device,
+        VideoSize:    cfg.VideoSize,
+        FPS:          cfg.FPS,
+        VideoBitrate: cfg.VideoBitrate,
+        MPEG2Profile: cfg.MPEG2Profile,
+        AudioBitrate: cfg.AudioBitrate,
+        AudioCodec:   cfg.AudioCodec,
+        AudioRate:    cfg.AudioRate,
+        Channels:     cfg.AudioChannels,
+        Muxrate:      cfg.Muxrate,
+        ColorBars:    cfg.ColorBars || cfg.TestCard,
+        AudioOnly:    cfg.AudioOnly,
+        Stream:       cfg.RTMPURL + cfg.SRTURL, // at most one is set
+    }
+    if !cfg.AudioOnly {
+        width, height, _ := parseVideoSize(cfg.VideoSize)
+        encOpts.MPEG2Level, _ = chooseMPEG2(cfg.MPEG2Profile, cfg.MPEG2Level, width, height, cfg.FPS)
+    }
 
     var ffmpegCmd *exec.Cmd
-    if *inputFile != "" {
-        log.Printf("Source: File (%s)", *inputFile)
-        ffmpegCmd = buildFileCommand(*inputFile)
-    } else if *colorBars {
-        log.Printf("Video: %s @ %d fps, bitrate: %s", *videoSize, *fps, *videoBitrate)
+    liveEncoder := false // ffmpegCmd came from buildFFmpegCommand(encOpts)
+    if cfg.RepeatPacket != "" {
+        log.Printf("Source: Repeated packet (%s)", cfg.RepeatPacket)
+    } else if cfg.Playlist != "" {
+        log.Printf("Source: Playlist (%s)", cfg.Playlist)
+    } else if cfg.UDPAddr != "" {
+        proto := "UDP"
+        if cfg.RTP {
+            proto = "RTP"
+        }
+        log.Printf("Source: %s (%s)", proto, cfg.UDPAddr)
+    } else if cfg.TCPAddr != "" {
+        log.Printf("Source: TCP (%s)", cfg.TCPAddr)
+    } else if cfg.File != "" {
+        log.Printf("Source: File (%s)", cfg.File)
+        ffmpegCmd = buildFileCommand(cfg.File)
+    } else if encOpts.Stream != "" {
+        if cfg.AudioOnly {
+            log.Printf("Audio only: %s @ %s (radio service)", cfg.AudioCodec, cfg.AudioBitrate)
+        } else {
+            log.Printf("Video: %s @ %d fps, bitrate: %s, MPEG-2 %s", cfg.VideoSize, cfg.FPS, cfg.VideoBitrate, mpeg2Name(cfg.MPEG2Profile, encOpts.MPEG2Level))
+        }
+        log.Printf("Source: %s", streamName(encOpts.Stream))
+        ffmpegCmd = buildFFmpegCommand(encOpts)
+        liveEncoder = true
+    } else if cfg.AudioOnly {
+        log.Printf("Audio only: %s @ %s (radio service)", cfg.AudioCodec, cfg.AudioBitrate)
+        if cfg.ColorBars {
+            log.Println("Source: 1 kHz test tone")
+        } else {
+            log.Println("Source: ALSA default capture device")
+        }
+        ffmpegCmd = buildFFmpegCommand(encOpts)
+        liveEncoder = true
+    } else if cfg.Slideshow != "" {
+        list, err := writeSlideshowList(cfg.Slideshow, cfg.Dwell)
+        if err != nil {
+            utils.Fatalf("Invalid -slideshow: %v", err)
+        }
+        defer os.Remove(list)
+        encOpts.Slideshow = list
+        log.Printf("Video: %s @ %d fps, bitrate: %s, MPEG-2 %s", cfg.VideoSize, cfg.FPS, cfg.VideoBitrate, mpeg2Name(cfg.MPEG2Profile, encOpts.MPEG2Level))
+        log.Printf("Source: Slideshow (%s, %v per image)", cfg.Slideshow, cfg.Dwell)
+        ffmpegCmd = buildFFmpegCommand(encOpts)
+        liveEncoder = true
+    } else if cfg.TestCard {
+        text := testCardText(cfg.TestCardText, cfg.Callsign, cfg.Freq+cfg.IFOffset/1e6, consts.SymbolRate)
+        caption, err := writeTestCardText(text)
+        if err != nil {
+            utils.Fatalf("Failed to write the test card caption: %v", err)
+        }
+        defer os.Remove(caption)
+        encOpts.Caption = caption
+        log.Printf("Video: %s @ %d fps, bitrate: %s, MPEG-2 %s", cfg.VideoSize, cfg.FPS, cfg.VideoBitrate, mpeg2Name(cfg.MPEG2Profile, encOpts.MPEG2Level))
+        log.Printf("Source: Test card (SMPTE bars, 1 kHz tone, caption %q)", text)
+        ffmpegCmd = buildFFmpegCommand(encOpts)
+        liveEncoder = true
+    } else if cfg.ColorBars {
+        log.Printf("Video: %s @ %d fps, bitrate: %s, MPEG-2 %s", cfg.VideoSize, cfg.FPS, cfg.VideoBitrate, mpeg2Name(cfg.MPEG2Profile, encOpts.MPEG2Level))
         log.Println("Source: SMPTE Color Bars (test pattern)")
-        ffmpegCmd = buildFFmpegCommand(*device, *videoSize, *fps, *videoBitrate, *audioBitrate, true)
+        ffmpegCmd = buildFFmpegCommand(encOpts)
+        liveEncoder = true
     } else {
-        log.Printf("Video: %s @ %d fps, bitrate: %s", *videoSize, *fps, *videoBitrate)
-        log.Printf("Source: Webcam (%s)", *device)
-        ffmpegCmd = buildFFmpegCommand(*device, *videoSize, *fps, *videoBitrate, *audioBitrate, false)
+        log.Printf("Video: %s @ %d fps, bitrate: %s, MPEG-2 %s", cfg.VideoSize, cfg.FPS, cfg.VideoBitrate, mpeg2Name(cfg.MPEG2Profile, encOpts.MPEG2Level))
+        if runtime.GOOS == "linux" {
+            encOpts.Camera = chooseRPiCamera(cfg.Input)
+        }
+        if encOpts.Camera != "" {
+            log.Printf("Source: Raspberry Pi camera (%s)", filepath.Base(encOpts.Camera))
+        } else {
+            log.Printf("Source: Webcam (%s)", cfg.Device)
+            if runtime.GOOS == "linux" {
+                encOpts.InputFormat = negotiatePixelFormat(cfg.Device, cfg.PixFmt, cfg.VideoSize)
+            }
+        }
+        ffmpegCmd = buildFFmpegCommand(encOpts)
+        liveEncoder = true
     }
 
-    // Start FFmpeg to capture webcam and encode to MPEG-TS
+    // Video bitrate ceiling for runtime changes: whatever the audio leaves of the mux
+    abps, _ := utils.ParseBitrate(cfg.AudioBitrate)
+    maxVideo := muxrateBps - abps
 
-    ffmpegStdout, err := ffmpegCmd.StdoutPipe()
-    if err != nil {
-        log.Fatalf("Failed to get FFmpeg stdout pipe: %v", err)
-    }
+    var tsInput io.Reader
+    var udpIn *netin.UDPReader
+    var tcpIn *netin.TCPReader
+    var ffmpegSrc *ffmpegSource
+    if cfg.RepeatPacket != "" {
+        pkt, err := os.ReadFile(cfg.RepeatPacket)
+        if err != nil {
+            utils.Fatalf("Failed to read -repeat-packet: %v", err)
+        }
+        rep, err := ts.NewRepeater(pkt)
+        if err != nil {
+            utils.Fatalf("Invalid -repeat-packet %s: %v", cfg.RepeatPacket, err)
+        }
+        log.Printf("Repeating PID %d packet, CC %d, unchanged", ts.PID(pkt), ts.ContinuityCounter(pkt))
+        tsInput = rep
+    } else if cfg.Playlist != "" {
+        paths, err := readPlaylist(cfg.Playlist)
+        if err != nil {
+            utils.Fatalf("Failed to read -playlist: %v", err)
+        }
+        // The files are sent as they are, so they must be muxed at the channel rate
+        pl, err := ts.NewPlaylist(paths, capacity)
+        if err != nil {
+            utils.Fatalf("Failed to start playlist: %v", err)
+        }
+        tsInput = pl
+    } else if cfg.TCPAddr != "" {
+        tcpIn, err = netin.DialTCP(cfg.TCPAddr)
+        if err != nil {
+            utils.Fatalf("Failed to open network input: %v", err)
+        }
+        defer tcpIn.Close()
+        tsInput = tcpIn
+    } else if ffmpegCmd == nil {
+        udpIn, err = netin.ListenUDP(cfg.UDPAddr, cfg.Iface, cfg.RTP)
+        if err != nil {
+            utils.Fatalf("Failed to open network input: %v", err)
+        }
+        defer udpIn.Close()
+        tsInput = udpIn
+    } else {
+        // Start FFmpeg to capture webcam and encode to MPEG-TS
+        ffmpegSrc, err = startFFmpegSource(ffmpegCmd, encOpts, liveEncoder)
+        if err != nil {
+            utils.Fatalf("Failed to start FFmpeg: %v", err)
+        }
+        defer ffmpegSrc.Kill()
+        tsInput = ffmpegSrc
 
-    ffmpegStderr, err := ffmpegCmd.StderrPipe()
-    if err != nil {
-        log.Fatalf("Failed to get FFmpeg stderr pipe: %v", err)
+        if liveEncoder && !cfg.AudioOnly {
+            // kill -USR1 / -USR2 steps the video bitrate down / up, e.g. when
+            // a receiving station reports break-up
+            down, up := notifyBitrateSignals()
+            go func() {
+                for {
+                    factor := bitrateStepUp
+                    select {
+                    case <-down:
+                        factor = 1 / bitrateStepUp
+                    case <-up:
+                    }
+                    cur, err := utils.ParseBitrate(ffmpegSrc.VideoBitrate())
+                    if err != nil {
+                        continue
+                    }
+                    next := math.Max(minVideoBitrate, math.Min(cur*factor, maxVideo))
+                    if err := ffmpegSrc.SetVideoBitrate(strconv.Itoa(int(next/1000)) + "k"); err != nil {
+                        log.Printf("WARNING: Video bitrate change failed: %v", err)
+                    }
+                }
+            }()
+        }
     }
 
-    if err := ffmpegCmd.Start(); err != nil {
-        log.Fatalf("Failed to start FFmpeg: %v", err)
+    // Fail fast on the wrong kind of file rather than transmitting noise
+    if cfg.ValidatePackets > 0 {
+        checked, err := ts.Validate(tsInput, cfg.ValidatePackets)
+        if err != nil {
+            utils.Fatalf("Invalid input: %v", err)
+        }
+        tsInput = checked
     }
-    defer ffmpegCmd.Process.Kill()
-
-    // Log FFmpeg output in background
-    go utils.LogFFmpeg(ffmpegStderr)
 
-    // Initialize HackRF
-    if err := hackrf.Init(); err != nil {
-        log.Fatalf("hackrf.Init() failed: %v", err)
+    tuneHz := correctFreq(cfg.Freq*1_000_000, cfg.FreqCorrection)
+    if cfg.FreqCorrection != 0 {
+        log.Printf("Frequency correction: %+.2f ppm, tuning to %.6f MHz", cfg.FreqCorrection, float64(tuneHz)/1e6)
     }
-    defer hackrf.Exit()
 
-    dev, err := hackrf.Open()
-    if err != nil {
-        log.Fatalf("hackrf.Open() failed: %v", err)
+    if cfg.SymOut != "" && !cfg.NoRadio {
+        log.Println("Note: -symout writes symbols instead of transmitting; the radio is not opened")
+        cfg.NoRadio = true
+    }
+    sinks := map[string]bool{sinkRadio: !cfg.NoRadio, sinkFile: cfg.IQOut != ""}
+    if cfg.Sinks != "" {
+        sinks, _ = parseSinks(cfg.Sinks)
+        if !sinks[sinkRadio] && !cfg.NoRadio {
+            log.Println("Note: -sinks leaves out the radio; it is not opened")
+            cfg.NoRadio = true
+        }
     }
-    defer dev.Close()
+    var dev radio.Device
+    format := txFormat
+    if cfg.NoRadio {
+        log.Println("Radio disabled (-no-radio): samples are encoded but not transmitted")
+    } else if cfg.Soapy != "" {
+        dev, err = radio.OpenSoapy(cfg.Soapy, consts.HackRFSampleRate, basebandFilterBW, float64(tuneHz), cfg.Gain)
+        if err != nil {
+            utils.Fatalf("Failed to open SoapySDR device: %v", err)
+        }
+        defer dev.Close()
+        format = dev.Format()
+        log.Printf("Radio: SoapySDR %q, %s samples", cfg.Soapy, format)
+    } else {
+        // Initialize HackRF
+        if err := hackrf.Init(); err != nil {
+            utils.Fatalf("hackrf.Init() failed: %v", err)
+        }
+        defer hackrf.Exit()
+
+        hdev, err := hackrf.Open()
+        if err != nil {
+            utils.Fatalf("hackrf.Open() failed: %v", err)
+        }
+        defer hdev.Close()
+        probeHackRF(hdev, consts.HackRFSampleRate)
 
-    dev.SetFreq(uint64(*freq * 1_000_000))
-    dev.SetSampleRate(consts.HackRFSampleRate)
-    dev.SetTXVGAGain(*gain)
-    dev.SetAmpEnable(true)  // Re-enable amp
-    dev.SetBasebandFilterBandwidth(1750000)
+        if err := hdev.SetFreq(tuneHz); err != nil {
+            utils.Fatalf("Failed to tune to %.6f MHz: %v", float64(tuneHz)/1e6, err)
+        }
+        // The synthesizer only lands on multiples of its step; the reference
+        // error, once corrected for, scales the result back onto -freq
+        onAir := hackrfTunedHz(tuneHz) * (1 + cfg.FreqCorrection/1e6)
+        log.Printf("Tuning: carrier at %.6f MHz, %+.1f Hz from %.6f MHz (synthesizer step)", onAir/1e6, onAir-cfg.Freq*1e6, cfg.Freq)
+        hdev.SetSampleRate(consts.HackRFSampleRate)
+        hdev.SetTXVGAGain(cfg.Gain)
+        if err := (hackrfDevice{hdev, cfg.Amp}).applyAmp(cfg.Freq); err != nil {
+            utils.Fatalf("Failed to set the RF amp: %v", err)
+        }
+        hdev.SetBasebandFilterBandwidth(basebandFilterBW)
+        if cfg.AntennaPower {
+            if err := hdev.SetAntennaEnable(true); err != nil {
+                utils.Fatalf("Failed to turn on antenna port power: %v", err)
+            }
+            // Deferred after Close, so it runs first: the port must not stay powered after exit
+            defer hdev.SetAntennaEnable(false)
+            log.Println("WARNING: Antenna port power is on: 3.3 V DC, 50 mA at most, on the TX port")
+            log.Println("Note: this cannot power an LNB (13/18 V, up to 400 mA); use an LNB power inserter, and DC-block the HackRF from it")
+        }
+        dev = hackrfDevice{hdev, cfg.Amp}
+    }
 
-    // Create DVB-S encoder and filter
-    rrcFilter := filter.NewRRCFilter(consts.SymbolRate, consts.HackRFSampleRate, consts.RollOffFactor, consts.RRCFilterTaps)
-    dvbsEncoder := dvbs.NewDVBSEncoder()
+    // Create DVB-S filter
+    rrcFilter, _ := cfg.Filter()
 
-    // Create I/Q sample buffer and channel - use complex64 for speed
-    iqChannel := make(chan complex64, 2*1024*1024)
-    sampleBuffer := make([]complex64, streamBufferSize)
-    bufferReadPos := 0
-    bufferWritePos := 0
+    // Create the I/Q sample ring buffer - use complex64 for speed. This is
+    // the only buffer between encoder and radio: when it is full the encoder
+    // blocks until the radio drains it.
+    ring := iqring.New(streamBufferSize)
+    latency := newLatencyProbe(ring)
+    var selfMon *selfMonitor
+    if cfg.SelfMonitor {
+        selfMon = newSelfMonitor(format, level)
+    }
+    var specMon *spectrumMonitor
+    if sinks[sinkFFT] {
+        specMon = newSpectrumMonitor(format, level, cfg.IFOffset)
+    }
 
-    // Start the DVB-S encoding goroutine
-    go dvbs.StreamToIQ(ffmpegStdout, iqChannel, dvbsEncoder, rrcFilter)
+    // Network drops are bridged with nulls unless the freeze or the
+    // smoother already covers for a stalled input
+    var bridge *ts.Bridge
+    if (udpIn != nil || tcpIn != nil || encOpts.Stream != "") && !cfg.FreezeOnStall && !cfg.Smooth {
+        bridge = ts.NewBridge(tsInput, capacity, netBufferDepth, netStallTimeout)
+        tsInput = bridge
+    }
 
-    // Wait for channel to fill substantially before buffering
-    log.Println("Waiting for encoder to build up data...")
-    targetChannelFill := 1500000 // ~0.75 seconds at 2Msps
-    for {
-        channelSize := len(iqChannel)
-        if channelSize >= targetChannelFill {
-            log.Printf("Channel ready with %d samples", channelSize)
-            break
+    // Start the buffer on a GOP boundary rather than the encoder's startup
+    // burst (a repeated packet is sent as it is, from the first one)
+    tsSource := tsInput
+    if cfg.RepeatPacket == "" {
+        tsSource = ts.NewKeyframeGate(tsInput, softStartTimeout)
+    }
+    if cfg.FreezeOnStall {
+        log.Printf("Freeze-on-stall enabled (stall timeout %v)", freezeStallTimeout)
+        tsSource = ts.NewFreezeReader(tsSource, freezeStallTimeout)
+    }
+    // The prefill and a -start-at hold fill the buffer on purpose, so
+    // -max-latency only counts it once the radio is taking samples
+    var txStarted atomic.Bool
+    var latencyCap *ts.LatencyCap
+    if cfg.MaxLatency > 0 {
+        log.Printf("Low latency: skipping to the next keyframe whenever more than %v is buffered", cfg.MaxLatency)
+        buffered := func() time.Duration {
+            if !txStarted.Load() {
+                return 0
+            }
+            return time.Duration(float64(ring.Fill()) / consts.HackRFSampleRate * float64(time.Second))
         }
-        log.Printf("Channel filling... %d / %d samples (%.1f%%)", channelSize, targetChannelFill, float64(channelSize)*100/float64(targetChannelFill))
-        time.Sleep(1 * time.Second)
+        latencyCap = ts.NewLatencyCap(tsSource, buffered, cfg.MaxLatency, latencyFloor)
+        tsSource = latencyCap
     }
-    
-    // Pre-fill buffer
-    log.Println("Pre-filling buffer...")
-    for i := 0; i < streamBufferSize; i++ {
-        sample, ok := <-iqChannel
-        if !ok {
-            log.Fatal("Stream ended before buffer was filled")
+    if cfg.LockAssist > 0 {
+        // Read before anything from the gate, so the nulls are not
+        // discarded waiting for a keyframe; they air first, at key-up
+        n := int(cfg.LockAssist.Seconds() * capacity / (ts.PacketSize * 8))
+        log.Printf("Lock assist: %d null packets (%v) before the stream", n, cfg.LockAssist)
+        tsSource = ts.NewLeadIn(tsSource, n)
+    }
+    if streamTypes != nil {
+        log.Printf("Rewriting PMT stream types: %s", cfg.StreamType)
+        tsSource = ts.NewStreamTypeRewriter(tsSource, streamTypes)
+    }
+    var smoother *ts.Smoother
+    if cfg.Smooth {
+        log.Printf("Smoothing at %.1f kbps (bucket holds %v)", capacity/1000, smootherDepth)
+        if !cfg.RestampPCR {
+            log.Println("Note: smoothing delays packets by varying amounts; add -restamp-pcr if the receiver complains about PCR jitter")
         }
-        sampleBuffer[i] = sample
+        smoother = ts.NewSmoother(tsSource, capacity, smootherDepth)
+        tsSource = smoother
     }
-    bufferWritePos = 0
-    
-    // Final check - channel should still have plenty
-    channelFill := len(iqChannel)
-    log.Printf("Buffer filled (%d samples = %.2f seconds), channel has %d samples ready", 
-        streamBufferSize, float64(streamBufferSize)/float64(consts.HackRFSampleRate), channelFill)
-    
-    // Don't start until we have reserve
-    for channelFill < 200000 {
-        log.Printf("Waiting for reserve... channel at %d samples", channelFill)
-        time.Sleep(2 * time.Second)
-        channelFill = len(iqChannel)
+    var dataIns *ts.DataInserter
+    if cfg.DataSource != "" {
+        data, err := openDataSource(cfg.DataSource)
+        if err != nil {
+            utils.Fatalf("Failed to open data source: %v", err)
+        }
+        log.Printf("Data channel: %s on PID %#x at up to %.1f kbps, in place of null packets", cfg.DataSource, cfg.DataPID, dataRate/1000)
+        if (udpIn != nil || tcpIn != nil) && !cfg.Smooth {
+            log.Println("Note: data only replaces null packets; a VBR network source may have none to spare, so add -smooth to pad it to the channel rate")
+        }
+        dataIns = ts.NewDataInserter(tsSource, uint16(cfg.DataPID), data, dataRate, capacity)
+        tsSource = dataIns
+    }
+    if cfg.RestampPCR {
+        // Every TS packet becomes a fixed number of symbols, so the stream
+        // leaves the modulator at exactly the channel's net bitrate.
+        log.Printf("Re-stamping PCR at %.1f kbps", capacity/1000)
+        tsSource = ts.NewPCRStamper(tsSource, capacity)
+    }
+    if cfg.StreamCheck > 0 && cfg.RepeatPacket == "" {
+        // Nearest the encoder, so it sees the stream as it goes out
+        n := int(cfg.StreamCheck.Seconds() * capacity / (ts.PacketSize * 8))
+        check := ts.NewStreamCheck(tsSource, n)
+        tsSource = check
+        go func() {
+            <-check.Done()
+            capture := liveEncoder && encOpts.Stream == "" && !encOpts.ColorBars && cfg.Slideshow == ""
+            reportStreamCheck(check, cfg.StreamCheck, capture, cfg.AudioOnly)
+        }()
+    }
+    if cfg.TSOut != "" {
+        f, err := os.Create(cfg.TSOut)
+        if err != nil {
+            utils.Fatalf("Failed to create -tsout file: %v", err)
+        }
+        defer f.Close()
+        tap := newTSTap(tsSource, f)
+        defer tap.Flush()
+        tsSource = tap
+        log.Printf("Writing encoder input TS to %s", cfg.TSOut)
     }
-    
-    log.Println("Starting transmission...")
 
-    // Track buffer health
-    var bufferUnderflows uint64
+    // Timed from the start of encoding, so the prefill counts towards the run
+    summary := newRunSummary()
 
-    // Background goroutine to continuously fill the buffer
+    var sink dvbs.SampleWriter = latency
+    if cfg.Impair != "" || cfg.SymClockPPM != 0 {
+        log.Printf("Impairments: %s", imp)
+        sink = newImpairer(latency, imp, consts.HackRFSampleRate, consts.SymbolRate)
+    }
+    if cfg.IFOffset != 0 {
+        // Ahead of the impairments, which stand for the channel
+        log.Printf("IF offset: %+.0f Hz, the signal is centred on %.4f MHz with the LO leakage %.0f kHz from its centre",
+            cfg.IFOffset, cfg.Freq+cfg.IFOffset/1e6, math.Abs(cfg.IFOffset)/1e3)
+        sink = newNCOShifter(sink, cfg.IFOffset, consts.HackRFSampleRate)
+    }
+
+    // -symout takes the symbols ahead of the RRC filter, in place of the
+    // samples; its failure channel stays nil, never ready, without it
+    var symOut *symbolWriter
+    var symFailed <-chan struct{}
+    if cfg.SymOut != "" {
+        out := os.Stdout
+        if cfg.SymOut != "-" {
+            // Write-only, as os.Create's read-write open of a FIFO would
+            // make this its own reader, blocking instead of failing once
+            // the real reader goes away
+            f, err := os.OpenFile(cfg.SymOut, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+            if err != nil {
+                utils.Fatalf("Failed to create -symout file: %v", err)
+            }
+            defer f.Close()
+            out = f
+        }
+        symOut = newSymbolWriter(out)
+        symFailed = symOut.Failed()
+        sink, rrcFilter = symOut, nil
+        log.Printf("Writing QPSK symbols to %s at %.0f symbols/s, complex float32", cfg.SymOut, consts.SymbolRate)
+    }
+
+    // Start the DVB-S encoding goroutine
+    encoderDone := make(chan struct{})
     go func() {
-        for sample := range iqChannel {
-            sampleBuffer[bufferWritePos] = sample
-            bufferWritePos = (bufferWritePos + 1) % streamBufferSize
+        if err := dvbs.StreamToIQ(tsSource, sink, dvbsEncoder, rrcFilter); err != nil {
+            log.Printf("Error: encoder failed: %v", err)
         }
-        log.Println("Warning: IQ channel closed, no more samples!")
+        log.Println("Warning: Encoder stopped, no more samples!")
+        close(encoderDone)
     }()
 
+    // Pre-fill buffer (pointless without a radio pulling in real time).
+    // A live source runs in real time whatever the buffer holds, so what it
+    // fills beyond the prefill is latency, and is dropped before going on air
+    live := liveEncoder || udpIn != nil || tcpIn != nil
+    prefill, autoFill, _ := parsePrefill(cfg.Prefill)
+    target := int(prefill.Seconds() * consts.HackRFSampleRate)
+    if autoFill {
+        target = int(float64(ring.Cap()) * prefillFraction)
+    }
+    // Validate has kept an explicit prefill below -max-latency
+    maxTarget := ring.Cap()
+    if cfg.MaxLatency > 0 {
+        maxTarget = int(cfg.MaxLatency.Seconds() / 2 * consts.HackRFSampleRate)
+    }
+    if !cfg.NoRadio {
+        log.Println("Pre-filling buffer...")
+        if autoFill {
+            src, ok := observeSource(ring, consts.HackRFSampleRate, encoderDone)
+            if !ok {
+                utils.Fatal("Error: stream ended before the buffer was filled")
+            }
+            target = min(autoPrefill(src, ring.Cap(), consts.HackRFSampleRate), maxTarget)
+            if src.Outpaced {
+                log.Printf("Prefill (auto): %.2f s; the source ran ahead of real time, filling %.0f%% of the buffer in %v", float64(target)/consts.HackRFSampleRate, maxPrefillFraction*100, src.Observed.Round(time.Millisecond))
+            } else {
+                log.Printf("Prefill (auto): %.2f s; over %v the source fell up to %.2f s behind real time, delivering %.1f%% of the sample rate",
+                    float64(target)/consts.HackRFSampleRate, src.Observed.Round(time.Millisecond), float64(src.Shortfall)/consts.HackRFSampleRate, src.Rate*100)
+                if src.Rate < 1-sampleRateTolerance {
+                    log.Println("WARNING: The source is slower than the radio; expect underflows whatever the prefill (see -benchmark)")
+                }
+            }
+            if live {
+                discardExcess(ring, target, make([]complex64, noRadioChunk), latency.Check)
+            }
+        }
+        for ring.Fill() < target {
+            select {
+            case <-encoderDone:
+                utils.Fatal("Error: stream ended before the buffer was filled")
+            case <-time.After(1 * time.Second):
+            }
+            log.Printf("Buffer filling... %d / %d samples (%.1f%%)", ring.Fill(), target, float64(ring.Fill())*100/float64(target))
+        }
+        log.Printf("Buffer filled (%d samples = %.2f seconds of encoder-to-RF latency)",
+            ring.Fill(), float64(ring.Fill())/float64(consts.HackRFSampleRate))
+    }
+    
+    if keyer != nil {
+        log.Printf("Burst mode: %s (%.0f%% duty cycle, %v ramps)", cfg.Burst, keyer.DutyCycle()*100, cfg.RampTime)
+    }
+    log.Printf("Key ramp: %s, %v", cfg.RampShape, cfg.RampTime)
+    log.Println("Starting transmission...")
+
+    // Samples handed to the radio, for measuring the achieved sample rate
+    var txSampleCount atomic.Uint64
+
     // Buffer health monitoring
     go func() {
         ticker := time.NewTicker(5 * time.Second)
         defer ticker.Stop()
-        for range ticker.C {
-            available := (bufferWritePos - bufferReadPos + streamBufferSize) % streamBufferSize
-            fillPct := float64(available) * 100.0 / float64(streamBufferSize)
-            log.Printf("Buffer: %.1f%% full (%d samples), underflows: %d", fillPct, available, bufferUnderflows)
-            if fillPct < 10 {
+        lastCount, lastTime := txSampleCount.Load(), time.Now()
+        var underruns underrunWatch
+        for now := range ticker.C {
+            available := ring.Fill()
+            fillPct := float64(available) * 100.0 / float64(ring.Cap())
+
+            // USB contention shows up as the radio pulling fewer samples than configured
+            count := txSampleCount.Load()
+            rate := float64(count-lastCount) / now.Sub(lastTime).Seconds()
+            rateErr := (rate - consts.HackRFSampleRate) / consts.HackRFSampleRate
+            lastCount, lastTime = count, now
+
+            if !cfg.NoRadio && underruns.Update(ring.Underruns()) {
+                log.Printf("WARNING: Underflows for %d intervals in a row: %s", sustainedUnderrunIntervals, recommendForUnderruns(cfg.Taps, cfg.FPS, liveEncoder))
+                if cfg.Adaptive && liveEncoder && ffmpegSrc != nil {
+                    degradeEncoder(ffmpegSrc)
+                }
+            }
+
+            if utils.JSONLogs() {
+                slog.Info("buffer", "fill_pct", fillPct, "samples", available, "underflows", ring.Underruns(), "encoder_waits", ring.Overruns(), "sample_rate", rate, "latency_ms", latency.Last().Milliseconds())
+                if fillPct < 10 && !cfg.NoRadio {
+                    slog.Warn("buffer critically low", "fill_pct", fillPct)
+                }
+                if count > 0 && !cfg.NoRadio && math.Abs(rateErr) > sampleRateTolerance {
+                    slog.Warn("sample rate off nominal", "sample_rate", rate, "error_pct", rateErr*100)
+                }
+                if cfg.CheckFraming {
+                    slog.Info("framing", "errors", dvbsEncoder.FramingErrors())
+                }
+                if stalls, longest := dvbsEncoder.Stalls(); stalls > 0 || dvbsEncoder.Stalled() > 0 {
+                    slog.Info("input", "stalls", stalls, "longest_ms", longest.Milliseconds(), "stalled_ms", dvbsEncoder.Stalled().Milliseconds())
+                }
+                if errInjector != nil {
+                    slog.Info("inject-errors", "errors", errInjector.Injected(), "packets", errInjector.Packets())
+                }
+                if selfMon != nil && !math.IsNaN(selfMon.MER()) {
+                    slog.Info("self-monitor", "mer_db", selfMon.MER(), "evm_pct", selfMon.EVM())
+                }
+                if specMon != nil {
+                    if r, ok := specMon.Reading(); ok {
+                        slog.Info("spectrum", "bandwidth_hz", r.Bandwidth, "acpr_lower_db", r.Lower, "acpr_upper_db", r.Upper, "power_dbfs", r.Power)
+                    }
+                }
+                if dataIns != nil {
+                    slog.Info("data", "messages", dataIns.Messages(), "packets", dataIns.Packets(), "pid_clash", dataIns.Clash())
+                }
+                if latencyCap != nil {
+                    slog.Info("low-latency", "skips", latencyCap.Skips(), "skipped_ms", latencyCap.Skipped().Milliseconds())
+                }
+                if smoother != nil {
+                    slog.Info("smoother", "backlog", smoother.Backlog(), "padded", smoother.Padded(), "dropped", smoother.Dropped())
+                }
+                if cfg.RTP && udpIn != nil {
+                    slog.Info("rtp", "lost", udpIn.RTPLost(), "invalid", udpIn.RTPInvalid())
+                }
+                if bridge != nil {
+                    slog.Info("network", "gaps", bridge.Gaps(), "nulls", bridge.Nulls())
+                }
+                if tcpIn != nil {
+                    slog.Info("tcp", "reconnects", tcpIn.Reconnects())
+                }
+                if ffmpegSrc != nil && encOpts.Stream != "" {
+                    slog.Info("stream", "reconnects", ffmpegSrc.Reconnects())
+                }
+                continue
+            }
+            log.Printf("Buffer: %.1f%% full (%d samples), underflows: %d, encoder waits: %d, TX rate: %.3f Msps, latency: %v", fillPct, available, ring.Underruns(), ring.Overruns(), rate/1e6, latency.Last().Round(time.Millisecond))
+            if fillPct < 10 && !cfg.NoRadio {
                 log.Printf("WARNING: Buffer critically low!")
             }
+            if count > 0 && !cfg.NoRadio && math.Abs(rateErr) > sampleRateTolerance {
+                log.Printf("WARNING: Radio is consuming %.3f Msps, %+.1f%% off the configured %.3f Msps (USB bus starved?)", rate/1e6, rateErr*100, consts.HackRFSampleRate/1e6)
+            }
+            if cfg.CheckFraming {
+                log.Printf("Scrambler framing errors: %d", dvbsEncoder.FramingErrors())
+            }
+            if d := dvbsEncoder.Stalled(); d > 0 {
+                log.Printf("WARNING: TS input stalled, no packet for %v so far", d.Round(time.Millisecond))
+            }
+            if errInjector != nil {
+                log.Printf("Injected errors: %d in %d packets", errInjector.Injected(), errInjector.Packets())
+            }
+            if selfMon != nil && !math.IsNaN(selfMon.MER()) {
+                log.Printf("Self-monitor: MER %.1f dB, EVM %.2f%%", selfMon.MER(), selfMon.EVM())
+            }
+            if specMon != nil {
+                if r, ok := specMon.Reading(); ok {
+                    log.Printf("Spectrum: %.0f kHz wide at -3 dB, ACPR lower %.1f dB, upper %.1f dB, power %.1f dBFS", r.Bandwidth/1e3, r.Lower, r.Upper, r.Power)
+                }
+            }
+            if dataIns != nil {
+                log.Printf("Data: %d messages in %d packets", dataIns.Messages(), dataIns.Packets())
+                if dataIns.Clash() {
+                    log.Printf("WARNING: The stream already uses data PID %#x; no data is being sent (choose another -datapid)", cfg.DataPID)
+                }
+            }
+            if latencyCap != nil && latencyCap.Skips() > 0 {
+                log.Printf("Low latency: %d skips to a keyframe, %v of video dropped", latencyCap.Skips(), latencyCap.Skipped().Round(time.Millisecond))
+            }
+            if smoother != nil {
+                log.Printf("Smoother: %d packets queued, %d nulls padded, %d input nulls dropped", smoother.Backlog(), smoother.Padded(), smoother.Dropped())
+            }
+            if cfg.RTP && udpIn != nil {
+                log.Printf("RTP: %d packets lost, %d non-RTP datagrams dropped", udpIn.RTPLost(), udpIn.RTPInvalid())
+            }
+            if bridge != nil {
+                log.Printf("Network: %d gaps bridged with %d null packets", bridge.Gaps(), bridge.Nulls())
+            }
+            if tcpIn != nil {
+                log.Printf("TCP: %d reconnects", tcpIn.Reconnects())
+            }
+            if ffmpegSrc != nil && encOpts.Stream != "" {
+                log.Printf("Stream: %d reconnects", ffmpegSrc.Reconnects())
+            }
         }
     }()
 
     // Start transmission
     ctx, cancel := context.WithCancel(context.Background())
     defer cancel()
+    if selfMon != nil {
+        go selfMon.Run(ctx)
+    }
+    if specMon != nil {
+        go specMon.Run(ctx)
+    }
 
-    const digitalGain = 100.0  // Compromise between clipping and power
+    // Everything besides the radio that gets the packed transfers. With a
+    // radio pulling samples, a slow file or pipe loses transfers rather
+    // than hold the radio up; without one it holds the encoder back instead.
+    var iqSinks []iqSink
+    if sinks[sinkFile] {
+        f, err := os.Create(cfg.IQOut)
+        if err != nil {
+            utils.Fatalf("Failed to create -iqout file: %v", err)
+        }
+        defer f.Close()
+        q := newIQStreamSink("-iqout", f, !cfg.NoRadio)
+        defer q.Close()
+        iqSinks = append(iqSinks, q)
+        log.Printf("Writing transmitted I/Q to %s", cfg.IQOut)
+    }
+    if sinks[sinkStdout] {
+        q := newIQStreamSink("-sinks stdout", os.Stdout, !cfg.NoRadio)
+        defer q.Close()
+        iqSinks = append(iqSinks, q)
+        log.Println("Writing transmitted I/Q to stdout")
+    }
+    var recorder *iqRecorder
+    if cfg.RecordLast > 0 {
+        bytesPerSecond := consts.HackRFSampleRate * float64(format.BytesPerSample())
+        recorder, err = newIQRecorder(cfg.RecordDir, cfg.RecordLast, bytesPerSecond)
+        if err != nil {
+            utils.Fatalf("Failed to create -record-dir: %v", err)
+        }
+        defer recorder.Close()
+        iqSinks = append(iqSinks, recorder)
+        log.Printf("Recording the last %v of transmitted I/Q in %s (%.0f MB on disk)", cfg.RecordLast, cfg.RecordDir,
+            float64(int64(recorder.keep)*recorder.segmentBytes)/1e6)
+    }
+    if specMon != nil {
+        iqSinks = append(iqSinks, specMon)
+    }
+    if selfMon != nil {
+        iqSinks = append(iqSinks, selfMon)
+    }
 
-    err = dev.StartTX(func(buf []byte) error {
-        select {
-        case <-ctx.Done():
-            return errors.New("transfer cancelled")
-        default:
+    // Cleared by the control socket's stop command; the carrier follows
+    // through the key ramp, which also ramps it up at the start
+    var keyed atomic.Bool
+    keyed.Store(true)
+    keyRamp := newKeyRamp(rampShape, cfg.RampTime, consts.HackRFSampleRate)
+    if keyer != nil {
+        keyRamp.pos = keyRamp.samples // each burst already starts with a ramp
+    }
+
+    // fillTX fills one transfer buffer from the ring
+    var txSamples []complex64
+    var lastSample complex64
+    fillTX := func(buf []byte) {
+        samplesToWrite := len(buf) / format.BytesPerSample()
+        txSampleCount.Add(uint64(samplesToWrite))
+        if cap(txSamples) < samplesToWrite {
+            txSamples = make([]complex64, samplesToWrite)
+        }
+        txSamples = txSamples[:samplesToWrite]
+        n := ring.Read(txSamples)
+        latency.Check()
+        if n > 0 {
+            lastSample = txSamples[n-1]
         }
+        // Hold last sample on underflow instead of wrapping
+        for i := n; i < samplesToWrite; i++ {
+            txSamples[i] = lastSample
+        }
+        if keyer != nil {
+            keyer.Apply(txSamples)
+        }
+        keyRamp.Apply(txSamples, keyed.Load())
 
-        samplesToWrite := len(buf) / 2
-        for i := 0; i < samplesToWrite; i++ {
-            // Check if we're about to overtake the write position
-            if bufferReadPos == bufferWritePos {
-                bufferUnderflows++
-                // Hold last sample on underflow instead of wrapping
-                sample := sampleBuffer[(bufferReadPos-1+streamBufferSize)%streamBufferSize]
-                i_sample := int8(real(sample) * digitalGain)
-                q_sample := int8(imag(sample) * digitalGain)
-                buf[i*2] = byte(i_sample)
-                buf[i*2+1] = byte(q_sample)
-                continue
+        clipped := radio.PackIQ(buf, txSamples, format, level)
+        summary.Transfer(ring, clipped)
+        for _, s := range iqSinks {
+            s.Write(buf)
+        }
+    }
+
+    rc := &remoteControl{
+        dev:      dev,
+        freqMHz:  cfg.Freq,
+        freqPPM:  cfg.FreqCorrection,
+        gain:     cfg.Gain,
+        keyed:    &keyed,
+        ring:     ring,
+        latency:  latency,
+        sent:     &txSampleCount,
+        src:      ffmpegSrc,
+        maxVideo: maxVideo,
+        selfMon:  selfMon,
+    }
+    if cfg.Control != "" {
+        srv, err := control.Listen(cfg.Control)
+        if err != nil {
+            utils.Fatalf("Failed to open control socket: %v", err)
+        }
+        defer srv.Close()
+        rc.register(srv)
+        go srv.Serve()
+        log.Printf("Control socket listening on %s", srv.Addr())
+    }
+
+    if cfg.ConfigFile != "" {
+        reload := utils.NotifyReload()
+        go func() {
+            for range reload {
+                log.Printf("SIGHUP: reloading %s", cfg.ConfigFile)
+                config = reloadConfig(cfg.ConfigFile, flag.CommandLine, config, rc.applySetting)
             }
-            
-            sample := sampleBuffer[bufferReadPos]
-            i_sample := int8(real(sample) * digitalGain)
-            q_sample := int8(imag(sample) * digitalGain)
-            buf[i*2] = byte(i_sample)
-            buf[i*2+1] = byte(q_sample)
+        }()
+    }
+
+    signals := utils.NotifySignal()
+
+    // With -start-at the radio starts early by its start-up time and the key
+    // ramp, so the carrier is at full power at the scheduled instant
+    onAir := time.Now()
+    if !startAt.IsZero() {
+        keep := target
+        log.Printf("Scheduled: on air at %s, in %v; holding the stream until then", startAt.Format(time.RFC3339), time.Until(startAt).Round(time.Second))
+        if !holdUntil(startAt.Add(-txStartLead-cfg.RampTime), ring, keep, live, latency.Check, signals) {
+            log.Println("Stopped before the scheduled start.")
+            cancel()
+            if ffmpegSrc != nil {
+                ffmpegSrc.Kill()
+            }
+            return
+        }
+        onAir = startAt
+    }
+    // -duration ends with the key-down ramp; without it this never fires
+    var keyDown <-chan time.Time
+    if cfg.Duration > 0 {
+        keyDown = time.After(time.Until(onAir.Add(cfg.Duration - cfg.RampTime)))
+    }
+
+    if cfg.NoRadio {
+        // Stand in for the radio: drain whatever the encoder produces, as
+        // fast as it produces it, until the stream ends.
+        drained := make(chan struct{})
+        go func() {
+            defer close(drained)
+            buf := make([]byte, noRadioChunk*format.BytesPerSample())
+            for ctx.Err() == nil {
+                n := min(ring.Fill(), noRadioChunk)
+                if n == 0 {
+                    select {
+                    case <-encoderDone:
+                        if ring.Fill() == 0 {
+                            return
+                        }
+                    case <-time.After(time.Millisecond):
+                    }
+                    continue
+                }
+                fillTX(buf[:n*format.BytesPerSample()])
+            }
+        }()
+
+        log.Println("Encoding without radio. Press Ctrl+C to stop.")
+        select {
+        case <-signals:
+        case <-drained:
+            log.Println("Stream ended.")
+        case <-symFailed:
+        case <-keyDown:
+            log.Printf("Duration of %v reached.", cfg.Duration)
+        }
+        cancel()
+        <-drained
+        if symOut != nil {
+            symOut.Close()
+            log.Printf("Wrote %d symbols (%.1f s) to %s", symOut.Symbols(), float64(symOut.Symbols())/consts.SymbolRate, cfg.SymOut)
+        }
+        if ffmpegSrc != nil {
+            ffmpegSrc.Kill()
+        }
+        summary.Print(dvbsEncoder, ring, txSampleCount.Load())
+        return
+    }
 
-            bufferReadPos = (bufferReadPos + 1) % streamBufferSize
+    tx := radio.NewTransmitter(dev)
+    err = tx.Start(func(buf []byte) error {
+        select {
+        case <-ctx.Done():
+            return errors.New("transfer cancelled")
+        default:
         }
+        fillTX(buf)
         return nil
     })
 
     if err != nil {
         if err.Error() != "transfer cancelled" {
-            log.Fatalf("StartTX failed: %v", err)
+            utils.Fatalf("StartTX failed: %v", err)
         }
     }
+    txStarted.Store(true)
 
     log.Println("Transmission is live. Press Ctrl+C to stop.")
-    utils.WaitForSignal()
+    select {
+    case <-signals:
+    case <-streamDrained(encoderDone, ring):
+        log.Println("Stream ended.")
+    case <-keyDown:
+        log.Printf("Duration of %v reached, keying down.", cfg.Duration)
+        keyed.Store(false)
+        time.Sleep(cfg.RampTime + txStartLead) // the ramp, through the USB transfers
+    }
 
     log.Println("Stopping transmission...")
     cancel()
-    dev.StopTX()
-    ffmpegCmd.Process.Kill()
+    if err := tx.Stop(); err != nil {
+        log.Printf("WARNING: Failed to stop the radio cleanly: %v", err)
+    }
+    if ffmpegSrc != nil {
+        ffmpegSrc.Kill()
+    }
     log.Println("Transmission stopped.")
+    summary.Print(dvbsEncoder, ring, txSampleCount.Load())
+}
+
+// streamDrained closes the returned channel once the encoder has stopped
+// and the radio has taken everything it produced.
+func streamDrained(encoderDone <-chan struct{}, ring *iqring.Ring) <-chan struct{} {
+    drained := make(chan struct{})
+    go func() {
+        <-encoderDone
+        for ring.Fill() > 0 {
+            time.Sleep(10 * time.Millisecond)
+        }
+        close(drained)
+    }()
+    return drained
+}
+
+// ffmpegOptions holds the encoder settings for live and test-pattern sources.
+type ffmpegOptions struct {
+    Device       string
+    VideoSize    string
+    FPS          int
+    VideoBitrate string
+    MPEG2Profile string     // a key of mpeg2Profiles
+    MPEG2Level   mpeg2Level // from chooseMPEG2
+    AudioBitrate string
+    AudioCodec   string // mp2, aac or ac3
+    AudioRate    int    // Hz
+    Channels     int    // audio channels, 1 or 2
+    Muxrate      string
+    ColorBars    bool
+    AudioOnly    bool
+    Slideshow    string // FFmpeg concat playlist of still images
+    Caption      string // text file drawn over the color bars, for -testcard
+    InputFormat  string // V4L2 capture format; empty lets FFmpeg choose
+    Camera       string // rpicam-vid/libcamera-vid feeding H.264 on stdin instead of V4L2
+    Stream       string // rtmp:// or srt:// URL pulled and transcoded instead of a local capture
+}
+
+// audioCodecs maps -acodec values to FFmpeg encoders.
+var audioCodecs = map[string]string{
+    "mp2": "mp2",
+    "aac": "aac",
+    "ac3": "ac3",
+}
+
+// audioRates lists the sample rates each audio codec can encode.
+var audioRates = map[string][]int{
+    "mp2": {16000, 22050, 24000, 32000, 44100, 48000},
+    "aac": {8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000, 64000, 88200, 96000},
+    "ac3": {32000, 44100, 48000},
+}
+
+// checkAudioFormat rejects sample rates and channel counts the codec
+// cannot encode, which FFmpeg would otherwise fail on after startup.
+func checkAudioFormat(codec string, rate, channels int) error {
+    if channels != 1 && channels != 2 {
+        return fmt.Errorf("%d channels, must be 1 or 2", channels)
+    }
+    if !slices.Contains(audioRates[codec], rate) {
+        return fmt.Errorf("%s cannot encode at %d Hz (supported: %v)", codec, rate, audioRates[codec])
+    }
+    return nil
+}
+
+// alsaInput returns the arguments capturing from the default ALSA device at
+// the configured rate and channel count; without them FFmpeg opens it at
+// 48 kHz stereo, which mono-only devices refuse.
+func alsaInput(opts ffmpegOptions) []string {
+    return []string{
+        "-thread_queue_size", "512",
+        "-f", "alsa",
+        "-sample_rate", strconv.Itoa(opts.AudioRate),
+        "-channels", strconv.Itoa(opts.Channels),
+        "-i", "default",
+    }
 }
 
-func buildFFmpegCommand(device, videoSize string, fps int, videoBitrate, audioBitrate string, colorBars bool) *exec.Cmd {
-    if colorBars {
+// audioLayout is the lavfi channel_layout for the channel count.
+func audioLayout(channels int) string {
+    if channels == 1 {
+        return "mono"
+    }
+    return "stereo"
+}
+
+func buildFFmpegCommand(opts ffmpegOptions) *exec.Cmd {
+    var args []string
+
+    // Inputs
+    switch {
+    case opts.Stream != "":
+        // Network stream: whatever it carries is scaled and letterboxed to
+        // the output size and rate. The timeout makes FFmpeg give up on a
+        // silent server, so the source can reconnect.
+        args = append(args,
+            "-rw_timeout", strconv.FormatInt(streamStallTimeout.Microseconds(), 10),
+            "-i", opts.Stream,
+        )
+        if !opts.AudioOnly {
+            size := strings.Replace(opts.VideoSize, "x", ":", 1)
+            args = append(args,
+                "-vf", "scale="+size+":force_original_aspect_ratio=decrease,pad="+size+":(ow-iw)/2:(oh-ih)/2",
+                "-r", strconv.Itoa(opts.FPS),
+            )
+        }
+    case opts.ColorBars && opts.AudioOnly:
+        args = append(args, "-f", "lavfi", "-i", "sine=frequency=1000:sample_rate="+strconv.Itoa(opts.AudioRate))
+    case opts.AudioOnly:
+        args = append(args, alsaInput(opts)...)
+    case opts.Slideshow != "":
+        // Still images letterboxed to the output size, with silent audio
+        size := strings.Replace(opts.VideoSize, "x", ":", 1)
+        args = append(args,
+            "-stream_loop", "-1",
+            "-f", "concat",
+            "-safe", "0",
+            "-i", opts.Slideshow,
+            "-f", "lavfi",
+            "-i", "anullsrc=channel_layout="+audioLayout(opts.Channels)+":sample_rate="+strconv.Itoa(opts.AudioRate),
+            "-vf", "scale="+size+":force_original_aspect_ratio=decrease,pad="+size+":(ow-iw)/2:(oh-ih)/2,fps="+strconv.Itoa(opts.FPS),
+        )
+    case opts.ColorBars:
         // Use test pattern (SMPTE color bars)
-        args := []string{
+        args = append(args,
             "-f", "lavfi",
-            "-i", "smptebars=size=" + videoSize + ":rate=" + strconv.Itoa(fps),
+            "-i", "smptebars=size="+opts.VideoSize+":rate="+strconv.Itoa(opts.FPS),
             "-f", "lavfi",
-            "-i", "sine=frequency=1000:sample_rate=48000",
+            "-i", "sine=frequency=1000:sample_rate="+strconv.Itoa(opts.AudioRate),
+        )
+        if opts.Caption != "" {
+            args = append(args, "-vf", testCardFilter(opts.Caption, opts.VideoSize))
+        }
+    case opts.Camera != "":
+        // Raspberry Pi camera: H.264 from the libcamera app on stdin
+        args = append(args,
+            "-thread_queue_size", "512",
+            "-f", "h264",
+            "-framerate", strconv.Itoa(opts.FPS),
+            "-i", "pipe:0",
+        )
+        args = append(args, alsaInput(opts)...)
+        args = append(args, "-r", strconv.Itoa(opts.FPS))
+    default:
+        // Webcam: Settings matching working leandvbtx pipeline
+        args = append(args, "-thread_queue_size", "512", "-f", "v4l2")
+        if opts.InputFormat != "" {
+            args = append(args, "-input_format", opts.InputFormat)
+        }
+        args = append(args,
+            "-video_size", opts.VideoSize,
+            "-framerate", strconv.Itoa(opts.FPS),
+            "-i", opts.Device,
+        )
+        args = append(args, alsaInput(opts)...)
+        args = append(args, "-r", strconv.Itoa(opts.FPS)) // Force output framerate
+    }
+
+    // Video
+    if opts.AudioOnly {
+        args = append(args, "-vn")
+    } else {
+        args = append(args,
             "-c:v", "mpeg2video",
+            "-profile:v", strconv.Itoa(mpeg2Profiles[opts.MPEG2Profile]),
+            "-level", strconv.Itoa(opts.MPEG2Level.ffmpeg),
             "-pix_fmt", "yuv420p",
-            "-b:v", videoBitrate,
-            "-maxrate", videoBitrate,
-            "-bufsize", "1400k",
+            "-b:v", opts.VideoBitrate,
+            "-maxrate", opts.VideoBitrate,
+            "-bufsize", strconv.Itoa(min(mpeg2MaxBufsize, opts.MPEG2Level.vbv)),
             "-g", "10",
             "-bf", "0",
-            "-c:a", "mp2",
-            "-b:a", audioBitrate,
-            "-ar", "44100",
-            "-f", "mpegts",
-            "-muxrate", "1M",
-            "-pcr_period", "20",
-            "-",
-        }
-        return exec.Command("ffmpeg", args...)
+        )
     }
 
-    // Webcam: Settings matching working leandvbtx pipeline
-    args := []string{
-        "-thread_queue_size", "512",
-        "-f", "v4l2",
-        "-video_size", videoSize,
-        "-framerate", strconv.Itoa(fps),
-        "-i", device,
-        "-thread_queue_size", "512",
-        "-f", "alsa",
-        "-i", "default",
-        "-r", strconv.Itoa(fps), // Force output framerate
-        "-c:v", "mpeg2video",
-        "-pix_fmt", "yuv420p",
-        "-b:v", videoBitrate,
-        "-maxrate", videoBitrate,
-        "-bufsize", "1400k",
-        "-g", "10",
-        "-bf", "0",
-        "-c:a", "mp2",
-        "-b:a", audioBitrate,
-        "-ar", "44100",
-        "-f", "mpegts",
-        "-muxrate", "1M",
+    // Audio
+    args = append(args,
+        "-c:a", audioCodecs[opts.AudioCodec],
+        "-b:a", opts.AudioBitrate,
+        "-ar", strconv.Itoa(opts.AudioRate),
+        "-ac", strconv.Itoa(opts.Channels),
+    )
+
+    // Mux
+    args = append(args, "-f", "mpegts")
+    if opts.AudioOnly {
+        // Radio service: no video stream, the SDT marks the service as digital radio
+        args = append(args, "-mpegts_service_type", "digital_radio")
+    }
+    if opts.AudioCodec == "ac3" {
+        // DVB signals AC-3 as private data (0x06) with an AC-3 descriptor
+        // rather than the ATSC stream_type 0x81 FFmpeg uses by default.
+        args = append(args, "-mpegts_flags", "+system_b")
+    }
+    args = append(args,
+        "-muxrate", opts.Muxrate,
         "-pcr_period", "20",
         "-",
-    }
+    )
     return exec.Command("ffmpeg", args...)
 }
 
+// chooseRPiCamera resolves -input to the libcamera app to capture with, or
+// "" for V4L2.
+func chooseRPiCamera(input string) string {
+    switch input {
+    case "rpicam":
+        app, err := findRPiCamApp()
+        if err != nil {
+            utils.Fatalf("Invalid -input rpicam: %v", err)
+        }
+        return app
+    case "auto":
+        if app, ok := detectRPiCamera(); ok {
+            return app
+        }
+    }
+    return ""
+}
+
+// negotiatePixelFormat resolves -pixfmt against what the device reports.
+// With auto it picks mjpeg, then yuyv422, then whatever the device offers;
+// an explicit format the device lacks is fatal, since FFmpeg would only fail
+// later with "VIDIOC_STREAMON: Invalid argument".
+func negotiatePixelFormat(device, pixFmt, size string) string {
+    formats, err := probeV4L2Formats(device)
+    if err != nil {
+        if pixFmt == "auto" {
+            log.Printf("Could not query %s capture formats (%v); letting FFmpeg choose", device, err)
+            return ""
+        }
+        log.Printf("Could not query %s capture formats (%v); using -pixfmt %s unchecked", device, err, pixFmt)
+        return pixFmt
+    }
+    if pixFmt == "auto" {
+        chosen := choosePixelFormat(formats, size)
+        log.Printf("Capture format: %s (auto)", chosen)
+        return chosen
+    }
+    var supported []string
+    for _, f := range formats {
+        if f.PixFmt == pixFmt {
+            log.Printf("Capture format: %s", pixFmt)
+            return pixFmt
+        }
+        supported = append(supported, f.PixFmt)
+    }
+    utils.Fatalf("Invalid -pixfmt %q: %s supports %s", pixFmt, device, strings.Join(supported, ", "))
+    return ""
+}
+
 func buildFileCommand(filename string) *exec.Cmd {
     // Stream pre-recorded .ts file - no rate limiting, let buffer handle it
     args := []string{
@@ -285,3 +1415,199 @@ func buildFileCommand(filename string) *exec.Cmd {
     }
     return exec.Command("ffmpeg", args...)
 }
+
+// checkStreamURL checks that -rtmp or -srt names a host with one of the
+// protocol's schemes, rather than leaving FFmpeg to fail after startup.
+func checkStreamURL(raw string, schemes ...string) error {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return err
+    }
+    if !slices.Contains(schemes, u.Scheme) {
+        return fmt.Errorf("%q must start with %s://", raw, strings.Join(schemes, ":// or "))
+    }
+    if u.Host == "" {
+        return fmt.Errorf("%q names no host", raw)
+    }
+    return nil
+}
+
+// streamName describes a stream URL for the log without its path or
+// query, which for RTMP usually carry the stream key.
+func streamName(raw string) string {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return raw
+    }
+    return strings.ToUpper(u.Scheme) + " (" + u.Host + ")"
+}
+
+// readPlaylist reads one file name per line, skipping blank lines and
+// # comments. Relative names are taken relative to the list itself.
+func readPlaylist(path string) ([]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var paths []string
+    for _, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        if !filepath.IsAbs(line) {
+            line = filepath.Join(filepath.Dir(path), line)
+        }
+        paths = append(paths, line)
+    }
+    if len(paths) == 0 {
+        return nil, fmt.Errorf("%s lists no files", path)
+    }
+    return paths, nil
+}
+
+// parseConvGenerators parses "171,133": the X and Y generators in octal.
+func parseConvGenerators(spec string) (g1, g2 byte, err error) {
+    x, y, ok := strings.Cut(spec, ",")
+    if !ok {
+        return 0, 0, fmt.Errorf("expected two octal generators, e.g. 171,133, got %q", spec)
+    }
+    var g [2]byte
+    for i, s := range []string{x, y} {
+        v, err := strconv.ParseUint(strings.TrimSpace(s), 8, 8)
+        if err != nil {
+            return 0, 0, fmt.Errorf("generator %q is not an octal byte", s)
+        }
+        g[i] = byte(v)
+    }
+    return g[0], g[1], nil
+}
+
+// defaultPilotPattern alternates two opposite points of the constellation,
+// 64 symbols in all. That puts its energy at the band edges, marking the
+// signal's width, and mirroring the spectrum (swapping I and Q) gives the
+// same again.
+const defaultPilotPattern = "03*32"
+
+// parsePilotPattern parses -pilot-pattern: QPSK symbols as digits 0-3,
+// optionally followed by *N to repeat them N times (e.g. 03*32).
+func parsePilotPattern(spec string) ([]byte, error) {
+    digits, repeat, found := strings.Cut(strings.TrimSpace(spec), "*")
+    n := 1
+    if found {
+        var err error
+        if n, err = strconv.Atoi(repeat); err != nil || n < 1 {
+            return nil, fmt.Errorf("%q: the repeat count after * must be a positive number", spec)
+        }
+    }
+    if digits == "" || len(digits)*n > dvbs.MaxPilotSymbols {
+        return nil, fmt.Errorf("%q: must be 1-%d symbols", spec, dvbs.MaxPilotSymbols)
+    }
+    var pattern []byte
+    for _, d := range digits {
+        if d < '0' || d > '3' {
+            return nil, fmt.Errorf("%q: symbols are the digits 0-3", spec)
+        }
+        pattern = append(pattern, byte(d-'0'))
+    }
+    return bytes.Repeat(pattern, n), nil
+}
+
+// errorStages are the -inject-errors stage names.
+var errorStages = map[string]dvbs.Stage{
+    "rs":         dvbs.StageReedSolomon,
+    "interleave": dvbs.StageInterleave,
+    "conv":       dvbs.StageConvolutional,
+}
+
+// parseErrorInjection parses "rs:8/packet", a fixed number of byte errors in
+// every packet after the named stage, or "conv:1e-4", a random error rate
+// per byte (rs, interleave) or coded bit (conv).
+func parseErrorInjection(spec string) (*dvbs.ErrorInjector, error) {
+    name, amount, ok := strings.Cut(spec, ":")
+    stage, known := errorStages[strings.TrimSpace(name)]
+    if !ok || !known {
+        return nil, fmt.Errorf("expected rs, interleave or conv, a colon and a count or rate, e.g. rs:8/packet or conv:1e-4, got %q", spec)
+    }
+    amount = strings.TrimSpace(amount)
+    if count, ok := strings.CutSuffix(amount, "/packet"); ok {
+        n, err := strconv.Atoi(count)
+        if err != nil {
+            return nil, fmt.Errorf("count %q is not a whole number", count)
+        }
+        return dvbs.NewErrorInjector(stage, n, 0)
+    }
+    rate, err := strconv.ParseFloat(amount, 64)
+    if err != nil {
+        return nil, fmt.Errorf("rate %q is not a number", amount)
+    }
+    return dvbs.NewErrorInjector(stage, 0, rate)
+}
+
+// parseStreamTypes parses "0x24", a stream_type for the stream carrying the
+// PCR, or "0x100=0x24,0x101=0x0f", stream_types for given PIDs. Numbers
+// may be hex (0x) or decimal.
+func parseStreamTypes(spec string) (map[uint16]byte, error) {
+    types := make(map[uint16]byte)
+    for _, part := range strings.Split(spec, ",") {
+        pidStr, typeStr, hasPID := strings.Cut(strings.TrimSpace(part), "=")
+        if !hasPID {
+            typeStr = pidStr
+        }
+        t, err := strconv.ParseUint(typeStr, 0, 8)
+        if err != nil {
+            return nil, fmt.Errorf("stream type %q is not a byte", typeStr)
+        }
+        pid := uint64(ts.PCRStream)
+        if hasPID {
+            if pid, err = strconv.ParseUint(pidStr, 0, 13); err != nil {
+                return nil, fmt.Errorf("PID %q is not a 13-bit number", pidStr)
+            }
+        }
+        types[uint16(pid)] = byte(t)
+    }
+    return types, nil
+}
+
+// clipFreeLevel returns the highest level PackIQ can be given without any
+// symbol sequence clipping: full scale divided by the largest component the
+// constellation (phase offset included) can reach through the filter. With
+// the default 41 taps that is about 112 of 127 counts.
+func clipFreeLevel(enc *dvbs.DVBSEncoder, rrc *filter.FIRFilter) float32 {
+    var component float64
+    for _, p := range enc.Constellation() {
+        component = math.Max(component, math.Max(math.Abs(float64(real(p))), math.Abs(float64(imag(p)))))
+    }
+    // Shaved by 0.001 dB, as float32 rounding in the filter's sums can land
+    // the exact peak a hair past full scale
+    return float32(1 / (component * rrc.PeakGain()) * clipFreeMargin)
+}
+
+// customTapsWarnings lists what looks wrong about -taps-file's filter for
+// DVB-S pulse shaping, which it is still allowed to be.
+func customTapsWarnings(f *filter.FIRFilter) []string {
+    var warnings []string
+    n, sps := len(f.Taps), f.UpsampleFactor
+    if n%2 == 0 {
+        warnings = append(warnings, fmt.Sprintf("%d taps is an even count, so the pulse centre falls between two samples", n))
+    }
+    if !f.Symmetric() {
+        warnings = append(warnings, "the taps are not symmetric, so the filter's phase is not linear and a receiver's matched filter will not undo it")
+    }
+    if span := filter.Span(n, sps); span < filter.MinSpanSymbols {
+        warnings = append(warnings, fmt.Sprintf("%d taps span only %.1f symbols at %d samples/symbol; the built-in filters need at least %d", n, span, sps, filter.MinSpanSymbols))
+    }
+    if n > maxCustomTaps {
+        warnings = append(warnings, fmt.Sprintf("%d taps is a lot of work per sample; check -benchmark keeps up", n))
+    }
+    return warnings
+}
+
+// requireDebugOverride refuses to go on air with a debug-only option unless
+// the operator has explicitly accepted transmitting an invalid signal.
+func requireDebugOverride(allowed bool, what string) {
+    if !allowed {
+        utils.Fatalf("DEBUG: %s produces a non-standard signal; refusing to transmit without -allow-invalid-signal", what)
+    }
+    log.Printf("WARNING: DEBUG mode, %s. The transmitted signal is NOT valid DVB-S!", what)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// -mpeg2-level's default, the lowest level the picture size and frame rate
+// fit
+const mpeg2LevelAuto = "auto"
+
+// mpeg2Profiles maps -mpeg2-profile values to FFmpeg's mpeg2video
+// -profile:v numbers. All are 4:2:0; simple is main without B-frames,
+// which the live encoder never uses anyway.
+var mpeg2Profiles = map[string]int{
+	"simple": 5,
+	"main":   4,
+	"high":   1,
+}
+
+// mpeg2Level is one MPEG-2 level's limits (ISO/IEC 13818-2 tables 8-10
+// and 8-12, Main Profile figures) and FFmpeg's -level number for it.
+// Bitrates are not checked: every level allows far more than a DVB-S
+// channel at this symbol rate carries.
+type mpeg2Level struct {
+	name          string
+	ffmpeg        int
+	width, height int
+	fps           int
+	lumaRate      int // luma samples/s
+	vbv           int // bits
+}
+
+// mpeg2Levels in ascending order
+var mpeg2Levels = []mpeg2Level{
+	{"low", 10, 352, 288, 30, 3041280, 475136},
+	{"main", 8, 720, 576, 30, 10368000, 1835008},
+	{"high-1440", 6, 1440, 1152, 60, 47001600, 7340032},
+	{"high", 4, 1920, 1152, 60, 62668800, 9781248},
+}
+
+// Most VBV buffer the live encoder asks for, less if the level allows less
+const mpeg2MaxBufsize = 1400000
+
+// parseVideoSize parses -size, WIDTHxHEIGHT.
+func parseVideoSize(s string) (width, height int, err error) {
+	w, h, ok := strings.Cut(s, "x")
+	width, werr := strconv.Atoi(w)
+	height, herr := strconv.Atoi(h)
+	if !ok || werr != nil || herr != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("%q: must be WIDTHxHEIGHT, e.g. 640x480", s)
+	}
+	return width, height, nil
+}
+
+// fits reports why a picture size and frame rate exceed the level, or ""
+// if they fit.
+func (l mpeg2Level) fits(width, height, fps int) string {
+	switch {
+	case width > l.width || height > l.height:
+		return fmt.Sprintf("%dx%d is larger than its %dx%d", width, height, l.width, l.height)
+	case fps > l.fps:
+		return fmt.Sprintf("%d fps is more than its %d", fps, l.fps)
+	case width*height*fps > l.lumaRate:
+		return fmt.Sprintf("%dx%d at %d fps is more than its %d samples/s", width, height, fps, l.lumaRate)
+	}
+	return ""
+}
+
+// chooseMPEG2 resolves -mpeg2-profile and -mpeg2-level for a picture size
+// and frame rate: auto becomes the lowest level they fit, and a given
+// level, or one the profile does not have, is refused if they do not.
+func chooseMPEG2(profile, level string, width, height, fps int) (mpeg2Level, error) {
+	if _, ok := mpeg2Profiles[profile]; !ok {
+		return mpeg2Level{}, fmt.Errorf("-mpeg2-profile %q: must be simple, main or high", profile)
+	}
+	for _, l := range mpeg2Levels {
+		if level == mpeg2LevelAuto {
+			// Simple has only the main level, and high no low level
+			if l.fits(width, height, fps) != "" || (profile == "simple" && l.name != "main") || (profile == "high" && l.name == "low") {
+				continue
+			}
+			return l, nil
+		}
+		if l.name != level {
+			continue
+		}
+		if (profile == "simple" && l.name != "main") || (profile == "high" && l.name == "low") {
+			return mpeg2Level{}, fmt.Errorf("-mpeg2-level %s: the %s profile has no such level", level, profile)
+		}
+		if why := l.fits(width, height, fps); why != "" {
+			return mpeg2Level{}, fmt.Errorf("-mpeg2-level %s: %s; lower -size or -fps, or raise the level", level, why)
+		}
+		return l, nil
+	}
+	if level == mpeg2LevelAuto {
+		return mpeg2Level{}, fmt.Errorf("-size %dx%d at %d fps fits no level of the MPEG-2 %s profile", width, height, fps, profile)
+	}
+	return mpeg2Level{}, fmt.Errorf("-mpeg2-level %q: must be auto, low, main, high-1440 or high", level)
+}
+
+// mpeg2Name returns the usual shorthand for a profile and level, e.g.
+// MP@ML.
+func mpeg2Name(profile string, level mpeg2Level) string {
+	p := map[string]string{"simple": "SP", "main": "MP", "high": "HP"}[profile]
+	l := map[string]string{"low": "LL", "main": "ML", "high-1440": "H-14", "high": "HL"}[level.name]
+	return p + "@" + l
+}
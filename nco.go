@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"hackdvbs/dvbs"
+)
+
+// ncoShifter is a dvbs.SampleWriter that moves the signal off DC by
+// multiplying it with a complex oscillator, so the HackRF's LO leakage at
+// the centre frequency falls outside the occupied band.
+type ncoShifter struct {
+	out dvbs.SampleWriter
+	rot *rotator
+	buf []complex64
+}
+
+// rotator is a complex oscillator that turns samples by a fixed phase
+// more with each one, moving the signal by offset Hz.
+type rotator struct {
+	rot  complex128
+	step complex128
+}
+
+func newRotator(offset, sampleRate float64) *rotator {
+	phi := 2 * math.Pi * offset / sampleRate
+	return &rotator{rot: 1, step: complex(math.Cos(phi), math.Sin(phi))}
+}
+
+// Rotate multiplies samples by the oscillator in place, carrying its
+// phase on to the next call.
+func (r *rotator) Rotate(samples []complex64) {
+	for i, s := range samples {
+		samples[i] = complex64(complex128(s) * r.rot)
+		r.rot *= r.step
+	}
+	// Keep the phasor on the unit circle despite rounding
+	r.rot /= complex(math.Hypot(real(r.rot), imag(r.rot)), 0)
+}
+
+// checkIFOffset checks that a signal occupying the given bandwidth, shifted
+// by offset, stays inside both the sample band and the baseband filter.
+func checkIFOffset(offset, occupied, sampleRate, filterBW float64) error {
+	limit := math.Min(sampleRate, filterBW)/2 - occupied/2
+	if math.Abs(offset) > limit {
+		return fmt.Errorf("%.0f Hz would push the %.2f MHz wide signal past the band edge; keep it within ±%.0f Hz", offset, occupied/1e6, limit)
+	}
+	return nil
+}
+
+func newNCOShifter(out dvbs.SampleWriter, offset, sampleRate float64) *ncoShifter {
+	return &ncoShifter{out: out, rot: newRotator(offset, sampleRate)}
+}
+
+// WriteAll implements dvbs.SampleWriter.
+func (n *ncoShifter) WriteAll(samples []complex64) {
+	if cap(n.buf) < len(samples) {
+		n.buf = make([]complex64, len(samples))
+	}
+	out := n.buf[:len(samples)]
+	copy(out, samples)
+	n.rot.Rotate(out)
+	n.out.WriteAll(out)
+}
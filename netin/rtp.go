@@ -0,0 +1,57 @@
+package netin
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	rtpHeaderSize = 12
+	rtpVersion    = 2
+)
+
+var errNotRTP = errors.New("not an RTP packet")
+
+// rtpDepacketizer strips RTP headers (RFC 3550) from TS-over-RTP datagrams
+// (RFC 2250) and uses the sequence number to count lost datagrams.
+type rtpDepacketizer struct {
+	started bool
+	nextSeq uint16
+	lost    uint64
+}
+
+// payload returns the TS payload of an RTP packet, skipping the CSRC list,
+// any header extension and any padding.
+func (d *rtpDepacketizer) payload(pkt []byte) ([]byte, error) {
+	if len(pkt) < rtpHeaderSize || pkt[0]>>6 != rtpVersion {
+		return nil, errNotRTP
+	}
+	hdr := rtpHeaderSize + int(pkt[0]&0x0F)*4
+	if pkt[0]&0x10 != 0 {
+		if len(pkt) < hdr+4 {
+			return nil, errNotRTP
+		}
+		hdr += 4 + int(binary.BigEndian.Uint16(pkt[hdr+2:]))*4
+	}
+	end := len(pkt)
+	if pkt[0]&0x20 != 0 && end > 0 {
+		end -= int(pkt[end-1])
+	}
+	if hdr > end {
+		return nil, errNotRTP
+	}
+
+	seq := binary.BigEndian.Uint16(pkt[2:])
+	if d.started {
+		// Gaps are counted as loss; a packet from the past (reordering or
+		// a duplicate) is passed on without touching the count.
+		if gap := seq - d.nextSeq; gap < 0x8000 {
+			d.lost += uint64(gap)
+		} else {
+			return pkt[hdr:end], nil
+		}
+	}
+	d.started = true
+	d.nextSeq = seq + 1
+	return pkt[hdr:end], nil
+}
@@ -0,0 +1,114 @@
+package netin
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// A connection that delivers nothing for this long is taken as dead
+	// even if the peer never closed it (a dropped link, a crashed host).
+	tcpStallTimeout = 5 * time.Second
+
+	// Reconnection attempts back off from the first delay up to the last.
+	minRedialDelay = 500 * time.Millisecond
+	maxRedialDelay = 5 * time.Second
+)
+
+// TCPReader reads a TS stream from a TCP server, such as
+// "ffmpeg ... -f mpegts tcp://0.0.0.0:5000?listen", and reconnects
+// transparently whenever the connection drops. Read blocks while it is
+// reconnecting; the stream picks up wherever the server is when it comes
+// back, so the packets in flight are lost and the next one may start part
+// way through.
+type TCPReader struct {
+	addr string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+
+	reconnects atomic.Uint64
+}
+
+// DialTCP connects to addr, e.g. "192.168.1.10:5000". Only the first
+// connection must succeed; later ones are retried until Close.
+func DialTCP(addr string) (*TCPReader, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", addr, err)
+	}
+	return &TCPReader{addr: addr, conn: conn}, nil
+}
+
+// Read implements io.Reader.
+func (t *TCPReader) Read(p []byte) (int, error) {
+	for {
+		t.mu.Lock()
+		conn, closed := t.conn, t.closed
+		t.mu.Unlock()
+		if closed {
+			return 0, net.ErrClosed
+		}
+		conn.SetReadDeadline(time.Now().Add(tcpStallTimeout))
+		n, err := conn.Read(p)
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		t.mu.Lock()
+		closed = t.closed
+		t.mu.Unlock()
+		if closed {
+			return 0, net.ErrClosed
+		}
+		log.Printf("Network input: lost %s (%v), reconnecting", t.addr, err)
+		if err := t.redial(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// redial replaces the connection, retrying until it succeeds or the reader
+// is closed.
+func (t *TCPReader) redial() error {
+	delay := minRedialDelay
+	for {
+		conn, err := net.DialTimeout("tcp", t.addr, maxRedialDelay)
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			if conn != nil {
+				conn.Close()
+			}
+			return net.ErrClosed
+		}
+		if err == nil {
+			t.conn.Close()
+			t.conn = conn
+			t.mu.Unlock()
+			t.reconnects.Add(1)
+			log.Printf("Network input: reconnected to %s", t.addr)
+			return nil
+		}
+		t.mu.Unlock()
+		time.Sleep(delay)
+		delay = min(2*delay, maxRedialDelay)
+	}
+}
+
+// Reconnects returns the number of times the connection has been re-established.
+func (t *TCPReader) Reconnects() uint64 {
+	return t.reconnects.Load()
+}
+
+// Close closes the connection and stops any reconnection.
+func (t *TCPReader) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return t.conn.Close()
+}
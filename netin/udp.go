@@ -0,0 +1,102 @@
+// Package netin receives MPEG-TS over the network for transmission.
+package netin
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+const (
+	// Large enough for a jumbo datagram; TS over UDP is normally 7 packets (1316 bytes).
+	maxDatagram = 65536
+	// Kernel receive buffer, to ride out scheduling hiccups at high bitrates.
+	readBufferSize = 4 * 1024 * 1024
+)
+
+// UDPReader presents a stream of TS-over-UDP (or TS-over-RTP) datagrams as
+// an io.Reader. Unicast and multicast groups on IPv4 and IPv6 are supported.
+type UDPReader struct {
+	conn    *net.UDPConn
+	rtp     *rtpDepacketizer
+	buf     []byte
+	pending []byte
+
+	rtpLost    atomic.Uint64
+	rtpInvalid atomic.Uint64
+}
+
+// ListenUDP binds to addr, e.g. ":5000", "239.1.1.1:5000" or "[ff05::1]:5000".
+// Multicast groups are joined on the named interface, or the system default
+// when iface is empty. With rtp set, the RTP header is stripped from each
+// datagram and its sequence number is checked for lost packets.
+func ListenUDP(addr, iface string, rtp bool) (*UDPReader, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", addr, err)
+	}
+
+	var ifi *net.Interface
+	if iface != "" {
+		if ifi, err = net.InterfaceByName(iface); err != nil {
+			return nil, fmt.Errorf("interface %s: %w", iface, err)
+		}
+	}
+
+	var conn *net.UDPConn
+	if udpAddr.IP != nil && udpAddr.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp", ifi, udpAddr)
+	} else {
+		conn, err = net.ListenUDP("udp", udpAddr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", addr, err)
+	}
+	conn.SetReadBuffer(readBufferSize)
+
+	u := &UDPReader{
+		conn: conn,
+		buf:  make([]byte, maxDatagram),
+	}
+	if rtp {
+		u.rtp = &rtpDepacketizer{}
+	}
+	return u, nil
+}
+
+// Read implements io.Reader.
+func (u *UDPReader) Read(p []byte) (int, error) {
+	for len(u.pending) == 0 {
+		n, _, err := u.conn.ReadFromUDP(u.buf)
+		if err != nil {
+			return 0, err
+		}
+		payload := u.buf[:n]
+		if u.rtp != nil {
+			if payload, err = u.rtp.payload(payload); err != nil {
+				u.rtpInvalid.Add(1)
+				continue
+			}
+			u.rtpLost.Store(u.rtp.lost)
+		}
+		u.pending = payload
+	}
+	n := copy(p, u.pending)
+	u.pending = u.pending[n:]
+	return n, nil
+}
+
+// RTPLost returns the number of RTP packets missing from the sequence.
+func (u *UDPReader) RTPLost() uint64 {
+	return u.rtpLost.Load()
+}
+
+// RTPInvalid returns the number of datagrams dropped for not being RTP.
+func (u *UDPReader) RTPInvalid() uint64 {
+	return u.rtpInvalid.Load()
+}
+
+// Close stops listening (and leaves any multicast group).
+func (u *UDPReader) Close() error {
+	return u.conn.Close()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"hackdvbs/consts"
+	"hackdvbs/iqring"
+)
+
+const (
+	// -prefill's default, which picks the prefill from how the source behaves
+	prefillAuto = "auto"
+
+	// How long -prefill auto watches the source fill the buffer, from its
+	// first sample, and how often it looks
+	prefillObserve  = 3 * time.Second
+	prefillInterval = 50 * time.Millisecond
+
+	// -prefill auto keeps this many times the worst shortfall it saw, as a
+	// few seconds are a small sample of the source's jitter
+	prefillMargin = 2
+
+	// Least prefill -prefill auto chooses, for the radio's first transfers
+	// and scheduling hiccups; and the most, as a fraction of the buffer,
+	// leaving room above for the source's bursts
+	minAutoPrefill     = 250 * time.Millisecond
+	maxPrefillFraction = 0.75
+)
+
+// bufferLen is how long the sample buffer lasts at the radio's rate.
+var bufferLen = time.Duration(streamBufferSize / consts.HackRFSampleRate * float64(time.Second))
+
+// parsePrefill parses -prefill: "auto", or a duration of samples to buffer
+// before transmitting, up to what the buffer holds. auto is true for
+// "auto".
+func parsePrefill(s string) (d time.Duration, auto bool, err error) {
+	if strings.TrimSpace(s) == prefillAuto {
+		return 0, true, nil
+	}
+	d, err = time.ParseDuration(s)
+	if err != nil || d <= 0 || d > bufferLen {
+		return 0, false, fmt.Errorf("%q: must be auto or a duration up to %.1fs, the buffer's length", s, bufferLen.Seconds())
+	}
+	return d, false, nil
+}
+
+// sourceReading is what observeSource saw of the source.
+type sourceReading struct {
+	Observed  time.Duration
+	Shortfall int     // samples: the furthest the source fell behind the radio
+	Rate      float64 // the source's average rate, as a fraction of the radio's
+	Outpaced  bool    // the buffer filled before prefillObserve was up
+}
+
+// observeSource watches the buffer fill, without draining it, for up to
+// prefillObserve from the first sample, and measures the source against a
+// radio taking sampleRate samples/s from that moment: the furthest it falls
+// behind, having been ahead, is the buffer the radio would have drawn on.
+// Watching stops early once the buffer is maxPrefillFraction full, as a
+// source that fast needs little. ok is false if the encoder stops first.
+func observeSource(ring *iqring.Ring, sampleRate float64, encoderDone <-chan struct{}) (r sourceReading, ok bool) {
+	ticker := time.NewTicker(prefillInterval)
+	defer ticker.Stop()
+	var start, last time.Time // first sample, and the latest to arrive
+	var first, prev uint64
+	var lead float64 // samples the source is ahead of the radio, at best so far
+	for {
+		select {
+		case <-encoderDone:
+			return r, false
+		case <-ticker.C:
+		}
+		written := ring.Written()
+		if start.IsZero() {
+			if written > 0 {
+				start, first, prev = time.Now(), written, written
+			}
+			continue
+		}
+		r.Observed = time.Since(start)
+		drained := r.Observed.Seconds() * sampleRate
+		ahead := float64(written-first) - drained
+		lead = max(lead, ahead)
+		r.Shortfall = max(r.Shortfall, int(lead-ahead))
+		// The rate is taken up to the latest arrival, not now, so that a
+		// source writing in bursts is not judged mid-gap
+		if written != prev {
+			prev, last = written, time.Now()
+		}
+		if span := last.Sub(start).Seconds(); span > 0 {
+			r.Rate = float64(written-first) / (span * sampleRate)
+		}
+		if r.Observed >= prefillObserve {
+			return r, true
+		}
+		if ring.Fill() >= int(maxPrefillFraction*float64(ring.Cap())) {
+			r.Outpaced = true
+			return r, true
+		}
+	}
+}
+
+// autoPrefill returns the prefill in samples for a source reading:
+// prefillMargin times the shortfall, within minAutoPrefill and
+// maxPrefillFraction of the buffer.
+func autoPrefill(r sourceReading, capacity int, sampleRate float64) int {
+	target := max(prefillMargin*r.Shortfall, int(minAutoPrefill.Seconds()*sampleRate))
+	return min(target, int(maxPrefillFraction*float64(capacity)))
+}
+
+// discardExcess drops the oldest samples beyond keep, as the radio would
+// have taken them, calling consumed after each read.
+func discardExcess(ring *iqring.Ring, keep int, scratch []complex64, consumed func()) {
+	for excess := ring.Fill() - keep; excess > 0; excess -= len(scratch) {
+		ring.Read(scratch[:min(excess, len(scratch))])
+		consumed()
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/samuel/go-hackrf/hackrf"
+)
+
+// Oldest firmware release without known TX streaming problems.
+const minFirmwareVersion = "2021.03.1"
+
+// HackRF family sample rate limits. Below the minimum the MAX5864 and the
+// baseband filter misbehave; above the maximum USB 2.0 cannot keep up.
+const (
+	minBoardSampleRate = 2e6
+	maxBoardSampleRate = 20e6
+)
+
+// probeHackRF logs the board, firmware and library versions and warns about
+// combinations known to misbehave.
+func probeHackRF(dev *hackrf.Device, sampleRate float64) {
+	log.Printf("libhackrf: %s (%s)", hackrf.LibraryVersion(), hackrf.LibraryRelease())
+
+	// hackrf.Open() takes the first device, so the first list entry is ours.
+	if devices, err := hackrf.DeviceList(); err == nil && len(devices) > 0 {
+		info := devices[0]
+		log.Printf("Board: %s, serial %s", info.USBBoardID, info.SerialNumber)
+		if info.USBBoardID != hackrf.USBBoardIDHackRFOne {
+			log.Printf("WARNING: %s is not a HackRF One; amp and sample rate behaviour may differ", info.USBBoardID)
+		}
+	}
+
+	fw, err := dev.Version()
+	if err != nil {
+		log.Printf("WARNING: Could not read firmware version: %v", err)
+	} else {
+		log.Printf("Firmware: %s", fw)
+		if older, ok := versionOlder(fw, minFirmwareVersion); !ok {
+			log.Printf("Firmware %q is not a release build; cannot check it against %s", fw, minFirmwareVersion)
+		} else if older {
+			log.Printf("WARNING: Firmware %s is older than %s; please update with hackrf_spiflash", fw, minFirmwareVersion)
+		}
+	}
+
+	if sampleRate < minBoardSampleRate || sampleRate > maxBoardSampleRate {
+		log.Printf("WARNING: Sample rate %.2f Msps is outside the supported %.0f-%.0f Msps range",
+			sampleRate/1e6, minBoardSampleRate/1e6, maxBoardSampleRate/1e6)
+	}
+}
+
+// versionOlder compares YYYY.MM.N release versions. ok is false if either
+// string is not a release version (e.g. a git build).
+func versionOlder(v, min string) (older, ok bool) {
+	a, errA := parseVersion(v)
+	b, errB := parseVersion(min)
+	if errA != nil || errB != nil {
+		return false, false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i], true
+		}
+	}
+	return false, true
+}
+
+func parseVersion(v string) ([3]int, error) {
+	var out [3]int
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(v), "v"), ".")
+	if len(parts) != 3 {
+		return out, fmt.Errorf("not a release version: %q", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return out, err
+		}
+		out[i] = n
+	}
+	return out, nil
+}
@@ -0,0 +1,23 @@
+package radio
+
+// Device is a transmitter the modulated stream can be handed to.
+type Device interface {
+	// Format is the sample format StartTX's buffers are in.
+	Format() SampleFormat
+
+	// SetFreq tunes to hz, within FreqRange.
+	SetFreq(hz uint64) error
+	FreqRange() (min, max uint64)
+
+	// SetGain sets the transmit gain in dB, within GainRange.
+	SetGain(db int) error
+	GainRange() (min, max int)
+
+	// StartTX starts transmitting, calling fill from the driver's own
+	// goroutine for every buffer it needs, until fill returns an error or
+	// StopTX is called. It returns once the stream is running.
+	StartTX(fill func(buf []byte) error) error
+	StopTX() error
+
+	Close() error
+}
@@ -0,0 +1,137 @@
+// Package radio holds what the transmit path needs to know about the SDR it
+// feeds, independent of any particular driver.
+package radio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// SampleFormat is the I/Q wire format a radio backend consumes.
+type SampleFormat int
+
+const (
+	Int8  SampleFormat = iota // interleaved signed 8-bit (HackRF)
+	Int16                     // interleaved signed 16-bit little endian (Pluto, most 12-bit radios)
+	CF32                      // interleaved float32 little endian, full scale 1.0
+)
+
+var formatNames = map[SampleFormat]string{
+	Int8:  "int8",
+	Int16: "int16",
+	CF32:  "cf32",
+}
+
+func (f SampleFormat) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("SampleFormat(%d)", int(f))
+}
+
+// ParseSampleFormat parses "int8", "int16" or "cf32".
+func ParseSampleFormat(s string) (SampleFormat, error) {
+	for f, name := range formatNames {
+		if name == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sample format %q (want int8, int16 or cf32)", s)
+}
+
+// BytesPerSample returns the size of one complex sample.
+func (f SampleFormat) BytesPerSample() int {
+	switch f {
+	case Int16:
+		return 4
+	case CF32:
+		return 8
+	}
+	return 2
+}
+
+// fullScale is the largest magnitude each component can take.
+func (f SampleFormat) fullScale() float32 {
+	switch f {
+	case Int16:
+		return math.MaxInt16
+	case CF32:
+		return 1
+	}
+	return math.MaxInt8
+}
+
+// PackIQ converts samples to the wire format in dst, which must hold
+// len(samples)*f.BytesPerSample() bytes. level is the amplitude, as a
+// fraction of full scale, that a unit sample maps to; the integer formats
+// clip rather than wrap anything beyond full scale. It returns the number
+// of samples with either component clipped.
+func PackIQ(dst []byte, samples []complex64, f SampleFormat, level float32) (clipped int) {
+	scale := level * f.fullScale()
+	switch f {
+	case Int8:
+		for i, s := range samples {
+			re, ci := clip(real(s)*scale, math.MaxInt8)
+			im, cq := clip(imag(s)*scale, math.MaxInt8)
+			dst[2*i] = byte(int8(re))
+			dst[2*i+1] = byte(int8(im))
+			if ci || cq {
+				clipped++
+			}
+		}
+	case Int16:
+		for i, s := range samples {
+			re, ci := clip(real(s)*scale, math.MaxInt16)
+			im, cq := clip(imag(s)*scale, math.MaxInt16)
+			binary.LittleEndian.PutUint16(dst[4*i:], uint16(int16(re)))
+			binary.LittleEndian.PutUint16(dst[4*i+2:], uint16(int16(im)))
+			if ci || cq {
+				clipped++
+			}
+		}
+	case CF32:
+		for i, s := range samples {
+			binary.LittleEndian.PutUint32(dst[8*i:], math.Float32bits(real(s)*scale))
+			binary.LittleEndian.PutUint32(dst[8*i+4:], math.Float32bits(imag(s)*scale))
+		}
+	}
+	return clipped
+}
+
+// UnpackIQ undoes PackIQ at the same level, converting wire format samples
+// in src to dst. It returns the number of samples converted, which is
+// limited by whichever of dst and src is shorter.
+func UnpackIQ(dst []complex64, src []byte, f SampleFormat, level float32) int {
+	n := min(len(dst), len(src)/f.BytesPerSample())
+	scale := 1 / (level * f.fullScale())
+	switch f {
+	case Int8:
+		for i := range dst[:n] {
+			dst[i] = complex(float32(int8(src[2*i]))*scale, float32(int8(src[2*i+1]))*scale)
+		}
+	case Int16:
+		for i := range dst[:n] {
+			re := int16(binary.LittleEndian.Uint16(src[4*i:]))
+			im := int16(binary.LittleEndian.Uint16(src[4*i+2:]))
+			dst[i] = complex(float32(re)*scale, float32(im)*scale)
+		}
+	case CF32:
+		for i := range dst[:n] {
+			re := math.Float32frombits(binary.LittleEndian.Uint32(src[8*i:]))
+			im := math.Float32frombits(binary.LittleEndian.Uint32(src[8*i+4:]))
+			dst[i] = complex(re*scale, im*scale)
+		}
+	}
+	return n
+}
+
+func clip(v, limit float32) (float32, bool) {
+	if v > limit {
+		return limit, true
+	}
+	if v < -limit {
+		return -limit, true
+	}
+	return v, false
+}
@@ -0,0 +1,183 @@
+//go:build soapy
+
+package radio
+
+/*
+#cgo LDFLAGS: -lSoapySDR
+#include <stdlib.h>
+#include <SoapySDR/Device.h>
+#include <SoapySDR/Errors.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"unsafe"
+)
+
+// How long one writeStream call may wait for the driver, in microseconds
+const soapyTimeoutUs = 100000
+
+// soapy transmits complex float samples on channel 0 of a SoapySDR device.
+type soapy struct {
+	dev    *C.SoapySDRDevice
+	stream *C.SoapySDRStream
+	mtu    int // samples per fill
+
+	// Allocated in C, as the driver is handed pointers into them
+	buf   unsafe.Pointer
+	buffs unsafe.Pointer // one-channel array of buffer pointers
+
+	gainMin, gainMax int
+	freqMin, freqMax uint64 // Hz
+
+	stop atomic.Bool
+	done chan struct{}
+}
+
+// OpenSoapy opens the SoapySDR device matching args (such as "driver=lime"),
+// configured for transmitting at sampleRate and freqHz with gain dB.
+// bandwidth is the analog filter to ask for; drivers without one ignore it.
+// It needs SoapySDR 0.8 or later.
+func OpenSoapy(args string, sampleRate, bandwidth, freqHz float64, gain int) (Device, error) {
+	cargs := C.CString(args)
+	defer C.free(unsafe.Pointer(cargs))
+	dev := C.SoapySDRDevice_makeStrArgs(cargs)
+	if dev == nil {
+		return nil, fmt.Errorf("SoapySDR device %q: %s", args, C.GoString(C.SoapySDRDevice_lastError()))
+	}
+	s := &soapy{dev: dev}
+	r := C.SoapySDRDevice_getGainRange(dev, C.SOAPY_SDR_TX, 0)
+	s.gainMin = int(math.Ceil(float64(r.minimum)))
+	s.gainMax = int(math.Floor(float64(r.maximum)))
+	s.freqMin, s.freqMax = freqRange(dev)
+
+	C.SoapySDRDevice_setBandwidth(dev, C.SOAPY_SDR_TX, 0, C.double(bandwidth))
+	err := soapyErr("set sample rate", C.SoapySDRDevice_setSampleRate(dev, C.SOAPY_SDR_TX, 0, C.double(sampleRate)))
+	if err == nil {
+		err = s.SetFreq(uint64(freqHz))
+	}
+	if err == nil {
+		err = s.SetGain(gain)
+	}
+	if err == nil {
+		format := C.CString("CF32")
+		defer C.free(unsafe.Pointer(format))
+		if s.stream = C.SoapySDRDevice_setupStream(dev, C.SOAPY_SDR_TX, format, nil, 0, nil); s.stream == nil {
+			err = fmt.Errorf("SoapySDR: set up TX stream: %s", C.GoString(C.SoapySDRDevice_lastError()))
+		}
+	}
+	if err != nil {
+		C.SoapySDRDevice_unmake(dev)
+		return nil, err
+	}
+
+	s.mtu = int(C.SoapySDRDevice_getStreamMTU(dev, s.stream))
+	s.buf = C.malloc(C.size_t(s.mtu * CF32.BytesPerSample()))
+	s.buffs = C.malloc(C.size_t(unsafe.Sizeof(s.buf)))
+	return s, nil
+}
+
+func soapyErr(what string, ret C.int) error {
+	if ret != 0 {
+		return fmt.Errorf("SoapySDR: %s: %s", what, C.GoString(C.SoapySDR_errToStr(ret)))
+	}
+	return nil
+}
+
+func (s *soapy) Format() SampleFormat {
+	return CF32
+}
+
+// freqRange returns the lowest and highest TX frequency across the
+// device's tuning ranges, or no limit if it reports none.
+func freqRange(dev *C.SoapySDRDevice) (lo, hi uint64) {
+	var n C.size_t
+	ranges := C.SoapySDRDevice_getFrequencyRange(dev, C.SOAPY_SDR_TX, 0, &n)
+	if ranges == nil || n == 0 {
+		return 0, math.MaxUint64
+	}
+	defer C.free(unsafe.Pointer(ranges))
+	lo = math.MaxUint64
+	for _, r := range unsafe.Slice(ranges, n) {
+		lo = min(lo, uint64(math.Ceil(float64(r.minimum))))
+		hi = max(hi, uint64(math.Floor(float64(r.maximum))))
+	}
+	return lo, hi
+}
+
+func (s *soapy) SetFreq(hz uint64) error {
+	if hz < s.freqMin || hz > s.freqMax {
+		return fmt.Errorf("frequency must be %.3f-%.3f MHz on this device", float64(s.freqMin)/1e6, float64(s.freqMax)/1e6)
+	}
+	return soapyErr("set frequency", C.SoapySDRDevice_setFrequency(s.dev, C.SOAPY_SDR_TX, 0, C.double(hz), nil))
+}
+
+func (s *soapy) SetGain(db int) error {
+	if db < s.gainMin || db > s.gainMax {
+		return fmt.Errorf("gain must be %d-%d dB on this device", s.gainMin, s.gainMax)
+	}
+	return soapyErr("set gain", C.SoapySDRDevice_setGain(s.dev, C.SOAPY_SDR_TX, 0, C.double(db)))
+}
+
+func (s *soapy) GainRange() (min, max int) {
+	return s.gainMin, s.gainMax
+}
+
+func (s *soapy) FreqRange() (min, max uint64) {
+	return s.freqMin, s.freqMax
+}
+
+// StartTX runs the stream from a goroutine of its own, as SoapySDR is
+// blocking where libhackrf calls back.
+func (s *soapy) StartTX(fill func(buf []byte) error) error {
+	if err := soapyErr("activate stream", C.SoapySDRDevice_activateStream(s.dev, s.stream, 0, 0, 0)); err != nil {
+		return err
+	}
+	s.stop.Store(false)
+	s.done = make(chan struct{})
+	buf := unsafe.Slice((*byte)(s.buf), s.mtu*CF32.BytesPerSample())
+	go func() {
+		defer close(s.done)
+		for !s.stop.Load() {
+			if fill(buf) != nil {
+				return
+			}
+			for sent := 0; sent < s.mtu && !s.stop.Load(); {
+				*(*unsafe.Pointer)(s.buffs) = unsafe.Add(s.buf, sent*CF32.BytesPerSample())
+				var flags C.int
+				n := C.SoapySDRDevice_writeStream(s.dev, s.stream, (*unsafe.Pointer)(s.buffs),
+					C.size_t(s.mtu-sent), &flags, 0, soapyTimeoutUs)
+				switch {
+				case n >= 0:
+					sent += int(n)
+				case n == C.SOAPY_SDR_TIMEOUT, n == C.SOAPY_SDR_UNDERFLOW:
+					// Transient; try the rest again
+				default:
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *soapy) StopTX() error {
+	if s.done == nil {
+		return nil
+	}
+	s.stop.Store(true)
+	<-s.done
+	s.done = nil
+	return soapyErr("deactivate stream", C.SoapySDRDevice_deactivateStream(s.dev, s.stream, 0, 0))
+}
+
+func (s *soapy) Close() error {
+	s.StopTX()
+	C.SoapySDRDevice_closeStream(s.dev, s.stream)
+	C.free(s.buf)
+	C.free(s.buffs)
+	return soapyErr("close device", C.SoapySDRDevice_unmake(s.dev))
+}
@@ -0,0 +1,10 @@
+//go:build !soapy
+
+package radio
+
+import "errors"
+
+// OpenSoapy opens a SoapySDR device. This build has no SoapySDR support.
+func OpenSoapy(args string, sampleRate, bandwidth, freqHz float64, gain int) (Device, error) {
+	return nil, errors.New("built without SoapySDR support (rebuild with -tags soapy)")
+}
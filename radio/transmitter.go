@@ -0,0 +1,85 @@
+package radio
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// TXState is where a Transmitter is in its lifecycle.
+type TXState int32
+
+const (
+	Idle TXState = iota
+	Starting
+	Running
+	Stopping
+)
+
+var txStateNames = [...]string{"idle", "starting", "running", "stopping"}
+
+func (s TXState) String() string {
+	if int(s) < len(txStateNames) {
+		return txStateNames[s]
+	}
+	return fmt.Sprintf("TXState(%d)", int(s))
+}
+
+// Transmitter runs a Device's TX stream through an idle, starting, running,
+// stopping lifecycle that is safe to drive from any number of goroutines.
+// Transitions are serialised, Start while running and Stop while idle do
+// nothing, and the device never sees two StartTX calls without a StopTX
+// between them.
+type Transmitter struct {
+	dev   Device
+	mu    sync.Mutex // held for the whole of each transition
+	state atomic.Int32
+}
+
+// NewTransmitter wraps dev, which must not be streaming.
+func NewTransmitter(dev Device) *Transmitter {
+	return &Transmitter{dev: dev}
+}
+
+// Start starts the stream with fill (see Device.StartTX) unless it is
+// already running, in which case fill is not used. If the device fails to
+// start the Transmitter stays idle.
+func (t *Transmitter) Start(fill func(buf []byte) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.State() == Running {
+		return nil
+	}
+	t.state.Store(int32(Starting))
+	if err := t.dev.StartTX(fill); err != nil {
+		t.state.Store(int32(Idle))
+		return err
+	}
+	t.state.Store(int32(Running))
+	return nil
+}
+
+// Stop stops the stream if it is running. Once it returns nil, the fill
+// function given to Start is no longer called. If the device fails to stop
+// it may still be streaming, so the Transmitter stays running and Stop can
+// be tried again.
+func (t *Transmitter) Stop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.State() != Running {
+		return nil
+	}
+	t.state.Store(int32(Stopping))
+	if err := t.dev.StopTX(); err != nil {
+		t.state.Store(int32(Running))
+		return err
+	}
+	t.state.Store(int32(Idle))
+	return nil
+}
+
+// State returns the current state, for reporting. It may be out of date by
+// the time it is acted on; call Start or Stop rather than checking first.
+func (t *Transmitter) State() TXState {
+	return TXState(t.state.Load())
+}
@@ -0,0 +1,189 @@
+package radio
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Goroutines and calls each in the start/stop storm
+const (
+	stormGoroutines = 16
+	stormCalls      = 200
+
+	// How long the fake device takes to start or stop, as a real driver's
+	// USB round trips do; it opens the window for overlapping calls
+	fakeSettle = 20 * time.Microsecond
+)
+
+// TestTransmitterStorm drives a Transmitter over a fake device from many
+// goroutines calling Start and Stop at random. The device must never be
+// started twice or stopped while idle, fill must not be called once Stop
+// has returned, and no stream goroutine may be left running. Run it under
+// -race.
+func TestTransmitterStorm(t *testing.T) {
+	dev := &fakeDevice{}
+	tx := NewTransmitter(dev)
+	fill := func([]byte) error {
+		dev.fills.Add(1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < stormGoroutines; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < stormCalls; i++ {
+				if rng.Intn(2) == 0 {
+					tx.Start(fill)
+				} else {
+					tx.Stop()
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	if err := tx.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := dev.violations.Load(); v > 0 {
+		t.Errorf("%d overlapping or unmatched device start/stop calls", v)
+	}
+	if tx.State() != Idle || dev.active.Load() != 0 {
+		t.Errorf("%s after the final Stop, %d streams still active", tx.State(), dev.active.Load())
+	}
+	fills := dev.fills.Load()
+	time.Sleep(time.Millisecond)
+	if dev.fills.Load() != fills {
+		t.Error("fill called after Stop returned")
+	}
+	if dev.starts.Load() == 0 {
+		t.Error("the device was never started")
+	}
+}
+
+func TestTransmitterIdempotent(t *testing.T) {
+	dev := &fakeDevice{}
+	tx := NewTransmitter(dev)
+	fill := func([]byte) error { return nil }
+	if err := tx.Stop(); err != nil || tx.State() != Idle {
+		t.Fatalf("Stop before Start: %v, %s", err, tx.State())
+	}
+	for i := 0; i < 2; i++ {
+		if err := tx.Start(fill); err != nil || tx.State() != Running {
+			t.Fatalf("Start %d: %v, %s", i+1, err, tx.State())
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := tx.Stop(); err != nil || tx.State() != Idle {
+			t.Fatalf("Stop %d: %v, %s", i+1, err, tx.State())
+		}
+	}
+	if dev.starts.Load() != 1 || dev.violations.Load() != 0 {
+		t.Errorf("device started %d times with %d violations, want once and none", dev.starts.Load(), dev.violations.Load())
+	}
+}
+
+// A device that fails to stop may still be streaming, so the Transmitter
+// must not report idle, and a second Stop must reach the device.
+func TestTransmitterStopFails(t *testing.T) {
+	dev := &fakeDevice{}
+	tx := NewTransmitter(dev)
+	if err := tx.Start(func([]byte) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	dev.failStop.Store(true)
+	if err := tx.Stop(); err == nil {
+		t.Fatal("Stop hid the device's error")
+	}
+	if s := tx.State(); s != Running {
+		t.Fatalf("%s after a failed Stop, want running", s)
+	}
+	dev.failStop.Store(false)
+	if err := tx.Stop(); err != nil || tx.State() != Idle {
+		t.Fatalf("Stop after the device recovered: %v, %s", err, tx.State())
+	}
+}
+
+// A device that fails to start leaves the Transmitter idle.
+func TestTransmitterStartFails(t *testing.T) {
+	dev := &fakeDevice{}
+	dev.active.Store(1) // already streaming, behind the Transmitter's back
+	tx := NewTransmitter(dev)
+	if err := tx.Start(func([]byte) error { return nil }); err == nil {
+		t.Fatal("Start hid the device's error")
+	}
+	if s := tx.State(); s != Idle {
+		t.Fatalf("%s after a failed Start, want idle", s)
+	}
+}
+
+// fakeDevice streams by calling fill from a goroutine until stopped, and
+// counts calls that break the start/stop pairing a real driver relies on.
+type fakeDevice struct {
+	active     atomic.Int32
+	starts     atomic.Int32
+	violations atomic.Int32
+	fills      atomic.Int64
+	failStop   atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (d *fakeDevice) Format() SampleFormat         { return Int8 }
+func (d *fakeDevice) SetFreq(uint64) error         { return nil }
+func (d *fakeDevice) SetGain(int) error            { return nil }
+func (d *fakeDevice) GainRange() (min, max int)    { return 0, 0 }
+func (d *fakeDevice) FreqRange() (min, max uint64) { return 0, math.MaxUint64 }
+func (d *fakeDevice) Close() error                 { return nil }
+
+func (d *fakeDevice) StartTX(fill func(buf []byte) error) error {
+	if d.active.Add(1) != 1 {
+		d.active.Add(-1)
+		d.violations.Add(1)
+		return errors.New("already streaming")
+	}
+	time.Sleep(fakeSettle)
+	d.starts.Add(1)
+	d.stop, d.done = make(chan struct{}), make(chan struct{})
+	stop, done := d.stop, d.done
+	go func() {
+		defer close(done)
+		buf := make([]byte, 64)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if fill(buf) != nil {
+				return
+			}
+			time.Sleep(10 * time.Microsecond)
+		}
+	}()
+	return nil
+}
+
+func (d *fakeDevice) StopTX() error {
+	if d.failStop.Load() {
+		return errors.New("USB transfer cancel failed")
+	}
+	if d.active.Load() != 1 {
+		d.violations.Add(1)
+		return errors.New("not streaming")
+	}
+	close(d.stop)
+	<-d.done
+	time.Sleep(fakeSettle)
+	d.active.Add(-1)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Depth the exponential ramp starts from: it rises linearly in dB, which
+// is what an amplifier's own gain control does, so it needs a floor.
+const exponentialRampDepth = 40.0 // dB
+
+// rampShapes maps -ramp-shape values to key-up envelopes over [0,1]; key-down
+// runs the same envelope backwards.
+var rampShapes = map[string]func(x float64) float32{
+	"linear":        linearRamp,
+	"raised-cosine": raisedCosine,
+	"exponential":   exponentialRamp,
+}
+
+// parseRampShape looks up a -ramp-shape value.
+func parseRampShape(name string) (func(float64) float32, error) {
+	if shape, ok := rampShapes[name]; ok {
+		return shape, nil
+	}
+	names := make([]string, 0, len(rampShapes))
+	for n := range rampShapes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown ramp shape %q (want %s)", name, strings.Join(names, ", "))
+}
+
+func linearRamp(x float64) float32 {
+	return float32(x)
+}
+
+// raisedCosine maps x in [0,1] onto a smooth 0..1 ramp.
+func raisedCosine(x float64) float32 {
+	return float32(0.5 - 0.5*math.Cos(math.Pi*x))
+}
+
+// exponentialRamp rises linearly in dB from -exponentialRampDepth to 0.
+func exponentialRamp(x float64) float32 {
+	if x <= 0 {
+		return 0
+	}
+	return float32(math.Pow(10, (x-1)*exponentialRampDepth/20))
+}
+
+// keyRamp keys the carrier up and down smoothly: each call moves the
+// envelope towards on or off by at most one ramp's worth of samples. It
+// starts keyed off, so the first transfer ramps the carrier up.
+type keyRamp struct {
+	shape   func(float64) float32
+	samples int64
+	pos     int64 // 0 (off) .. samples (fully on)
+}
+
+func newKeyRamp(shape func(float64) float32, d time.Duration, sampleRate float64) *keyRamp {
+	return &keyRamp{shape: shape, samples: max(1, int64(d.Seconds()*sampleRate))}
+}
+
+// Apply scales samples by the envelope, ramping towards on if keyed.
+func (r *keyRamp) Apply(samples []complex64, keyed bool) {
+	if keyed && r.pos == r.samples {
+		return
+	}
+	for i := range samples {
+		if keyed {
+			r.pos = min(r.pos+1, r.samples)
+		} else {
+			r.pos = max(r.pos-1, 0)
+		}
+		samples[i] *= complex(r.shape(float64(r.pos)/float64(r.samples)), 0)
+	}
+}
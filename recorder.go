@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Length of each file in the -record-last ring
+const recordSegment = 5 * time.Second
+
+// iqRecorder keeps the last stretch of transmitted I/Q on disk as a ring
+// of segment files, named by the time they start, for reviewing what went
+// out after the fact. The TX callback hands it copies of the packed
+// transfers through an iqQueue, so a slow disk costs recording, never
+// samples.
+type iqRecorder struct {
+	*iqQueue
+
+	dir          string
+	segmentBytes int64
+	keep         int
+
+	files   []string // oldest first
+	f       *os.File
+	w       *bufio.Writer
+	written int64
+}
+
+// newIQRecorder records into dir, keeping enough segments to cover last at
+// bytesPerSecond.
+func newIQRecorder(dir string, last time.Duration, bytesPerSecond float64) (*iqRecorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	r := &iqRecorder{
+		dir:          dir,
+		segmentBytes: int64(recordSegment.Seconds() * bytesPerSecond),
+		// One more than covers last, as the newest is still being written
+		keep: int((last+recordSegment-1)/recordSegment) + 1,
+	}
+	r.iqQueue = newIQQueue("-record-last", true, r.write, r.finish)
+	return r, nil
+}
+
+// finish closes the current segment.
+func (r *iqRecorder) finish() {
+	if r.f != nil {
+		r.w.Flush()
+		r.f.Close()
+	}
+}
+
+func (r *iqRecorder) write(b []byte) error {
+	if r.f == nil || r.written >= r.segmentBytes {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.w.Write(b)
+	r.written += int64(n)
+	return err
+}
+
+// rotate closes the current segment, starts the next and deletes the
+// segments that have fallen out of the window.
+func (r *iqRecorder) rotate() error {
+	if r.f != nil {
+		if err := r.w.Flush(); err != nil {
+			return err
+		}
+		if err := r.f.Close(); err != nil {
+			return err
+		}
+	}
+	name := filepath.Join(r.dir, fmt.Sprintf("tx-%s.iq", time.Now().Format("20060102-150405.000")))
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	r.f, r.written = f, 0
+	if r.w == nil {
+		r.w = bufio.NewWriterSize(f, 1<<20)
+	} else {
+		r.w.Reset(f)
+	}
+	r.files = append(r.files, name)
+	for len(r.files) > r.keep {
+		os.Remove(r.files[0])
+		r.files = r.files[1:]
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"hackdvbs/consts"
+	"hackdvbs/control"
+	"hackdvbs/iqring"
+	"hackdvbs/radio"
+	"hackdvbs/utils"
+)
+
+// HackRF tuning and TX VGA gain limits
+const (
+	minFreqMHz = 1.0
+	maxFreqMHz = 6000.0
+	maxTXGain  = 47
+)
+
+// remoteControl is the running transmitter as seen by the control socket
+// and by config reloads. mu serialises the two, so freq and gain need no
+// other lock.
+type remoteControl struct {
+	mu sync.Mutex
+
+	dev     radio.Device // nil with -no-radio
+	freqMHz float64
+	freqPPM float64 // -freq-correction, applied on every retune
+	gain    int
+	keyed   *atomic.Bool // false while stopped: the stream runs on, the carrier is off
+
+	ring    *iqring.Ring
+	latency *latencyProbe
+	sent    *atomic.Uint64 // samples handed to the radio
+
+	src      *ffmpegSource // nil unless the TS comes from FFmpeg
+	maxVideo float64       // video bitrate ceiling in bits/s
+
+	selfMon *selfMonitor // nil without -self-monitor
+}
+
+func (rc *remoteControl) register(s *control.Server) {
+	s.Handle("freq", "freq <MHz>: retune", rc.locked(rc.setFreq))
+	s.Handle("gain", "gain <dB>: set the TX gain (0-47 on a HackRF)", rc.locked(rc.setGain))
+	s.Handle("stop", "stop: key the carrier off, keeping the stream running", rc.stop)
+	s.Handle("start", "start: key the carrier back on", rc.start)
+	s.Handle("vbitrate", "vbitrate <rate>: restart the encoder at a new video bitrate", rc.locked(rc.setVideoBitrate))
+	s.Handle("stats", "stats: report settings and buffer state", rc.locked(rc.stats))
+}
+
+func (rc *remoteControl) locked(h control.Handler) control.Handler {
+	return func(args []string) (string, error) {
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		return h(args)
+	}
+}
+
+// applySetting applies a changed config file setting on SIGHUP.
+func (rc *remoteControl) applySetting(name, val string) error {
+	var h control.Handler
+	switch name {
+	case "freq":
+		h = rc.setFreq
+	case "gain":
+		h = rc.setGain
+	case "vbitrate":
+		h = rc.setVideoBitrate
+	case "quiet":
+		q, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		utils.SetQuiet(q)
+		return nil
+	default:
+		return fmt.Errorf("%s cannot be changed while running", name)
+	}
+	_, err := rc.locked(h)([]string{val})
+	return err
+}
+
+func (rc *remoteControl) setFreq(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: freq <MHz>")
+	}
+	mhz, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || mhz <= 0 {
+		return "", errors.New("frequency must be a positive number of MHz")
+	}
+	if rc.dev == nil {
+		return "", errors.New("no radio (-no-radio)")
+	}
+	// The device refuses anything outside its own tuning range
+	if err := rc.dev.SetFreq(correctFreq(mhz*1_000_000, rc.freqPPM)); err != nil {
+		return "", err
+	}
+	rc.freqMHz = mhz
+	log.Printf("Control: retuned to %.2f MHz", mhz)
+	return "", nil
+}
+
+func (rc *remoteControl) setGain(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: gain <dB>")
+	}
+	if rc.dev == nil {
+		return "", errors.New("no radio (-no-radio)")
+	}
+	lo, hi := rc.dev.GainRange()
+	db, err := strconv.Atoi(args[0])
+	if err != nil || db < lo || db > hi {
+		return "", fmt.Errorf("gain must be an integer %d-%d", lo, hi)
+	}
+	if err := rc.dev.SetGain(db); err != nil {
+		return "", err
+	}
+	rc.gain = db
+	log.Printf("Control: TX gain set to %d dB", db)
+	return "", nil
+}
+
+func (rc *remoteControl) stop([]string) (string, error) {
+	if rc.keyed.Swap(false) {
+		log.Println("Control: carrier off")
+	}
+	return "", nil
+}
+
+func (rc *remoteControl) start([]string) (string, error) {
+	if !rc.keyed.Swap(true) {
+		log.Println("Control: carrier on")
+	}
+	return "", nil
+}
+
+func (rc *remoteControl) setVideoBitrate(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: vbitrate <rate>")
+	}
+	if rc.src == nil || !rc.src.live {
+		return "", errors.New("the video bitrate is fixed for this source")
+	}
+	bps, err := utils.ParseBitrate(args[0])
+	if err != nil {
+		return "", err
+	}
+	if bps < minVideoBitrate || bps > rc.maxVideo {
+		return "", fmt.Errorf("video bitrate must be %.0fk-%.0fk to fit the mux", minVideoBitrate/1000, math.Floor(rc.maxVideo/1000))
+	}
+	return "", rc.src.SetVideoBitrate(args[0])
+}
+
+func (rc *remoteControl) stats([]string) (string, error) {
+	fill := float64(rc.ring.Fill()) * 100 / float64(rc.ring.Cap())
+	result := fmt.Sprintf("freq_mhz=%.2f gain_db=%d keyed=%t fill_pct=%.1f underflows=%d encoder_waits=%d latency_ms=%d airtime_s=%.1f",
+		rc.freqMHz, rc.gain, rc.keyed.Load(), fill, rc.ring.Underruns(), rc.ring.Overruns(),
+		rc.latency.Last().Milliseconds(), float64(rc.sent.Load())/consts.HackRFSampleRate)
+	if rc.src != nil && rc.src.live {
+		result += " vbitrate=" + rc.src.VideoBitrate()
+	}
+	if rc.selfMon != nil && !math.IsNaN(rc.selfMon.MER()) {
+		result += fmt.Sprintf(" monitor_mer_db=%.1f monitor_evm_pct=%.2f", rc.selfMon.MER(), rc.selfMon.EVM())
+	}
+	return result, nil
+}
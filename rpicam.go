@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Apps that drive a Raspberry Pi camera through libcamera, newest name
+// first (libcamera-vid was renamed rpicam-vid in Raspberry Pi OS Bookworm).
+var rpicamApps = []string{"rpicam-vid", "libcamera-vid"}
+
+// The camera's H.264 is only an intermediate hop into the MPEG-2 encoder,
+// so it is sent at a rate high enough to add no visible loss.
+const rpicamBitrate = "8000000"
+
+var rpicamCameraRe = regexp.MustCompile(`(?m)^\s*(\d+) : (\S+)`)
+
+// findRPiCamApp returns the path of the installed libcamera video app.
+func findRPiCamApp() (string, error) {
+	for _, name := range rpicamApps {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("neither %s found (install rpicam-apps)", strings.Join(rpicamApps, " nor "))
+}
+
+// listRPiCameras returns the cameras app reports, as "index : sensor".
+func listRPiCameras(app string) []string {
+	out, _ := exec.Command(app, "--list-cameras").CombinedOutput()
+	var cameras []string
+	for _, m := range rpicamCameraRe.FindAllStringSubmatch(string(out), -1) {
+		cameras = append(cameras, m[1]+" : "+m[2])
+	}
+	return cameras
+}
+
+// detectRPiCamera returns the libcamera app to capture with if one is
+// installed and reports at least one camera.
+func detectRPiCamera() (string, bool) {
+	app, err := findRPiCamApp()
+	if err != nil {
+		return "", false
+	}
+	return app, len(listRPiCameras(app)) > 0
+}
+
+// buildCameraCommand builds the libcamera capture feeding FFmpeg's stdin
+// with H.264. A numeric -device selects the camera index; anything else
+// (such as the default /dev/video0) uses the first camera.
+func buildCameraCommand(opts ffmpegOptions) *exec.Cmd {
+	width, height, _ := strings.Cut(opts.VideoSize, "x")
+	args := []string{
+		"-t", "0", // run until killed
+		"-n", // no preview window
+		"--width", width,
+		"--height", height,
+		"--framerate", strconv.Itoa(opts.FPS),
+		"--codec", "h264",
+		"--inline", // repeat SPS/PPS so FFmpeg can start on any keyframe
+		"--bitrate", rpicamBitrate,
+		"--flush",
+		"-o", "-",
+	}
+	if _, err := strconv.Atoi(opts.Device); err == nil {
+		args = append(args, "--camera", opts.Device)
+	}
+	return exec.Command(opts.Camera, args...)
+}
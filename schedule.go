@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"hackdvbs/iqring"
+)
+
+const (
+	// How far ahead of the carrier the radio is started: libhackrf's
+	// start-up and its first USB transfers
+	txStartLead = 100 * time.Millisecond
+
+	// How often holdUntil trims the buffer while waiting
+	holdInterval = 10 * time.Millisecond
+
+	// Least time -start-at must leave for opening the radio, starting the
+	// source and filling the buffer
+	minStartLead = 10 * time.Second
+)
+
+// holdUntil waits until at without transmitting. A live source carries on
+// in real time meanwhile, the oldest samples beyond keep being discarded,
+// so it never backs up and the buffer holds the latest content when
+// transmission starts. Anything else waits in the full buffer, so a file
+// still starts from the top. It returns false if a signal arrives first.
+func holdUntil(at time.Time, ring *iqring.Ring, keep int, live bool, consumed func(), signals <-chan os.Signal) bool {
+	scratch := make([]complex64, noRadioChunk)
+	start := time.NewTimer(time.Until(at))
+	defer start.Stop()
+	var trim <-chan time.Time // never ready unless live
+	if live {
+		ticker := time.NewTicker(holdInterval)
+		defer ticker.Stop()
+		trim = ticker.C
+	}
+	for {
+		select {
+		case <-signals:
+			return false
+		case <-start.C:
+			return true
+		case <-trim:
+		}
+		discardExcess(ring, keep, scratch, consumed)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"hackdvbs/consts"
+	"hackdvbs/radio"
+)
+
+const (
+	// Samples demodulated per -self-monitor measurement (16 ms at 2 Msps)
+	selfMonitorSamples = 1 << 15
+
+	// Interval between -self-monitor measurements
+	selfMonitorInterval = 2 * time.Second
+
+	// Mean power, relative to a unit sample, below which a snapshot is
+	// taken to be the carrier keyed off and not measured
+	selfMonitorMinPower = 0.01
+)
+
+// iqSnapshot grabs a stretch of what is handed to the radio, unpacked from
+// its wire format, whenever a measuring goroutine asks for one. Between
+// requests Write does nothing, so the TX callback pays for a copy only
+// while a snapshot is being taken.
+type iqSnapshot struct {
+	format radio.SampleFormat
+	level  float32
+
+	want    atomic.Bool // set by Take, cleared once pending is full
+	pending []complex64
+	n       int
+	ready   chan []complex64
+}
+
+func newIQSnapshot(format radio.SampleFormat, level float32, samples int) *iqSnapshot {
+	return &iqSnapshot{
+		format:  format,
+		level:   level,
+		pending: make([]complex64, samples),
+		ready:   make(chan []complex64, 1),
+	}
+}
+
+// Write copies buf, in the radio's wire format, towards the next snapshot.
+// It is called from the TX callback.
+func (s *iqSnapshot) Write(buf []byte) {
+	if !s.want.Load() {
+		return
+	}
+	s.n += radio.UnpackIQ(s.pending[s.n:], buf, s.format, s.level)
+	if s.n == len(s.pending) {
+		s.want.Store(false)
+		s.n = 0
+		select {
+		case s.ready <- s.pending:
+		default:
+		}
+	}
+}
+
+// Take asks for a snapshot and waits for it; ok is false if ctx is done
+// first.
+func (s *iqSnapshot) Take(ctx context.Context) (samples []complex64, ok bool) {
+	s.want.Store(true)
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case samples = <-s.ready:
+		return samples, true
+	}
+}
+
+// selfMonitor demodulates a copy of what is handed to the radio, after the
+// key ramp, clipping and quantisation, and keeps the MER of the latest
+// snapshot. It watches the digital signal, so it catches clipping and
+// level problems but not what happens in the radio or on the air.
+type selfMonitor struct {
+	*iqSnapshot
+
+	mer atomic.Uint64 // float64 bits; NaN until measured or while keyed off
+}
+
+func newSelfMonitor(format radio.SampleFormat, level float32) *selfMonitor {
+	m := &selfMonitor{iqSnapshot: newIQSnapshot(format, level, selfMonitorSamples)}
+	m.mer.Store(math.Float64bits(math.NaN()))
+	return m
+}
+
+// Run measures a snapshot every selfMonitorInterval until ctx is done.
+func (m *selfMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(selfMonitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		snap, ok := m.Take(ctx)
+		if !ok {
+			return
+		}
+		m.mer.Store(math.Float64bits(measureSnapshot(snap)))
+	}
+}
+
+// measureSnapshot returns the MER of a snapshot, or NaN if the carrier is off.
+func measureSnapshot(samples []complex64) float64 {
+	var power float64
+	for _, s := range samples {
+		power += float64(real(s)*real(s) + imag(s)*imag(s))
+	}
+	if power/float64(len(samples)) < selfMonitorMinPower {
+		return math.NaN()
+	}
+	symbols, _ := recoverSymbols(samples, consts.HackRFSampleRate, consts.SymbolRate, consts.RollOffFactor)
+	return measureMER(symbols)
+}
+
+// MER returns the latest MER in dB, or NaN if there is none.
+func (m *selfMonitor) MER() float64 {
+	return math.Float64frombits(m.mer.Load())
+}
+
+// EVM returns the RMS error vector magnitude, in percent, matching MER.
+func (m *selfMonitor) EVM() float64 {
+	return 100 * math.Pow(10, -m.MER()/20)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+
+	"hackdvbs/consts"
+	"hackdvbs/dvbs"
+	"hackdvbs/filter"
+	"hackdvbs/radio"
+	"hackdvbs/spectrum"
+)
+
+const (
+	// Random TS packets pushed through the encoder (~1.3 M samples)
+	selfTestPackets = 400
+
+	// The self-test fails if either adjacent channel is less than this far
+	// below the wanted channel. The RRC filter and int8 packing reach about
+	// 44 dB; clipping or a truncated filter shows up well before 30.
+	selfTestMinACPR = 30.0
+
+	// ...or if the recovered constellation is worse than this
+	selfTestMinMER = 25.0
+)
+
+// selfTest measures the configured encoder and filter's output with
+// measureSignal and reports it. The ACPR and MER limits only apply with
+// limits set, for the built-in RRC filter. The packed I/Q is written to
+// iqOut if it is not nil.
+func selfTest(enc *dvbs.DVBSEncoder, rrc *filter.FIRFilter, limits bool, level float32, iqOut io.Writer) error {
+	sig, err := measureSignal(enc, rrc, level, iqOut)
+	if err != nil {
+		return err
+	}
+	occupied := consts.SymbolRate * (1 + consts.RollOffFactor)
+
+	fmt.Printf("Self-test: %d packets, %d samples\n", selfTestPackets, sig.samples)
+	fmt.Printf("  Level: %.0f counts per unit sample, clip-free up to %.0f (peak gain %.2f)\n", level*127, clipFreeLevel(enc, rrc)*127, rrc.PeakGain())
+	fmt.Printf("  ACPR:  lower %.1f dB, upper %.1f dB (limit -%.0f dB, %.2f MHz channel)\n", sig.lower, sig.upper, selfTestMinACPR, occupied/1e6)
+	fmt.Printf("  MER:   %.1f dB (limit %.0f dB)\n", sig.mer, selfTestMinMER)
+
+	if !limits {
+		fmt.Println("Self-test passed; the ACPR and MER limits only apply to the built-in RRC filter.")
+		return nil
+	}
+	if worst := math.Max(sig.lower, sig.upper); worst > -selfTestMinACPR {
+		return fmt.Errorf("adjacent channel power %.1f dB exceeds the -%.0f dB limit", worst, selfTestMinACPR)
+	}
+	if sig.mer < selfTestMinMER {
+		return fmt.Errorf("MER %.1f dB is below the %.0f dB limit", sig.mer, selfTestMinMER)
+	}
+	fmt.Println("Self-test passed.")
+	return nil
+}
+
+// signalReport is what measureSignal finds in the encoder's output.
+type signalReport struct {
+	samples      int
+	lower, upper float64 // adjacent channel power, dB
+	mer          float64 // dB
+}
+
+// measureSignal encodes random TS through enc, rrc and the radio's 8-bit
+// packing at level, then measures the power in the adjacent channels and
+// the MER of the recovered constellation. The packed I/Q is written to
+// iqOut if it is not nil.
+func measureSignal(enc *dvbs.DVBSEncoder, rrc *filter.FIRFilter, level float32, iqOut io.Writer) (signalReport, error) {
+	rng := rand.New(rand.NewSource(1))
+	stream := make([]byte, selfTestPackets*consts.TSPacketSize)
+	rng.Read(stream)
+	for i := 0; i < len(stream); i += consts.TSPacketSize {
+		stream[i] = consts.TSSyncByte
+	}
+	var out sampleCollector
+	if err := dvbs.StreamToIQ(bytes.NewReader(stream), &out, enc, rrc); err != nil {
+		return signalReport{}, err
+	}
+	samples := out.samples
+
+	// Round trip through the radio's wire format so clipping and
+	// quantisation are part of what is measured.
+	wire := make([]byte, len(samples)*radio.Int8.BytesPerSample())
+	radio.PackIQ(wire, samples, radio.Int8, level)
+	if iqOut != nil {
+		if _, err := iqOut.Write(wire); err != nil {
+			return signalReport{}, err
+		}
+	}
+	for i := range samples {
+		samples[i] = complex(float32(int8(wire[2*i]))/128, float32(int8(wire[2*i+1]))/128)
+	}
+
+	psd := spectrum.Welch(samples, inspectPSDSize)
+	occupied := consts.SymbolRate * (1 + consts.RollOffFactor)
+	lower, upper := spectrum.ACPR(psd, consts.HackRFSampleRate, occupied)
+	symbols, _ := recoverSymbols(samples, consts.HackRFSampleRate, consts.SymbolRate, consts.RollOffFactor)
+	return signalReport{
+		samples: len(samples),
+		lower:   lower,
+		upper:   upper,
+		mer:     measureMER(symbols),
+	}, nil
+}
+
+// sampleCollector is a dvbs.SampleWriter that keeps everything in memory.
+type sampleCollector struct {
+	samples []complex64
+}
+
+func (c *sampleCollector) WriteAll(samples []complex64) {
+	c.samples = append(c.samples, samples...)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"hackdvbs/consts"
+	"hackdvbs/dvbs"
+	"hackdvbs/filter"
+	"hackdvbs/radio"
+)
+
+// TestSignalLimits guards against shipping a splattery build: with the
+// default settings the output must keep its adjacent channels and its
+// constellation within the self-test's limits.
+func TestSignalLimits(t *testing.T) {
+	cfg := Defaults()
+	rrc, err := cfg.Filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := measureSignal(dvbs.NewDVBSEncoder(), rrc, cfg.Level(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if worst := math.Max(sig.lower, sig.upper); worst > -selfTestMinACPR {
+		t.Errorf("adjacent channel power %.1f dB exceeds the -%.0f dB limit", worst, selfTestMinACPR)
+	}
+	if sig.mer < selfTestMinMER {
+		t.Errorf("MER %.1f dB is below the %.0f dB limit", sig.mer, selfTestMinMER)
+	}
+}
+
+// TestClipFree drives each filter phase to its worst case, every symbol
+// taking the sign of the tap it meets, and packs the result at the level
+// clipFreeLevel allows with no backoff. Nothing may clip, and the peak must
+// reach full scale to within a count, or the level is being given away.
+func TestClipFree(t *testing.T) {
+	tests := []struct {
+		taps, sps int
+		rollOff   float64
+		phase     float64 // degrees
+	}{
+		{41, 2, consts.RollOffFactor, 0},
+		{21, 2, consts.RollOffFactor, 0},
+		{81, 2, consts.RollOffFactor, 0},
+		{41, 2, 0.2, 0},
+		{41, 2, 0.25, 30},
+		{41, 2, consts.RollOffFactor, 45},
+		{81, 4, consts.RollOffFactor, 0},
+		{81, 4, 0.2, 10},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%d taps, %d sps, roll-off %.2f, phase %.0f", tt.taps, tt.sps, tt.rollOff, tt.phase)
+		t.Run(name, func(t *testing.T) {
+			enc := dvbs.NewDVBSEncoder()
+			enc.SetPhaseOffset(tt.phase)
+			points := enc.Constellation()
+			newFilter := func() *filter.FIRFilter {
+				return filter.NewRRCFilter(consts.SymbolRate, consts.SymbolRate*float64(tt.sps), tt.rollOff, tt.taps)
+			}
+			rrc := newFilter()
+			level := clipFreeLevel(enc, rrc)
+
+			var peak float32
+			for j := 0; j < tt.sps; j++ {
+				// The newest symbol meets tap j, the one before tap j+sps, ...
+				var run []complex64
+				for k := j; k < tt.taps; k += tt.sps {
+					best := points[0]
+					for _, p := range points {
+						if real(p)*rrc.Taps[k] > real(best)*rrc.Taps[k] {
+							best = p
+						}
+					}
+					run = append([]complex64{best}, run...)
+				}
+				samples := newFilter().Process(run)
+				wire := make([]byte, len(samples)*radio.Int8.BytesPerSample())
+				if n := radio.PackIQ(wire, samples, radio.Int8, level); n > 0 {
+					t.Fatalf("%d samples clipped at the clip-free level", n)
+				}
+				for _, s := range samples {
+					peak = max(peak, float32(math.Abs(float64(real(s)))))
+				}
+			}
+			if counts := peak * level * 127; counts < 126 {
+				t.Errorf("worst-case peak reaches only %.1f of 127 counts", counts)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Transfers queued for a file or stdout sink before the TX callback starts
+// dropping them rather than wait (about 2 s of HackRF transfers)
+const sinkQueue = 32
+
+// Names -sinks takes
+const (
+	sinkRadio  = "radio"
+	sinkFile   = "file"
+	sinkStdout = "stdout"
+	sinkFFT    = "fft"
+)
+
+// iqSink is anything the TX callback hands each packed transfer to besides
+// the radio. Write is called from the callback, so it must not block for
+// long; it must copy what it keeps, as buf is reused.
+type iqSink interface {
+	Write(buf []byte)
+}
+
+// parseSinks parses "radio,file,fft", the outputs to feed.
+func parseSinks(spec string) (map[string]bool, error) {
+	sinks := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case sinkRadio, sinkFile, sinkStdout, sinkFFT:
+			sinks[name] = true
+		default:
+			return nil, fmt.Errorf("unknown sink %q, expected radio, file, stdout or fft", name)
+		}
+	}
+	return sinks, nil
+}
+
+// iqQueue hands copies of the packed transfers to a goroutine that writes
+// them, so a slow disk or pipe costs the copy, never samples. With realtime
+// set, as when a radio is pulling samples, a transfer that finds the queue
+// full is dropped and counted; otherwise Write waits, holding the encoder
+// back instead.
+type iqQueue struct {
+	name     string // the option, for messages
+	realtime bool
+
+	queue   chan []byte
+	pool    sync.Pool
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// newIQQueue starts a goroutine passing each queued transfer to write,
+// until write fails, and then calling finish once the queue is closed.
+func newIQQueue(name string, realtime bool, write func([]byte) error, finish func()) *iqQueue {
+	q := &iqQueue{
+		name:     name,
+		realtime: realtime,
+		queue:    make(chan []byte, sinkQueue),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(q.done)
+		failed := false
+		for b := range q.queue {
+			if !failed {
+				if err := write(b); err != nil {
+					log.Printf("WARNING: %s write failed, no longer recording: %v", name, err)
+					failed = true
+				}
+			}
+			q.pool.Put(b)
+		}
+		finish()
+	}()
+	return q
+}
+
+// Write queues a copy of buf.
+func (q *iqQueue) Write(buf []byte) {
+	b, _ := q.pool.Get().([]byte)
+	if cap(b) < len(buf) {
+		b = make([]byte, len(buf))
+	}
+	b = b[:len(buf)]
+	copy(b, buf)
+	if !q.realtime {
+		q.queue <- b
+		return
+	}
+	select {
+	case q.queue <- b:
+	default:
+		q.pool.Put(b)
+		if q.dropped.Add(1) == 1 {
+			log.Printf("WARNING: %s cannot keep up; the recording has gaps", q.name)
+		}
+	}
+}
+
+// Dropped returns the number of transfers missing from the recording.
+func (q *iqQueue) Dropped() uint64 {
+	return q.dropped.Load()
+}
+
+// Close writes out what is queued and waits for finish.
+func (q *iqQueue) Close() {
+	close(q.queue)
+	<-q.done
+}
+
+// newIQStreamSink writes the transfers to w, -iqout's file or stdout,
+// through an iqQueue.
+func newIQStreamSink(name string, w io.Writer, realtime bool) *iqQueue {
+	bw := bufio.NewWriterSize(w, 1<<20)
+	write := func(b []byte) error {
+		_, err := bw.Write(b)
+		return err
+	}
+	finish := func() {
+		if err := bw.Flush(); err != nil {
+			log.Printf("WARNING: %s write failed: %v", name, err)
+		}
+	}
+	return newIQQueue(name, realtime, write, finish)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Image types FFmpeg's image2 demuxer decodes without extra options.
+var slideshowExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".bmp":  true,
+}
+
+// writeSlideshowList writes an FFmpeg concat playlist showing every image in
+// dir, in name order, for dwell each. The caller removes the returned file.
+func writeSlideshowList(dir string, dwell time.Duration) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var images []string
+	for _, e := range entries {
+		if !e.IsDir() && slideshowExts[strings.ToLower(filepath.Ext(e.Name()))] {
+			path, err := filepath.Abs(filepath.Join(dir, e.Name()))
+			if err != nil {
+				return "", err
+			}
+			images = append(images, path)
+		}
+	}
+	if len(images) == 0 {
+		return "", fmt.Errorf("no images (jpg, png, bmp) in %s", dir)
+	}
+	sort.Strings(images)
+
+	var b strings.Builder
+	b.WriteString("ffconcat version 1.0\n")
+	for _, img := range images {
+		fmt.Fprintf(&b, "file '%s'\nduration %.3f\n", strings.ReplaceAll(img, "'", `'\''`), dwell.Seconds())
+	}
+	// The concat demuxer ignores the duration of the last entry unless the
+	// file is listed once more.
+	fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(images[len(images)-1], "'", `'\''`))
+
+	f, err := os.CreateTemp("", "hackdvbs-slideshow-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(b.String()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
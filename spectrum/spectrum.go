@@ -0,0 +1,116 @@
+// Package spectrum provides the FFT-based measurements used by the
+// diagnostic modes.
+package spectrum
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// FFT computes the discrete Fourier transform of x in place. len(x) must be
+// a power of two.
+func FFT(x []complex128) {
+	n := len(x)
+	if n&(n-1) != 0 {
+		panic("spectrum: FFT length is not a power of two")
+	}
+	if n < 2 {
+		return
+	}
+	shift := 64 - bits.TrailingZeros(uint(n))
+	for i := range x {
+		if j := int(bits.Reverse64(uint64(i)) >> shift); j > i {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// Welch estimates the power spectral density of x by averaging Hann-windowed
+// FFTs of size points with 50% overlap. The result is in linear power units,
+// ordered from -fs/2 to +fs/2 (DC in the middle at index size/2).
+func Welch(x []complex64, size int) []float64 {
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	psd := make([]float64, size)
+	buf := make([]complex128, size)
+	segments := 0
+	for start := 0; start+size <= len(x); start += size / 2 {
+		for i := range buf {
+			buf[i] = complex128(x[start+i]) * complex(window[i], 0)
+		}
+		FFT(buf)
+		for i, v := range buf {
+			psd[(i+size/2)%size] += real(v)*real(v) + imag(v)*imag(v)
+		}
+		segments++
+	}
+	if segments > 0 {
+		for i := range psd {
+			psd[i] /= float64(segments)
+		}
+	}
+	return psd
+}
+
+// DB converts a linear power ratio to decibels.
+func DB(p float64) float64 {
+	return 10 * math.Log10(p)
+}
+
+// BandPower returns the mean power spectral density between lo and hi Hz
+// (relative to the centre) of a spectrum from Welch. The band is clipped to
+// the Nyquist range; ok is false if nothing of it is left.
+func BandPower(psd []float64, sampleRate, lo, hi float64) (mean float64, ok bool) {
+	n := len(psd)
+	binHz := sampleRate / float64(n)
+	first := max(0, int(math.Ceil(lo/binHz))+n/2)
+	last := min(n-1, int(math.Floor(hi/binHz))+n/2)
+	if last < first {
+		return 0, false
+	}
+	var sum float64
+	for _, p := range psd[first : last+1] {
+		sum += p
+	}
+	return sum / float64(last-first+1), true
+}
+
+// ACPR returns the adjacent channel power ratio in dB of a channel of the
+// given occupied bandwidth centred at DC: the power in an equal-width band
+// either side relative to the power in the channel. Where the adjacent band
+// extends beyond the Nyquist range its power is extrapolated from the part
+// that is visible.
+func ACPR(psd []float64, sampleRate, bandwidth float64) (lower, upper float64) {
+	return ACPRAt(psd, sampleRate, 0, bandwidth)
+}
+
+// ACPRAt is ACPR for a channel centred centre Hz from DC, as with an IF
+// offset.
+func ACPRAt(psd []float64, sampleRate, centre, bandwidth float64) (lower, upper float64) {
+	half := bandwidth / 2
+	inBand, _ := BandPower(psd, sampleRate, centre-half, centre+half)
+	lo, okLo := BandPower(psd, sampleRate, centre-3*half, centre-half)
+	hi, okHi := BandPower(psd, sampleRate, centre+half, centre+3*half)
+	lower, upper = math.Inf(-1), math.Inf(-1)
+	if okLo {
+		lower = DB(lo / inBand)
+	}
+	if okHi {
+		upper = DB(hi / inBand)
+	}
+	return lower, upper
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"hackdvbs/consts"
+	"hackdvbs/radio"
+	"hackdvbs/spectrum"
+)
+
+const (
+	// Samples per -sinks fft measurement (33 ms at 2 Msps)
+	spectrumMonitorSamples = 1 << 16
+
+	// Interval between -sinks fft measurements
+	spectrumMonitorInterval = 2 * time.Second
+)
+
+// spectrumReading is one spectrumMonitor measurement.
+type spectrumReading struct {
+	Bandwidth    float64 // Hz, at -3 dB
+	Lower, Upper float64 // ACPR, dB
+	Power        float64 // mean power, dB relative to full scale on I or Q
+}
+
+// spectrumMonitor is the fft sink: it takes the spectrum of what is handed
+// to the radio every spectrumMonitorInterval and keeps the occupied
+// bandwidth, adjacent channel power and level of the latest, for the
+// monitor to report. Like selfMonitor it sees the digital signal only.
+type spectrumMonitor struct {
+	*iqSnapshot
+	centre float64 // Hz from the tuned frequency; the IF offset
+
+	mu   sync.Mutex
+	last spectrumReading
+	ok   bool
+}
+
+func newSpectrumMonitor(format radio.SampleFormat, level float32, centre float64) *spectrumMonitor {
+	return &spectrumMonitor{iqSnapshot: newIQSnapshot(format, level, spectrumMonitorSamples), centre: centre}
+}
+
+// Run measures a snapshot every spectrumMonitorInterval until ctx is done.
+func (m *spectrumMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(spectrumMonitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		snap, ok := m.Take(ctx)
+		if !ok {
+			return
+		}
+		r, ok := m.measure(snap)
+		m.mu.Lock()
+		m.last, m.ok = r, ok
+		m.mu.Unlock()
+	}
+}
+
+// measure returns the reading for a snapshot; ok is false if the carrier
+// is off.
+func (m *spectrumMonitor) measure(samples []complex64) (r spectrumReading, ok bool) {
+	var power float64
+	for _, s := range samples {
+		power += float64(real(s)*real(s) + imag(s)*imag(s))
+	}
+	power /= float64(len(samples))
+	if power < selfMonitorMinPower {
+		return r, false
+	}
+	psd := spectrum.Welch(samples, inspectPSDSize)
+	r.Bandwidth = occupiedBandwidth(psd, consts.HackRFSampleRate, 0.5)
+	r.Lower, r.Upper = spectrum.ACPRAt(psd, consts.HackRFSampleRate, m.centre, consts.SymbolRate*(1+consts.RollOffFactor))
+	// A unit sample is packed at level, so full scale is 1/level
+	r.Power = spectrum.DB(power * float64(m.level*m.level))
+	return r, true
+}
+
+// Reading returns the latest measurement; ok is false if there is none yet
+// or the carrier was off.
+func (m *spectrumMonitor) Reading() (r spectrumReading, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last, m.ok
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"hackdvbs/ts"
+)
+
+// reportStreamCheck logs what the -stream-check window saw: a summary line
+// if the video and audio are both flowing, and a warning naming the stream
+// and the likely culprit for each one that is missing or empty. capture is
+// set when the video and audio come from a local camera and microphone.
+func reportStreamCheck(check *ts.StreamCheck, window time.Duration, capture, audioOnly bool) {
+	streams, ok := check.Result()
+	if !ok {
+		log.Printf("WARNING: No PAT and PMT in the first %v of the stream; receivers will not find the programme", window)
+		return
+	}
+	hints := map[string]string{
+		"video": "the source is not sending it",
+		"audio": "the source is not sending it",
+	}
+	if capture {
+		hints["video"] = "is the camera connected and -device right?"
+		hints["audio"] = "is the microphone connected and unmuted (ALSA default capture device)?"
+	}
+
+	var flowing []string
+	listed := make(map[string]bool)
+	healthy := true
+	for _, st := range streams {
+		if st.Kind == "" {
+			continue
+		}
+		listed[st.Kind] = true
+		if st.PES == 0 {
+			log.Printf("WARNING: The %s stream (PID %#x) carried nothing in the first %v; %s", st.Kind, st.PID, window, hints[st.Kind])
+			healthy = false
+			continue
+		}
+		flowing = append(flowing, fmt.Sprintf("%s on PID %#x (%d PES)", st.Kind, st.PID, st.PES))
+	}
+	for _, kind := range []string{"video", "audio"} {
+		if !listed[kind] && (kind == "audio" || !audioOnly) {
+			log.Printf("WARNING: The programme has no %s stream", kind)
+			healthy = false
+		}
+	}
+	if healthy {
+		log.Printf("Stream check: %s", strings.Join(flowing, ", "))
+	}
+}
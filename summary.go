@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"hackdvbs/consts"
+	"hackdvbs/dvbs"
+	"hackdvbs/iqring"
+)
+
+// runSummary accumulates what the shutdown summary reports beyond the
+// counters the encoder and ring keep themselves.
+type runSummary struct {
+	mu      sync.Mutex
+	start   time.Time
+	peak    float64 // buffer fill, percent
+	fillSum float64
+	fills   int
+	clipped uint64
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{start: time.Now()}
+}
+
+// Transfer records one buffer handed to the radio: the ring fill when it
+// was taken and how many of its samples clipped.
+func (s *runSummary) Transfer(ring *iqring.Ring, clipped int) {
+	fill := float64(ring.Fill()) * 100 / float64(ring.Cap())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peak = max(s.peak, fill)
+	s.fillSum += fill
+	s.fills++
+	s.clipped += uint64(clipped)
+}
+
+// Print logs the summary. Call it once the radio and encoder have stopped
+// so the figures are final.
+func (s *runSummary) Print(enc *dvbs.DVBSEncoder, ring *iqring.Ring, samples uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := time.Since(s.start)
+	packets := enc.Packets()
+	avgFill := 0.0
+	if s.fills > 0 {
+		avgFill = s.fillSum / float64(s.fills)
+	}
+	clippedPct := 0.0
+	if samples > 0 {
+		clippedPct = float64(s.clipped) * 100 / float64(samples)
+	}
+
+	log.Println("--- Run summary ---")
+	log.Printf("Runtime:      %v", elapsed.Round(time.Second))
+	log.Printf("TS packets:   %d (average %.1f kbps)", packets, float64(packets)*consts.TSPacketSize*8/elapsed.Seconds()/1000)
+	log.Printf("Samples:      %d (%.2f s of air time)", samples, float64(samples)/consts.HackRFSampleRate)
+	log.Printf("Buffer fill:  peak %.1f%%, average %.1f%%", s.peak, avgFill)
+	log.Printf("Underflows:   %d, encoder waits: %d", ring.Underruns(), ring.Overruns())
+	log.Printf("Clipped:      %d samples (%.4f%%)", s.clipped, clippedPct)
+	if stalls, longest := enc.Stalls(); stalls > 0 {
+		log.Printf("Input stalls: %d, longest %v", stalls, longest.Round(time.Millisecond))
+	}
+	if inj := enc.ErrorInjector(); inj != nil {
+		log.Printf("Injected:     %d errors in %d packets", inj.Injected(), inj.Packets())
+	}
+}
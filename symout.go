@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// symbolWriter is a dvbs.SampleWriter for -symout: it writes the QPSK
+// symbols, unfiltered and one per symbol, as interleaved little-endian
+// float32 I and Q, GNU Radio's complex file format. A failed write, such as
+// the reader of a pipe going away, ends the run through Failed.
+type symbolWriter struct {
+	mu      sync.Mutex
+	out     *bufio.Writer // nil once a write has failed
+	buf     []byte
+	symbols atomic.Uint64
+
+	failOnce sync.Once
+	failed   chan struct{}
+}
+
+func newSymbolWriter(out io.Writer) *symbolWriter {
+	return &symbolWriter{out: bufio.NewWriterSize(out, 1<<20), failed: make(chan struct{})}
+}
+
+func (w *symbolWriter) WriteAll(symbols []complex64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.out == nil {
+		return
+	}
+	n := len(symbols) * 8
+	if cap(w.buf) < n {
+		w.buf = make([]byte, n)
+	}
+	buf := w.buf[:n]
+	for i, s := range symbols {
+		binary.LittleEndian.PutUint32(buf[i*8:], math.Float32bits(real(s)))
+		binary.LittleEndian.PutUint32(buf[i*8+4:], math.Float32bits(imag(s)))
+	}
+	if _, err := w.out.Write(buf); err != nil {
+		w.fail(err)
+		return
+	}
+	w.symbols.Add(uint64(len(symbols)))
+}
+
+// Close writes out what is still buffered and drops anything the encoder,
+// which may still be running, writes after it. If the encoder is blocked
+// writing, as on a pipe nobody reads, the buffer is abandoned rather than
+// hanging the exit.
+func (w *symbolWriter) Close() {
+	if !w.mu.TryLock() {
+		return
+	}
+	defer w.mu.Unlock()
+	if w.out != nil {
+		if err := w.out.Flush(); err != nil {
+			w.fail(err)
+		}
+		w.out = nil
+	}
+}
+
+func (w *symbolWriter) fail(err error) {
+	log.Printf("Error: -symout write failed: %v", err)
+	w.out = nil
+	w.failOnce.Do(func() { close(w.failed) })
+}
+
+// Failed is closed when a write has failed.
+func (w *symbolWriter) Failed() <-chan struct{} {
+	return w.failed
+}
+
+// Symbols returns the number of symbols written.
+func (w *symbolWriter) Symbols() uint64 {
+	return w.symbols.Load()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// testCardText expands the -testcard-text template: {callsign}, {freq} (in
+// MHz) and {sr} (the symbol rate in kS/s), with \n starting a new line.
+// Lines left empty, such as {callsign} when none is set, are dropped.
+func testCardText(template, callsign string, freqMHz, symbolRate float64) string {
+	text := strings.NewReplacer(
+		`\n`, "\n",
+		"{callsign}", callsign,
+		"{freq}", strconv.FormatFloat(freqMHz, 'f', 2, 64),
+		"{sr}", strconv.FormatFloat(symbolRate/1000, 'f', 0, 64),
+	).Replace(template)
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeTestCardText writes the caption for drawtext's textfile option,
+// which shows it as it is, free of filtergraph escaping. The caller removes
+// the returned file.
+func writeTestCardText(text string) (string, error) {
+	f, err := os.CreateTemp("", "hackdvbs-testcard-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// testCardFilter returns the drawtext filter that centres the caption in
+// textfile on a picture of the given size, white on a dark box so it reads
+// over any bar. Sizes are worked out here, as older FFmpeg releases only
+// take plain numbers for the spacing and border.
+func testCardFilter(textfile, size string) string {
+	_, h, _ := strings.Cut(size, "x")
+	height, err := strconv.Atoi(h)
+	if err != nil || height <= 0 {
+		height = 480
+	}
+	// Quoted for the filtergraph; the option parser still splits on ':',
+	// as in a Windows drive letter
+	path := strings.ReplaceAll(filepath.ToSlash(textfile), ":", `\:`)
+	return fmt.Sprintf("drawtext=textfile='%s':expansion=none"+
+		":fontcolor=white:fontsize=%d:line_spacing=%d"+
+		":box=1:boxcolor=black@0.7:boxborderw=%d"+
+		":x=(w-text_w)/2:y=(h-text_h)/2",
+		path, height/14, height/40, height/40)
+}
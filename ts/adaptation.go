@@ -0,0 +1,88 @@
+package ts
+
+import "fmt"
+
+const (
+	headerSize = 4
+	pcrSize    = 6
+
+	// MaxPayload is the payload of a packet without an adaptation field.
+	MaxPayload = PacketSize - headerSize
+
+	// Adaptation field flags kept across SetPayload: they describe the
+	// payload rather than the field
+	keptAdaptationFlags = 0xE0 // discontinuity, random access, ES priority
+)
+
+// PayloadRoom returns the most payload bytes a packet can carry alongside
+// an adaptation field with a PCR, or with no adaptation field at all.
+func PayloadRoom(withPCR bool) int {
+	if withPCR {
+		return MaxPayload - 2 - pcrSize // length and flags bytes, PCR
+	}
+	return MaxPayload
+}
+
+// SetPayload rebuilds pkt around payload: it writes a new adaptation field
+// carrying a PCR if withPCR, pads it with as many stuffing bytes as the
+// payload leaves room for, copies the payload in after it and sets the
+// adaptation_field_control bits to match. The header's sync byte, PID,
+// flags and continuity counter are left alone, as are the discontinuity,
+// random access and priority flags of an existing adaptation field; its
+// other optional fields are dropped. An empty payload makes an
+// adaptation-only packet. It fails if payload exceeds PayloadRoom(withPCR).
+func SetPayload(pkt, payload []byte, withPCR bool, pcr uint64) error {
+	if room := PayloadRoom(withPCR); len(payload) > room {
+		return fmt.Errorf("%d byte payload does not fit, room for %d", len(payload), room)
+	}
+	var flags byte
+	if pkt[3]&0x20 != 0 && pkt[4] > 0 {
+		flags = pkt[5] & keptAdaptationFlags
+	}
+
+	afLen := MaxPayload - 1 - len(payload) // bytes after the length byte
+	control := byte(0x30)                  // adaptation field and payload
+	switch {
+	case afLen < 0:
+		control = 0x10 // payload only
+	case len(payload) == 0:
+		control = 0x20 // adaptation field only
+	}
+	pkt[3] = pkt[3]&0xCF | control
+
+	body := pkt[headerSize:]
+	if afLen >= 0 {
+		body[0] = byte(afLen)
+		if afLen > 0 {
+			if withPCR {
+				flags |= 0x10
+			}
+			body[1] = flags
+			stuffing := body[2 : 1+afLen]
+			if withPCR {
+				SetPCR(pkt, pcr)
+				stuffing = stuffing[pcrSize:]
+			}
+			for i := range stuffing {
+				stuffing[i] = 0xFF
+			}
+		}
+		body = body[1+afLen:]
+	}
+	copy(body, payload)
+	return nil
+}
+
+// PCRPacket returns an adaptation-only packet on pid carrying pcr, for
+// keeping a PCR going when there is no payload to carry it. Packets without
+// a payload do not advance the continuity counter, so cc is the counter of
+// the PID's last packet.
+func PCRPacket(pid uint16, cc byte, pcr uint64) []byte {
+	pkt := make([]byte, PacketSize)
+	pkt[0] = SyncByte
+	pkt[1] = byte(pid>>8) & 0x1F
+	pkt[2] = byte(pid)
+	pkt[3] = cc & 0x0F
+	SetPayload(pkt, nil, true, pcr)
+	return pkt
+}
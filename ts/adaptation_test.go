@@ -0,0 +1,47 @@
+package ts
+
+import (
+	"bytes"
+	"testing"
+)
+
+// SetPayload must give every payload length, with and without a PCR, a
+// header, adaptation field length, PCR and payload that read back as
+// written.
+func TestSetPayload(t *testing.T) {
+	for _, withPCR := range []bool{false, true} {
+		for n := 0; n <= PayloadRoom(withPCR); n++ {
+			payload := make([]byte, n)
+			for i := range payload {
+				payload[i] = byte(i + 1)
+			}
+			pkt := NullPacket()
+			pkt[3] |= 0x0A // continuity counter
+			const pcr = 0x123456789*300 + 299
+			if err := SetPayload(pkt, payload, withPCR, pcr); err != nil {
+				t.Fatalf("%d byte payload, PCR %t: %v", n, withPCR, err)
+			}
+			afLen := MaxPayload - 1 - n
+			switch {
+			case pkt[0] != SyncByte || PID(pkt) != NullPID || ContinuityCounter(pkt) != 0x0A:
+				t.Errorf("%d byte payload overwrote the header", n)
+			case HasPayload(pkt) != (n > 0):
+				t.Errorf("%d byte payload has payload flag %t", n, HasPayload(pkt))
+			case (pkt[3]&0x20 != 0) != (afLen >= 0):
+				t.Errorf("%d byte payload has adaptation flag %t", n, pkt[3]&0x20 != 0)
+			case afLen >= 0 && int(pkt[4]) != afLen:
+				t.Errorf("%d byte payload has field length %d, want %d", n, pkt[4], afLen)
+			case HasPCR(pkt) != withPCR || withPCR && PCR(pkt) != pcr:
+				t.Errorf("%d byte payload lost its PCR", n)
+			case !bytes.Equal(Payload(pkt), payload):
+				t.Errorf("%d byte payload reads back as %d bytes", n, len(Payload(pkt)))
+			}
+		}
+	}
+}
+
+func TestSetPayloadTooLong(t *testing.T) {
+	if err := SetPayload(NullPacket(), make([]byte, MaxPayload), true, 0); err == nil {
+		t.Error("a payload too long to fit beside a PCR was accepted")
+	}
+}
@@ -0,0 +1,143 @@
+package ts
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Bridge keeps a network stream going through gaps. Packets are read ahead
+// into a short buffer; if none arrives for the stall timeout, null packets
+// are sent in their place at the channel bitrate, from the moment the input
+// stopped until it resumes, so the carrier stays modulated, the receiver
+// holds lock and the sample buffer ends the gap as full as it began. It also
+// realigns on the sync byte, since a reconnected stream may start part way
+// through a packet.
+type Bridge struct {
+	packets chan []byte
+	err     error
+	bitrate float64
+	stall   time.Duration
+	timer   *time.Timer
+
+	bridging bool
+	start    time.Time
+	sent     uint64 // nulls sent in the current gap
+
+	gaps  atomic.Uint64
+	nulls atomic.Uint64
+
+	pending []byte
+}
+
+// NewBridge starts reading src in the background into a buffer holding
+// depth worth of packets at bitrate (bits/s).
+func NewBridge(src io.Reader, bitrate float64, depth, stall time.Duration) *Bridge {
+	b := &Bridge{
+		packets: make(chan []byte, max(1, int(depth.Seconds()*bitrate/(PacketSize*8)))),
+		bitrate: bitrate,
+		stall:   stall,
+		timer:   time.NewTimer(stall),
+	}
+	go func() {
+		for {
+			pkt := make([]byte, PacketSize)
+			if _, err := io.ReadFull(src, pkt); err != nil {
+				b.err = err
+				close(b.packets)
+				return
+			}
+			if pkt[0] != SyncByte {
+				if err := realign(src, pkt); err != nil {
+					b.err = err
+					close(b.packets)
+					return
+				}
+			}
+			b.packets <- pkt
+		}
+	}()
+	return b
+}
+
+// realign slides pkt forward through the stream until it starts on a sync byte.
+func realign(r io.Reader, pkt []byte) error {
+	for pkt[0] != SyncByte {
+		k := bytes.IndexByte(pkt[1:], SyncByte) + 1
+		if k == 0 {
+			k = len(pkt)
+		}
+		n := copy(pkt, pkt[k:])
+		if _, err := io.ReadFull(r, pkt[n:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read implements io.Reader.
+func (b *Bridge) Read(p []byte) (int, error) {
+	if len(b.pending) == 0 {
+		pkt, err := b.next()
+		if err != nil {
+			return 0, err
+		}
+		b.pending = pkt
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *Bridge) next() ([]byte, error) {
+	if !b.bridging {
+		b.timer.Reset(b.stall)
+		select {
+		case pkt, ok := <-b.packets:
+			b.timer.Stop()
+			return b.received(pkt, ok)
+		case <-b.timer.C:
+		}
+		// The nulls are scheduled from when the input stopped, so the first
+		// stall's worth go out at once and refill the buffer it drained
+		b.bridging = true
+		b.start, b.sent = time.Now().Add(-b.stall), 0
+		b.gaps.Add(1)
+		log.Printf("Input stalled for %v, bridging with null packets", b.stall)
+	}
+
+	select {
+	case pkt, ok := <-b.packets:
+		log.Printf("Input resumed after %d null packets", b.sent)
+		b.bridging = false
+		return b.received(pkt, ok)
+	default:
+	}
+	// Then pace them at the channel rate, so the gap adds no latency
+	due := b.start.Add(time.Duration(float64(b.sent) * PacketSize * 8 / b.bitrate * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+	b.sent++
+	b.nulls.Add(1)
+	return NullPacket(), nil
+}
+
+func (b *Bridge) received(pkt []byte, ok bool) ([]byte, error) {
+	if !ok {
+		return nil, b.err
+	}
+	return pkt, nil
+}
+
+// Gaps returns the number of stalls bridged.
+func (b *Bridge) Gaps() uint64 {
+	return b.gaps.Load()
+}
+
+// Nulls returns the number of null packets sent to bridge them.
+func (b *Bridge) Nulls() uint64 {
+	return b.nulls.Load()
+}
@@ -0,0 +1,29 @@
+package ts
+
+// crcPoly is the MPEG-2 CRC-32 polynomial, MSB first.
+const crcPoly = 0x04C11DB7
+
+var crcTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for k := 0; k < 8; k++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ crcPoly
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// CRC32 returns the MPEG-2 CRC-32 (ISO/IEC 13818-1 annex A) of data. A PSI
+// section including its CRC_32 field checks as 0.
+func CRC32(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
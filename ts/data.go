@@ -0,0 +1,191 @@
+package ts
+
+import (
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+)
+
+const (
+	// StreamTypePrivatePES is the PMT stream_type of PES packets carrying
+	// private data.
+	StreamTypePrivatePES = 0x06
+
+	// private_stream_1, the PES stream_id for private data with the usual
+	// optional header
+	privateStream1 = 0xBD
+
+	// Largest message one PES packet carries: the 16-bit PES length less
+	// the 3 bytes of optional header
+	MaxDataMessage = 0xFFFF - 3
+)
+
+// DataInserter multiplexes a low-rate private data stream, such as
+// telemetry or a text crawl, into a TS on its own PID. Each message becomes
+// one private-data PES packet, carried in place of null packets so that the
+// stream's bitrate is unchanged, and at no more than the given bitrate. The
+// PMTs are extended to list the data PID, recomputing each section's CRC, so
+// that receivers and demultiplexers see it as part of the programme.
+type DataInserter struct {
+	src  io.Reader
+	pid  uint16
+	data <-chan []byte
+	pmts map[uint16]bool
+
+	// Tokens in packets: each source packet earns share of a data packet
+	share  float64
+	tokens float64
+
+	pes []byte // rest of the PES packet being sent
+	cc  byte
+
+	pkt     []byte
+	pending []byte
+
+	messages atomic.Uint64
+	packets  atomic.Uint64
+	clash    atomic.Bool
+}
+
+// NewDataInserter inserts the messages read from data into src on pid, at
+// up to bitrate (bits/s) of a stream running at streamBitrate.
+func NewDataInserter(src io.Reader, pid uint16, data <-chan []byte, bitrate, streamBitrate float64) *DataInserter {
+	return &DataInserter{
+		src:   src,
+		pid:   pid,
+		data:  data,
+		pmts:  make(map[uint16]bool),
+		share: bitrate / streamBitrate,
+		pkt:   make([]byte, PacketSize),
+	}
+}
+
+// Read implements io.Reader.
+func (d *DataInserter) Read(p []byte) (int, error) {
+	if len(d.pending) == 0 {
+		if _, err := io.ReadFull(d.src, d.pkt); err != nil {
+			return 0, err
+		}
+		d.insert(d.pkt)
+		d.pending = d.pkt
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// insert extends a PMT in pkt, or replaces a null packet with the next data
+// packet when one is due.
+func (d *DataInserter) insert(pkt []byte) {
+	if pkt[0] != SyncByte {
+		return
+	}
+	d.tokens = min(d.tokens+d.share, 1)
+	pid := PID(pkt)
+	switch {
+	case pid == PATPID:
+		if programs, ok := ParsePAT(pkt); ok {
+			clear(d.pmts)
+			for _, pmt := range programs {
+				d.pmts[pmt] = true
+			}
+		}
+	case d.pmts[pid]:
+		d.extendPMT(pkt)
+	case pid == d.pid:
+		// The source already uses the PID; inserting would corrupt its stream
+		d.clash.Store(true)
+	case pid == NullPID && d.tokens >= 1 && !d.clash.Load():
+		if d.next(pkt) {
+			d.tokens--
+		}
+	}
+}
+
+// next fills pkt with the next packet of data, if there is any waiting.
+func (d *DataInserter) next(pkt []byte) bool {
+	start := false
+	if len(d.pes) == 0 {
+		select {
+		case msg := <-d.data:
+			if len(msg) > MaxDataMessage {
+				msg = msg[:MaxDataMessage]
+			}
+			d.pes = pesPacket(msg)
+			d.messages.Add(1)
+			start = true
+		default:
+			return false
+		}
+	}
+	pkt[0] = SyncByte
+	pkt[1] = byte(d.pid >> 8 & 0x1F)
+	if start {
+		pkt[1] |= 0x40
+	}
+	pkt[2] = byte(d.pid)
+	pkt[3] = 0x10 | d.cc
+	d.cc = (d.cc + 1) & 0x0F
+	n := min(len(d.pes), PayloadRoom(false))
+	SetPayload(pkt, d.pes[:n], false, 0)
+	d.pes = d.pes[n:]
+	d.packets.Add(1)
+	return true
+}
+
+// pesPacket wraps msg in a private_stream_1 PES packet without timestamps.
+func pesPacket(msg []byte) []byte {
+	pes := make([]byte, 9, 9+len(msg))
+	pes[0], pes[1], pes[2], pes[3] = 0x00, 0x00, 0x01, privateStream1
+	binary.BigEndian.PutUint16(pes[4:], uint16(3+len(msg)))
+	pes[6] = 0x80 // '10' marker, no scrambling, no flags
+	return append(pes, msg...)
+}
+
+// extendPMT adds the data PID to the PMT in pkt, if it is not listed
+// already and the section still fits in the packet.
+func (d *DataInserter) extendPMT(pkt []byte) {
+	s := section(pkt)
+	if len(s) < 16 || s[0] != 0x02 || CRC32(s) != 0 {
+		return
+	}
+	_, streams, _ := ParsePMT(pkt)
+	for _, st := range streams {
+		if st.PID == d.pid {
+			if st.Type != StreamTypePrivatePES {
+				d.clash.Store(true)
+			}
+			return
+		}
+	}
+	// The section ends in the packet's stuffing, which the new entry takes
+	end := PacketSize - len(Payload(pkt)) + 1 + int(Payload(pkt)[0]) + len(s)
+	if end+5 > PacketSize || pkt[end] != 0xFF {
+		return
+	}
+	s = pkt[end-len(s) : end+5]
+	entry := s[len(s)-9 : len(s)-4]
+	entry[0] = StreamTypePrivatePES
+	binary.BigEndian.PutUint16(entry[1:], 0xE000|d.pid)
+	binary.BigEndian.PutUint16(entry[3:], 0xF000) // no descriptors
+	length := 0xB000 | (len(s) - 3)
+	binary.BigEndian.PutUint16(s[1:], uint16(length))
+	body := s[:len(s)-4]
+	binary.BigEndian.PutUint32(s[len(body):], CRC32(body))
+}
+
+// Messages returns the number of messages inserted.
+func (d *DataInserter) Messages() uint64 {
+	return d.messages.Load()
+}
+
+// Packets returns the number of data packets inserted.
+func (d *DataInserter) Packets() uint64 {
+	return d.packets.Load()
+}
+
+// Clash reports whether the source already uses the data PID, in which
+// case nothing is inserted.
+func (d *DataInserter) Clash() bool {
+	return d.clash.Load()
+}
@@ -0,0 +1,214 @@
+package ts
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// maxGOPPackets bounds the memory used to hold one GOP (~1.5 MB).
+const maxGOPPackets = 8192
+
+// FreezeReader wraps a TS source and, when the source stalls, keeps the
+// stream alive by looping the last complete GOP. Continuity counters are
+// renumbered on every packet, and PCRs and PES timestamps are advanced
+// across loops so the receiver stays locked and shows a frozen frame
+// instead of breaking up. GOPs are cut at the keyframes of the first
+// program's video stream, learnt from the PAT and PMT; until then, or if
+// it has no video, there is nothing to freeze on.
+type FreezeReader struct {
+	packets chan []byte
+	err     error
+	stall   time.Duration
+	timer   *time.Timer
+
+	layout Layout
+	video  uint16 // 0 until known
+
+	gop     [][]byte
+	lastGOP [][]byte
+
+	frozen    bool
+	replayPos int
+	loops     int
+	resumed   bool
+
+	ccs       map[uint16]byte
+	havePCR   bool
+	lastPCR   uint64
+	pcrStep   uint64
+	pcrOffset uint64
+
+	pending []byte
+}
+
+// NewFreezeReader starts reading 188-byte packets from src in the background.
+// A stall is declared when no packet arrives within the given timeout.
+func NewFreezeReader(src io.Reader, stall time.Duration) *FreezeReader {
+	r := &FreezeReader{
+		packets: make(chan []byte, 1024),
+		stall:   stall,
+		timer:   time.NewTimer(stall),
+		ccs:     make(map[uint16]byte),
+	}
+	go func() {
+		for {
+			pkt := make([]byte, PacketSize)
+			if _, err := io.ReadFull(src, pkt); err != nil {
+				r.err = err
+				close(r.packets)
+				return
+			}
+			r.packets <- pkt
+		}
+	}()
+	return r
+}
+
+// Read implements io.Reader.
+func (r *FreezeReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		pkt, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		r.pending = pkt
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *FreezeReader) next() ([]byte, error) {
+	if r.frozen {
+		select {
+		case pkt, ok := <-r.packets:
+			if !ok {
+				return nil, r.err
+			}
+			log.Printf("Input resumed after %d frozen GOP loop(s)", r.loops)
+			r.frozen = false
+			r.resumed = true
+			return r.live(pkt), nil
+		default:
+			return r.replay(), nil
+		}
+	}
+
+	if !r.timer.Stop() {
+		select {
+		case <-r.timer.C:
+		default:
+		}
+	}
+	r.timer.Reset(r.stall)
+
+	select {
+	case pkt, ok := <-r.packets:
+		if !ok {
+			return nil, r.err
+		}
+		return r.live(pkt), nil
+	case <-r.timer.C:
+	}
+
+	if len(r.lastGOP) == 0 {
+		// Nothing to freeze on yet, just wait for the source.
+		pkt, ok := <-r.packets
+		if !ok {
+			return nil, r.err
+		}
+		return r.live(pkt), nil
+	}
+	log.Printf("Input stalled for %v, freezing on last GOP (%d packets)", r.stall, len(r.lastGOP))
+	r.frozen = true
+	r.replayPos = 0
+	r.loops = 0
+	return r.replay(), nil
+}
+
+// live records the packet into the GOP being collected and restamps it for output.
+func (r *FreezeReader) live(pkt []byte) []byte {
+	if pkt[0] != SyncByte {
+		return pkt
+	}
+	if r.video == 0 && !r.layout.Complete() {
+		r.layout.Add(pkt)
+		if r.layout.Complete() {
+			r.video = r.layout.videoPID()
+		}
+	}
+	if r.video != 0 && PID(pkt) == r.video && PayloadUnitStart(pkt) && RandomAccess(pkt) {
+		if r.gop != nil {
+			r.lastGOP = r.gop
+		}
+		r.gop = make([][]byte, 0, len(r.lastGOP)+16)
+	}
+	if r.gop != nil {
+		if len(r.gop) >= maxGOPPackets {
+			r.gop = nil
+		} else {
+			r.gop = append(r.gop, append([]byte(nil), pkt...))
+		}
+	}
+
+	if r.resumed && HasPCR(pkt) {
+		// The live clock does not follow on from the looped one.
+		SetDiscontinuity(pkt)
+		r.resumed = false
+	}
+	r.restamp(pkt, 0)
+	return pkt
+}
+
+// replay returns the next packet of the frozen GOP.
+func (r *FreezeReader) replay() []byte {
+	if r.replayPos == 0 {
+		r.pcrOffset = 0
+		if r.havePCR {
+			for _, p := range r.lastGOP {
+				if HasPCR(p) {
+					next := (r.lastPCR + r.pcrStep) % pcrWrap
+					r.pcrOffset = (next + pcrWrap - PCR(p)) % pcrWrap
+					break
+				}
+			}
+		}
+	}
+	pkt := append([]byte(nil), r.lastGOP[r.replayPos]...)
+	r.replayPos++
+	if r.replayPos == len(r.lastGOP) {
+		r.replayPos = 0
+		r.loops++
+	}
+	r.restamp(pkt, r.pcrOffset)
+	return pkt
+}
+
+// restamp renumbers the continuity counter and shifts the PCR, and the
+// PTS and DTS with it, by offset (27 MHz).
+func (r *FreezeReader) restamp(pkt []byte, offset uint64) {
+	pid := PID(pkt)
+	if offset != 0 && PayloadUnitStart(pkt) && pid != NullPID {
+		ShiftPESTimestamps(Payload(pkt), offset/300)
+	}
+	if last, ok := r.ccs[pid]; ok {
+		if HasPayload(pkt) {
+			last = (last + 1) & 0x0F
+		}
+		SetContinuityCounter(pkt, last)
+	}
+	r.ccs[pid] = ContinuityCounter(pkt)
+
+	if HasPCR(pkt) {
+		pcr := (PCR(pkt) + offset) % pcrWrap
+		if offset != 0 {
+			SetPCR(pkt, pcr)
+		}
+		if r.havePCR && !r.frozen && !Discontinuity(pkt) {
+			r.pcrStep = (pcr + pcrWrap - r.lastPCR) % pcrWrap
+		}
+		r.lastPCR = pcr
+		r.havePCR = true
+	}
+}
@@ -0,0 +1,212 @@
+package ts
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A step between PCRs longer than this, or backwards, is a
+// discontinuity (a loop or splice), not time passing
+const maxPCRStep = 1 * time.Second
+
+// DetectPacketSize finds the packet size of a TS that starts in head,
+// trying plain 188-byte MPEG-TS first and then the variants Validate
+// names, and returns it with the offset of the first sync byte.
+func DetectPacketSize(head []byte) (size, offset int, err error) {
+	for _, size := range append([]int{PacketSize}, otherSizes()...) {
+		count := min(16, len(head)/size-1)
+		if count < 1 && len(head) >= size {
+			// A single packet has nothing after it to confirm the sync with
+			count = 1
+		}
+		if off, ok := syncOffset(head, size, count); ok {
+			return size, off, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("this doesn't look like MPEG-TS: no 0x47 sync byte every 188, 192 or 204 bytes in the first %d bytes", len(head))
+}
+
+// PacketFormat describes a packet size DetectPacketSize returns.
+func PacketFormat(size int) string {
+	for _, other := range otherPacketSizes {
+		if other.size == size {
+			return other.name
+		}
+	}
+	return "MPEG-TS"
+}
+
+// otherSizes returns the sizes in otherPacketSizes.
+func otherSizes() []int {
+	var sizes []int
+	for _, other := range otherPacketSizes {
+		sizes = append(sizes, other.size)
+	}
+	return sizes
+}
+
+// StreamTypeName names a PMT stream_type, or returns "" if it is not one
+// commonly seen.
+func StreamTypeName(streamType byte) string {
+	switch streamType {
+	case 0x01:
+		return "MPEG-1 video"
+	case 0x02:
+		return "MPEG-2 video"
+	case 0x03:
+		return "MPEG-1 audio"
+	case 0x04:
+		return "MPEG-2 audio"
+	case 0x05:
+		return "private sections"
+	case 0x06:
+		return "private PES (e.g. subtitles, AC-3)"
+	case 0x0F:
+		return "AAC audio"
+	case 0x10:
+		return "MPEG-4 video"
+	case 0x11:
+		return "AAC LATM audio"
+	case 0x1B:
+		return "H.264 video"
+	case 0x1C:
+		return "MPEG-4 audio"
+	case 0x24:
+		return "HEVC video"
+	case 0x42:
+		return "AVS video"
+	case 0x81:
+		return "AC-3 audio"
+	case 0x87:
+		return "E-AC-3 audio"
+	case 0xD1:
+		return "Dirac video"
+	}
+	return ""
+}
+
+// PIDStats is what an Inspector counted on one PID.
+type PIDStats struct {
+	PID       uint16
+	Packets   uint64
+	CCErrors  uint64 // continuity counter jumps, packets lost or reordered
+	TEI       uint64 // packets flagged with transport_error_indicator
+	PCRs      uint64
+	MaxPCRGap time.Duration // longest interval between PCRs
+}
+
+// pidState follows one PID's continuity counter and PCRs.
+type pidState struct {
+	PIDStats
+	ccSeen  bool
+	lastCC  byte
+	pcrSeen bool
+	lastPCR uint64
+	pcrPos  uint64 // Inspector.Packets at lastPCR
+	pcrSpan uint64 // 27 MHz, summed over steps that were not discontinuities
+	pcrPkts uint64 // packets over the same steps
+}
+
+// Inspector accounts for a whole TS packet by packet: the PAT and PMT,
+// each PID's packet count, continuity errors and TEI flags, PSI sections
+// failing their CRC, and the PCRs, from which it works out the bitrate.
+type Inspector struct {
+	Layout    Layout
+	Packets   uint64
+	CRCErrors uint64 // PAT and PMT sections failing their CRC_32
+
+	pids map[uint16]*pidState
+}
+
+// NewInspector returns an empty Inspector.
+func NewInspector() *Inspector {
+	return &Inspector{pids: make(map[uint16]*pidState)}
+}
+
+// Add accounts for one 188-byte packet.
+func (in *Inspector) Add(pkt []byte) {
+	pid := PID(pkt)
+	st := in.pids[pid]
+	if st == nil {
+		st = &pidState{PIDStats: PIDStats{PID: pid}}
+		in.pids[pid] = st
+	}
+	st.Packets++
+	in.Packets++
+	if pkt[1]&0x80 != 0 {
+		// Nothing in it can be trusted, the counter included, so
+		// continuity is picked up again from the next packet
+		st.TEI++
+		st.ccSeen = false
+		return
+	}
+
+	// The counter steps on packets with a payload, may repeat for a
+	// duplicate, and restarts where the discontinuity_indicator is set
+	if pid != NullPID && HasPayload(pkt) {
+		cc := ContinuityCounter(pkt)
+		if st.ccSeen && !Discontinuity(pkt) && cc != st.lastCC && cc != (st.lastCC+1)&0x0F {
+			st.CCErrors++
+		}
+		st.ccSeen, st.lastCC = true, cc
+	}
+
+	if HasPCR(pkt) {
+		pcr := PCR(pkt)
+		if st.pcrSeen && !Discontinuity(pkt) && pcr > st.lastPCR {
+			if step := pcr - st.lastPCR; float64(step) < maxPCRStep.Seconds()*PCRClock {
+				st.pcrSpan += step
+				st.pcrPkts += in.Packets - st.pcrPos
+				if gap := time.Duration(float64(step) / PCRClock * float64(time.Second)); gap > st.MaxPCRGap {
+					st.MaxPCRGap = gap
+				}
+			}
+		}
+		st.PCRs++
+		st.pcrSeen, st.lastPCR, st.pcrPos = true, pcr, in.Packets
+	}
+
+	if in.isPSI(pid) && PayloadUnitStart(pkt) {
+		if s := section(pkt); s != nil && CRC32(s) != 0 {
+			in.CRCErrors++
+			return // keep a corrupt table out of the layout
+		}
+	}
+	in.Layout.Add(pkt)
+}
+
+// isPSI reports whether pid carries the PAT or a PMT.
+func (in *Inspector) isPSI(pid uint16) bool {
+	if pid == PATPID {
+		return true
+	}
+	for _, pmt := range in.Layout.PMTPIDs {
+		if pid == pmt {
+			return true
+		}
+	}
+	return false
+}
+
+// PIDs returns the counts for every PID seen, in PID order.
+func (in *Inspector) PIDs() []PIDStats {
+	stats := make([]PIDStats, 0, len(in.pids))
+	for _, st := range in.pids {
+		stats = append(stats, st.PIDStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].PID < stats[j].PID })
+	return stats
+}
+
+// Bitrate returns the mux rate in bits/s, from the packets sent between
+// successive PCRs on pcrPID, and the play time those PCRs span; ok is
+// false without at least two PCRs in sequence.
+func (in *Inspector) Bitrate(pcrPID uint16) (bitrate float64, duration time.Duration, ok bool) {
+	st := in.pids[pcrPID]
+	if st == nil || st.pcrSpan == 0 {
+		return 0, 0, false
+	}
+	secs := float64(st.pcrSpan) / PCRClock
+	return float64(st.pcrPkts*PacketSize*8) / secs, time.Duration(secs * float64(time.Second)), true
+}
@@ -0,0 +1,34 @@
+package ts
+
+import "testing"
+
+func TestDetectPacketSize(t *testing.T) {
+	packets := func(size, n, junk int) []byte {
+		data := make([]byte, junk+size*n)
+		for i := 0; i < n; i++ {
+			data[junk+i*size] = SyncByte
+		}
+		return data
+	}
+	tests := []struct {
+		name       string
+		head       []byte
+		wantSize   int
+		wantOffset int
+	}{
+		{"one packet", NullPacket(), PacketSize, 0},
+		{"many packets", packets(PacketSize, 20, 0), PacketSize, 0},
+		{"after junk", packets(PacketSize, 20, 5), PacketSize, 5},
+		{"M2TS", packets(192, 20, 4), 192, 4},
+		{"with RS parity", packets(204, 20, 0), 204, 0},
+	}
+	for _, tt := range tests {
+		size, offset, err := DetectPacketSize(tt.head)
+		if err != nil || size != tt.wantSize || offset != tt.wantOffset {
+			t.Errorf("%s: got %d, %d, %v, want %d, %d", tt.name, size, offset, err, tt.wantSize, tt.wantOffset)
+		}
+	}
+	if _, _, err := DetectPacketSize(make([]byte, 100)); err == nil {
+		t.Error("less than a packet detected as TS")
+	}
+}
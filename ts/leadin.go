@@ -0,0 +1,18 @@
+package ts
+
+import (
+	"bytes"
+	"io"
+)
+
+// NewLeadIn returns a reader that yields n null packets and then src. Null
+// packets are a complete, valid stream that every receiver discards, so a
+// scanning receiver can acquire carrier, symbol timing, Viterbi and packet
+// sync on them before the content starts instead of on its first frames.
+func NewLeadIn(src io.Reader, n int) io.Reader {
+	nulls := make([]byte, 0, n*PacketSize)
+	for i := 0; i < n; i++ {
+		nulls = append(nulls, NullPacket()...)
+	}
+	return io.MultiReader(bytes.NewReader(nulls), src)
+}
@@ -0,0 +1,238 @@
+package ts
+
+import (
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyCap keeps the delay through the transmitter short for interactive
+// use, at the cost of a glitch now and then. Whenever the buffer ahead of
+// it, as behind reports it, holds more than the limit, it skips to the
+// next keyframe: the video up to the next random access point is dropped,
+// and every other elementary stream up to its first PES at or after that
+// keyframe's PTS, so sound and picture resume together. PSI, SI and
+// anything outside the PMT pass through, but for input null packets,
+// which are dropped while over the limit. A skip never starts until the
+// keyframe the last one ended on has gone out whole, so under sustained
+// overload only keyframes are sent. The first PCR after a skip is
+// flagged as a discontinuity, as the clock jumps by what was dropped, and
+// continuity counters are renumbered on every packet.
+//
+// While skipping, dropped packets are replaced with null packets if the
+// buffer falls below floor, so it never runs dry waiting for a keyframe.
+// A skip that finds no keyframe within maxGOPPackets (an encoder that
+// never sets the random access indicator) gives up and lets everything
+// through. A stream with no video, or before its PAT and PMT are seen, is
+// passed through untouched.
+type LatencyCap struct {
+	src    io.Reader
+	behind func() time.Duration
+	limit  time.Duration
+	floor  time.Duration
+
+	layout Layout
+	video  uint16          // the PID skipped to a keyframe, 0 until known
+	es     map[uint16]bool // elementary stream PIDs
+	pcrPID uint16
+
+	skipping  bool
+	resumed   map[uint16]bool // PIDs running again since the skip began
+	cut       uint64          // the keyframe's PTS, 90 kHz
+	haveCut   bool
+	first     uint64 // PTS of the first video PES dropped
+	haveFirst bool
+	markPCR   bool
+	settling  bool          // the keyframe's frame is still going out
+	behindAt  time.Duration // when the skip began
+	dropped   int
+
+	ccs     map[uint16]byte
+	skips   atomic.Uint64
+	skipped atomic.Int64 // video dropped, in nanoseconds of PTS
+
+	pkt     []byte
+	pending []byte
+}
+
+// NewLatencyCap caps the delay of src's content at limit, measured by
+// behind, falling back on null packets while skipping if behind drops
+// below floor.
+func NewLatencyCap(src io.Reader, behind func() time.Duration, limit, floor time.Duration) *LatencyCap {
+	return &LatencyCap{
+		src:    src,
+		behind: behind,
+		limit:  limit,
+		floor:  floor,
+		ccs:    make(map[uint16]byte),
+		pkt:    make([]byte, PacketSize),
+	}
+}
+
+// Read implements io.Reader.
+func (c *LatencyCap) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		pkt, err := c.next()
+		if err != nil {
+			return 0, err
+		}
+		c.pending = pkt
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *LatencyCap) next() ([]byte, error) {
+	for {
+		if _, err := io.ReadFull(c.src, c.pkt); err != nil {
+			return nil, err
+		}
+		if c.pkt[0] != SyncByte {
+			return c.pkt, nil
+		}
+		c.learn(c.pkt)
+		behind := time.Duration(0)
+		if c.video != 0 {
+			behind = c.behind()
+		}
+		pid := PID(c.pkt)
+		if behind > c.limit && pid == NullPID {
+			// Padding is the first thing to go
+			continue
+		}
+		if c.settling && pid == c.video && PayloadUnitStart(c.pkt) {
+			c.settling = false
+		}
+		if !c.skipping && !c.settling && behind > c.limit {
+			c.begin(behind)
+		}
+		if c.skipping && c.drop(c.pkt) {
+			if c.dropped++; c.dropped > maxGOPPackets {
+				log.Printf("Low latency: no keyframe within %d packets; giving up the skip", maxGOPPackets)
+				c.skipping = false
+			}
+			if c.behind() < c.floor {
+				return NullPacket(), nil
+			}
+			continue
+		}
+		c.restamp(c.pkt)
+		return c.pkt, nil
+	}
+}
+
+// learn reads the PAT and PMT until they are complete, then picks the
+// first program's video stream to skip on.
+func (c *LatencyCap) learn(pkt []byte) {
+	if c.es != nil {
+		return
+	}
+	c.layout.Add(pkt)
+	if !c.layout.Complete() {
+		return
+	}
+	c.es = make(map[uint16]bool)
+	for _, pmt := range c.layout.PMTPIDs {
+		for _, st := range c.layout.Streams[pmt] {
+			c.es[st.PID] = true
+		}
+	}
+	c.pcrPID = c.layout.PCRPIDs[c.layout.firstProgram()]
+	c.video = c.layout.videoPID()
+}
+
+// begin starts a skip.
+func (c *LatencyCap) begin(behind time.Duration) {
+	c.skipping = true
+	c.resumed = make(map[uint16]bool)
+	c.haveCut, c.haveFirst = false, false
+	c.markPCR = true
+	c.behindAt = behind
+	c.dropped = 0
+}
+
+// drop reports whether pkt is skipped, resuming each stream at its cue.
+func (c *LatencyCap) drop(pkt []byte) bool {
+	pid := PID(pkt)
+	if c.resumed[pid] || (!c.es[pid] && pid != c.pcrPID) {
+		return false
+	}
+	start := PayloadUnitStart(pkt)
+	switch {
+	case pid == c.video:
+		pts, _, ok, _ := PESTimestamps(Payload(pkt))
+		if start && RandomAccess(pkt) {
+			c.cut, c.haveCut = pts, ok
+			c.resume(pid)
+			return false
+		}
+		if start && ok && !c.haveFirst {
+			c.first, c.haveFirst = pts, true
+		}
+		return true
+	case !c.haveCut:
+		return true
+	case !c.es[pid]:
+		// A PCR PID of its own comes back with the video
+		c.resume(pid)
+		return false
+	case start:
+		pts, _, ok, _ := PESTimestamps(Payload(pkt))
+		if !ok || (pts+ptsWrap-c.cut)%ptsWrap < ptsWrap/2 {
+			c.resume(pid)
+			return false
+		}
+	}
+	return true
+}
+
+// resume puts pid back on air, ending the skip once every stream is.
+func (c *LatencyCap) resume(pid uint16) {
+	c.resumed[pid] = true
+	for es := range c.es {
+		if !c.resumed[es] {
+			return
+		}
+	}
+	if c.pcrPID != NullPID && !c.es[c.pcrPID] && !c.resumed[c.pcrPID] {
+		return
+	}
+	c.skipping = false
+	c.settling = true
+	c.skips.Add(1)
+	var skipped time.Duration
+	if c.haveCut && c.haveFirst {
+		skipped = time.Duration((c.cut+ptsWrap-c.first)%ptsWrap) * time.Second / 90000
+		c.skipped.Add(int64(skipped))
+	}
+	log.Printf("Low latency: %v behind, skipped %v of video to the next keyframe", c.behindAt.Round(time.Millisecond), skipped.Round(time.Millisecond))
+}
+
+// restamp renumbers the continuity counter and flags the first PCR after
+// a skip.
+func (c *LatencyCap) restamp(pkt []byte) {
+	pid := PID(pkt)
+	if last, ok := c.ccs[pid]; ok {
+		if HasPayload(pkt) {
+			last = (last + 1) & 0x0F
+		}
+		SetContinuityCounter(pkt, last)
+	}
+	c.ccs[pid] = ContinuityCounter(pkt)
+	if c.markPCR && HasPCR(pkt) {
+		SetDiscontinuity(pkt)
+		c.markPCR = false
+	}
+}
+
+// Skips returns the number of skips to a keyframe made.
+func (c *LatencyCap) Skips() uint64 {
+	return c.skips.Load()
+}
+
+// Skipped returns how much video the skips dropped, by its timestamps.
+func (c *LatencyCap) Skipped() time.Duration {
+	return time.Duration(c.skipped.Load())
+}
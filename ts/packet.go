@@ -0,0 +1,118 @@
+package ts
+
+// Helpers for reading and rewriting MPEG-TS packet headers (ISO/IEC 13818-1).
+// All functions operate in place on a single 188-byte packet.
+
+const (
+	PacketSize = 188
+	SyncByte   = 0x47
+	NullPID    = 0x1FFF
+
+	// PCRClock is the 27 MHz system clock the PCR is expressed in.
+	PCRClock = 27000000
+	// pcrWrap is the modulus of the 33-bit PCR base times 300.
+	pcrWrap = (1 << 33) * 300
+)
+
+// PID returns the 13-bit packet identifier.
+func PID(pkt []byte) uint16 {
+	return uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+}
+
+// PayloadUnitStart reports whether the payload_unit_start_indicator is set.
+func PayloadUnitStart(pkt []byte) bool {
+	return pkt[1]&0x40 != 0
+}
+
+// HasPayload reports whether the packet carries a payload.
+func HasPayload(pkt []byte) bool {
+	return pkt[3]&0x10 != 0
+}
+
+// HasAdaptationField reports whether the packet carries an adaptation field.
+func HasAdaptationField(pkt []byte) bool {
+	return pkt[3]&0x20 != 0 && pkt[4] > 0
+}
+
+// ContinuityCounter returns the 4-bit continuity counter.
+func ContinuityCounter(pkt []byte) byte {
+	return pkt[3] & 0x0F
+}
+
+// SetContinuityCounter overwrites the 4-bit continuity counter.
+func SetContinuityCounter(pkt []byte, cc byte) {
+	pkt[3] = pkt[3]&0xF0 | cc&0x0F
+}
+
+// RandomAccess reports whether the adaptation field marks a random access point (keyframe).
+func RandomAccess(pkt []byte) bool {
+	return HasAdaptationField(pkt) && pkt[5]&0x40 != 0
+}
+
+// Discontinuity reports whether the adaptation field's discontinuity_indicator is set.
+func Discontinuity(pkt []byte) bool {
+	return HasAdaptationField(pkt) && pkt[5]&0x80 != 0
+}
+
+// SetDiscontinuity sets the discontinuity_indicator if the packet has an adaptation field.
+func SetDiscontinuity(pkt []byte) bool {
+	if !HasAdaptationField(pkt) {
+		return false
+	}
+	pkt[5] |= 0x80
+	return true
+}
+
+// HasPCR reports whether the adaptation field carries a PCR.
+func HasPCR(pkt []byte) bool {
+	return HasAdaptationField(pkt) && pkt[4] >= 7 && pkt[5]&0x10 != 0
+}
+
+// PCR returns the program clock reference in 27 MHz ticks. Callers must check HasPCR first.
+func PCR(pkt []byte) uint64 {
+	base := uint64(pkt[6])<<25 | uint64(pkt[7])<<17 | uint64(pkt[8])<<9 | uint64(pkt[9])<<1 | uint64(pkt[10])>>7
+	ext := uint64(pkt[10]&0x01)<<8 | uint64(pkt[11])
+	return base*300 + ext
+}
+
+// SetPCR overwrites the PCR, wrapping at the 33-bit base boundary. Callers must check HasPCR first.
+func SetPCR(pkt []byte, pcr uint64) {
+	pcr %= pcrWrap
+	base := pcr / 300
+	ext := pcr % 300
+	pkt[6] = byte(base >> 25)
+	pkt[7] = byte(base >> 17)
+	pkt[8] = byte(base >> 9)
+	pkt[9] = byte(base >> 1)
+	pkt[10] = byte(base<<7) | 0x7E | byte(ext>>8)
+	pkt[11] = byte(ext)
+}
+
+// Payload returns the packet payload after the header and any adaptation
+// field, or nil if there is none.
+func Payload(pkt []byte) []byte {
+	if !HasPayload(pkt) {
+		return nil
+	}
+	start := 4
+	if pkt[3]&0x20 != 0 {
+		start += 1 + int(pkt[4])
+	}
+	if start >= PacketSize {
+		return nil
+	}
+	return pkt[start:]
+}
+
+// NullPacket returns a null (stuffing) packet.
+func NullPacket() []byte {
+	pkt := make([]byte, PacketSize)
+	pkt[0] = SyncByte
+	pkt[1] = byte(NullPID >> 8)
+	pkt[2] = byte(NullPID & 0xFF)
+	pkt[3] = 0x10 // payload only
+	for i := 4; i < PacketSize; i++ {
+		pkt[i] = 0xFF
+	}
+	return pkt
+}
@@ -0,0 +1,66 @@
+package ts
+
+import "io"
+
+// pcrByteOffset is where the last byte of program_clock_reference_base sits
+// in a packet carrying a PCR; the PCR describes the arrival of that byte.
+const pcrByteOffset = 10
+
+// PCRStamper rewrites every PCR so it matches the time its packet actually
+// leaves the modulator, derived from the output byte position and the
+// channel bitrate. Once packets are paced, looped or inserted the original
+// PCRs no longer match the transmit timing and PCR-strict receivers drift.
+type PCRStamper struct {
+	src     io.Reader
+	bitrate float64
+
+	pkt     []byte
+	pending []byte
+	pos     uint64
+
+	anchored bool
+	basePCR  uint64
+	basePos  uint64
+}
+
+// NewPCRStamper restamps packets read from src for a stream of the given
+// bitrate in bits/s.
+func NewPCRStamper(src io.Reader, bitrate float64) *PCRStamper {
+	return &PCRStamper{
+		src:     src,
+		bitrate: bitrate,
+		pkt:     make([]byte, PacketSize),
+	}
+}
+
+// Read implements io.Reader.
+func (s *PCRStamper) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		if _, err := io.ReadFull(s.src, s.pkt); err != nil {
+			return 0, err
+		}
+		s.Restamp(s.pkt)
+		s.pending = s.pkt
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Restamp rewrites the PCR of the next output packet, if it has one, and
+// advances the byte position. The first PCR (and any PCR flagged with a
+// discontinuity) anchors the clock; later ones are extrapolated from it.
+func (s *PCRStamper) Restamp(pkt []byte) {
+	if pkt[0] == SyncByte && HasPCR(pkt) {
+		pos := s.pos + pcrByteOffset
+		if !s.anchored || Discontinuity(pkt) {
+			s.basePCR = PCR(pkt)
+			s.basePos = pos
+			s.anchored = true
+		} else {
+			elapsed := float64(pos-s.basePos) * 8 * PCRClock / s.bitrate
+			SetPCR(pkt, s.basePCR+uint64(elapsed+0.5))
+		}
+	}
+	s.pos += PacketSize
+}
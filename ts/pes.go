@@ -0,0 +1,62 @@
+package ts
+
+// ptsWrap is the modulus of the 33-bit PTS/DTS.
+const ptsWrap = 1 << 33
+
+// PESTimestamps returns the PTS and DTS (90 kHz) from the start of a PES
+// packet, as found in the payload of a packet with PayloadUnitStart set.
+func PESTimestamps(payload []byte) (pts, dts uint64, hasPTS, hasDTS bool) {
+	flags, ok := pesTimestampFlags(payload)
+	if !ok {
+		return 0, 0, false, false
+	}
+	if flags&0x2 != 0 {
+		pts, hasPTS = readTimestamp(payload[9:]), true
+	}
+	if flags == 0x3 {
+		dts, hasDTS = readTimestamp(payload[14:]), true
+	}
+	return pts, dts, hasPTS, hasDTS
+}
+
+// ShiftPESTimestamps adds delta (90 kHz, modulo 2^33) to the PTS and DTS at
+// the start of a PES packet, if present.
+func ShiftPESTimestamps(payload []byte, delta uint64) {
+	flags, ok := pesTimestampFlags(payload)
+	if !ok {
+		return
+	}
+	if flags&0x2 != 0 {
+		writeTimestamp(payload[9:], (readTimestamp(payload[9:])+delta)%ptsWrap)
+	}
+	if flags == 0x3 {
+		writeTimestamp(payload[14:], (readTimestamp(payload[14:])+delta)%ptsWrap)
+	}
+}
+
+// pesTimestampFlags returns the PTS_DTS_flags of a PES header carrying the
+// optional header fields.
+func pesTimestampFlags(p []byte) (byte, bool) {
+	if len(p) < 19 || p[0] != 0 || p[1] != 0 || p[2] != 1 {
+		return 0, false
+	}
+	switch p[3] {
+	case 0xBC, 0xBE, 0xBF, 0xF0, 0xF1, 0xF2, 0xF8, 0xFF:
+		// Stream types without the optional PES header
+		return 0, false
+	}
+	return p[7] >> 6, true
+}
+
+func readTimestamp(b []byte) uint64 {
+	return uint64(b[0]>>1&0x07)<<30 | uint64(b[1])<<22 | uint64(b[2]>>1)<<15 | uint64(b[3])<<7 | uint64(b[4]>>1)
+}
+
+// writeTimestamp keeps the 4-bit prefix and sets the marker bits.
+func writeTimestamp(b []byte, ts uint64) {
+	b[0] = b[0]&0xF0 | byte(ts>>29)&0x0E | 0x01
+	b[1] = byte(ts >> 22)
+	b[2] = byte(ts>>14) | 0x01
+	b[3] = byte(ts >> 7)
+	b[4] = byte(ts<<1) | 0x01
+}
@@ -0,0 +1,224 @@
+package ts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+)
+
+const (
+	// Packets read ahead at the start of each file to find its PSI, first
+	// PCR and first PTS before the first packet is played.
+	playlistLookahead = 20000
+
+	// Minimum spacing between the last presentation time of one file and
+	// the first of the next (one 25 fps frame).
+	playlistFrameGap = 90000 / 25
+)
+
+// Playlist plays a list of TS files back to back, forever, as one
+// continuous stream. Continuity counters run on across file boundaries;
+// PCR, PTS and DTS are shifted so the clock carries straight on, and null
+// packets are inserted where the next file would otherwise start presenting
+// before the previous one has finished. All files must share the PID layout
+// of the first.
+type Playlist struct {
+	paths   []string
+	bitrate float64
+
+	index  int
+	file   *os.File
+	reader *bufio.Reader
+	queue  [][]byte
+	layout string
+
+	ccs     map[uint16]byte
+	offset  uint64 // 27 MHz, added to every PCR (PTS/DTS get offset/300)
+	pos     uint64 // output bytes so far
+	havePCR bool
+	lastPCR uint64 // in output time
+	pcrPos  uint64 // output byte position of lastPCR
+	havePTS bool
+	maxPTS  uint64 // latest PTS/DTS so far, in output time
+
+	pending []byte
+}
+
+// NewPlaylist opens the first file of paths for a channel of the given
+// bitrate in bits/s, which the files are expected to be muxed at.
+func NewPlaylist(paths []string, bitrate float64) (*Playlist, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("playlist is empty")
+	}
+	p := &Playlist{
+		paths:   paths,
+		bitrate: bitrate,
+		index:   -1,
+		ccs:     make(map[uint16]byte),
+	}
+	if err := p.openNext(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Read implements io.Reader.
+func (p *Playlist) Read(b []byte) (int, error) {
+	if len(p.pending) == 0 {
+		pkt, err := p.next()
+		if err != nil {
+			return 0, err
+		}
+		p.restamp(pkt)
+		p.pending = pkt
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func (p *Playlist) next() ([]byte, error) {
+	for {
+		if len(p.queue) > 0 {
+			pkt := p.queue[0]
+			p.queue = p.queue[1:]
+			return pkt, nil
+		}
+		pkt := make([]byte, PacketSize)
+		if _, err := io.ReadFull(p.reader, pkt); err == nil {
+			return pkt, nil
+		} else if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%s: %w", p.paths[p.index], err)
+		}
+		if err := p.openNext(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// openNext moves on to the next file and works out the timestamp offset
+// and null padding that join it seamlessly to what has been played.
+func (p *Playlist) openNext() error {
+	if p.file != nil {
+		p.file.Close()
+	}
+	p.index = (p.index + 1) % len(p.paths)
+	path := p.paths[p.index]
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	p.file = f
+	p.reader = bufio.NewReaderSize(f, 1<<16)
+
+	var layout Layout
+	var firstPCR, firstPTS uint64
+	pcrIndex, havePTS := -1, false
+	for len(p.queue) < playlistLookahead && !(layout.Complete() && pcrIndex >= 0 && havePTS) {
+		pkt := make([]byte, PacketSize)
+		if _, err := io.ReadFull(p.reader, pkt); err != nil {
+			break
+		}
+		if pkt[0] != SyncByte {
+			return fmt.Errorf("%s: lost TS sync at packet %d", path, len(p.queue))
+		}
+		layout.Add(pkt)
+		if pcrIndex < 0 && HasPCR(pkt) {
+			pcrIndex, firstPCR = len(p.queue), PCR(pkt)
+		}
+		if !havePTS && PayloadUnitStart(pkt) {
+			if pts, _, ok, _ := PESTimestamps(Payload(pkt)); ok {
+				firstPTS, havePTS = pts, true
+			}
+		}
+		p.queue = append(p.queue, pkt)
+	}
+	if len(p.queue) == 0 {
+		return fmt.Errorf("%s: no TS packets", path)
+	}
+	if !layout.Complete() {
+		return fmt.Errorf("%s: no PAT/PMT in the first %d packets", path, len(p.queue))
+	}
+	if p.layout == "" {
+		p.layout = layout.String()
+	} else if l := layout.String(); l != p.layout {
+		return fmt.Errorf("%s: PID layout differs from the first file (%s vs %s); remux it to match", path, l, p.layout)
+	}
+
+	if !p.havePCR || pcrIndex < 0 {
+		p.offset = 0
+		log.Printf("Playlist: %s", path)
+		return nil
+	}
+
+	// Place the new file's first PCR where the channel clock will be when
+	// that packet goes out, then push it back with nulls if its first
+	// picture would come before the previous file's last.
+	offsetFor := func(nulls int) uint64 {
+		at := p.pos + uint64(nulls+pcrIndex)*PacketSize + pcrByteOffset
+		want := p.lastPCR + p.ticks(at-p.pcrPos)
+		return (want + pcrWrap - firstPCR) % pcrWrap
+	}
+	nulls := 0
+	p.offset = offsetFor(0)
+	if havePTS && p.havePTS {
+		start := (firstPTS + p.offset/300) % ptsWrap
+		if short := (p.maxPTS + playlistFrameGap + ptsWrap - start) % ptsWrap; short > 0 && short < ptsWrap/2 {
+			perPacket := PacketSize * 8 * 90000 / p.bitrate
+			nulls = int(math.Ceil(float64(short) / perPacket))
+			p.offset = offsetFor(nulls)
+		}
+	}
+	if nulls > 0 {
+		padded := make([][]byte, 0, nulls+len(p.queue))
+		for range nulls {
+			padded = append(padded, NullPacket())
+		}
+		p.queue = append(padded, p.queue...)
+	}
+	log.Printf("Playlist: %s (%d null packets to bridge the join)", path, nulls)
+	return nil
+}
+
+// ticks converts a number of output bytes into 27 MHz clock ticks.
+func (p *Playlist) ticks(bytes uint64) uint64 {
+	return uint64(float64(bytes)*8*PCRClock/p.bitrate + 0.5)
+}
+
+// restamp renumbers the continuity counter and shifts the timestamps of
+// the next output packet.
+func (p *Playlist) restamp(pkt []byte) {
+	pid := PID(pkt)
+	if pid != NullPID {
+		if last, ok := p.ccs[pid]; ok {
+			if HasPayload(pkt) {
+				last = (last + 1) & 0x0F
+			}
+			SetContinuityCounter(pkt, last)
+		}
+		p.ccs[pid] = ContinuityCounter(pkt)
+	}
+
+	if HasPCR(pkt) {
+		pcr := (PCR(pkt) + p.offset) % pcrWrap
+		SetPCR(pkt, pcr)
+		p.lastPCR, p.pcrPos, p.havePCR = pcr, p.pos+pcrByteOffset, true
+	}
+	if PayloadUnitStart(pkt) && pid != NullPID {
+		payload := Payload(pkt)
+		ShiftPESTimestamps(payload, p.offset/300)
+		pts, dts, hasPTS, hasDTS := PESTimestamps(payload)
+		for _, t := range []struct {
+			v  uint64
+			ok bool
+		}{{pts, hasPTS}, {dts, hasDTS}} {
+			if t.ok && (!p.havePTS || (t.v-p.maxPTS)%ptsWrap < ptsWrap/2) {
+				p.maxPTS, p.havePTS = t.v, true
+			}
+		}
+	}
+	p.pos += PacketSize
+}
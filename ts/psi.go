@@ -0,0 +1,151 @@
+package ts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PID of the program association table.
+const PATPID = 0x0000
+
+// Stream is one elementary stream listed in a PMT.
+type Stream struct {
+	Type byte
+	PID  uint16
+}
+
+// section returns the PSI section starting in a packet with PayloadUnitStart
+// set, or nil if it does not fit in the packet.
+func section(pkt []byte) []byte {
+	p := Payload(pkt)
+	if len(p) < 1 || !PayloadUnitStart(pkt) {
+		return nil
+	}
+	p = p[1+int(p[0]):] // pointer_field
+	if len(p) < 3 {
+		return nil
+	}
+	n := 3 + (int(p[1]&0x0F)<<8 | int(p[2]))
+	if n > len(p) {
+		return nil
+	}
+	return p[:n]
+}
+
+// ParsePAT returns the PMT PID of every program in a PAT packet.
+func ParsePAT(pkt []byte) (map[uint16]uint16, bool) {
+	s := section(pkt)
+	if len(s) < 12 || s[0] != 0x00 {
+		return nil, false
+	}
+	programs := make(map[uint16]uint16)
+	for i := 8; i+4 <= len(s)-4; i += 4 {
+		num := uint16(s[i])<<8 | uint16(s[i+1])
+		if num != 0 { // program 0 is the network PID
+			programs[num] = uint16(s[i+2]&0x1F)<<8 | uint16(s[i+3])
+		}
+	}
+	return programs, true
+}
+
+// ParsePMT returns the PCR PID and elementary streams of a PMT packet.
+func ParsePMT(pkt []byte) (pcrPID uint16, streams []Stream, ok bool) {
+	s := section(pkt)
+	if len(s) < 16 || s[0] != 0x02 {
+		return 0, nil, false
+	}
+	pcrPID = uint16(s[8]&0x1F)<<8 | uint16(s[9])
+	i := 12 + (int(s[10]&0x0F)<<8 | int(s[11]))
+	for i+5 <= len(s)-4 {
+		streams = append(streams, Stream{
+			Type: s[i],
+			PID:  uint16(s[i+1]&0x1F)<<8 | uint16(s[i+2]),
+		})
+		i += 5 + (int(s[i+3]&0x0F)<<8 | int(s[i+4]))
+	}
+	return pcrPID, streams, true
+}
+
+// Layout summarises the PIDs of a transport stream's programs.
+type Layout struct {
+	PMTPIDs map[uint16]uint16 // program number -> PMT PID
+	PCRPIDs map[uint16]uint16 // PMT PID -> PCR PID
+	Streams map[uint16][]Stream
+}
+
+// Complete reports whether a PMT has been seen for every program.
+func (l *Layout) Complete() bool {
+	if l.PMTPIDs == nil {
+		return false
+	}
+	for _, pid := range l.PMTPIDs {
+		if _, ok := l.Streams[pid]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Add feeds one packet into the layout.
+func (l *Layout) Add(pkt []byte) {
+	pid := PID(pkt)
+	if pid == PATPID && l.PMTPIDs == nil {
+		if programs, ok := ParsePAT(pkt); ok {
+			l.PMTPIDs = programs
+			l.PCRPIDs = make(map[uint16]uint16)
+			l.Streams = make(map[uint16][]Stream)
+		}
+		return
+	}
+	for _, pmt := range l.PMTPIDs {
+		if pid == pmt {
+			if _, seen := l.Streams[pid]; !seen {
+				if pcr, streams, ok := ParsePMT(pkt); ok {
+					l.PCRPIDs[pid] = pcr
+					l.Streams[pid] = streams
+				}
+			}
+			return
+		}
+	}
+}
+
+// firstProgram returns the PMT PID of the lowest-numbered program.
+func (l *Layout) firstProgram() uint16 {
+	var first uint16
+	for num := range l.PMTPIDs {
+		if first == 0 || num < first {
+			first = num
+		}
+	}
+	return l.PMTPIDs[first]
+}
+
+// videoPID returns the first video stream of the lowest-numbered program,
+// or 0 if it has none.
+func (l *Layout) videoPID() uint16 {
+	for _, st := range l.Streams[l.firstProgram()] {
+		if StreamKind(st.Type) == "video" {
+			return st.PID
+		}
+	}
+	return 0
+}
+
+// String describes the layout, in a canonical order so two layouts can be
+// compared by their strings.
+func (l *Layout) String() string {
+	var programs []string
+	for num, pmt := range l.PMTPIDs {
+		var es []string
+		for _, st := range l.Streams[pmt] {
+			es = append(es, fmt.Sprintf("0x%x(type 0x%02x)", st.PID, st.Type))
+		}
+		sort.Strings(es)
+		programs = append(programs, fmt.Sprintf("program %d: PMT 0x%x, PCR 0x%x, %s",
+			num, pmt, l.PCRPIDs[pmt], strings.Join(es, " ")))
+	}
+	sort.Strings(programs)
+	return strings.Join(programs, "; ")
+}
@@ -0,0 +1,32 @@
+package ts
+
+import "fmt"
+
+// Repeater supplies the same packet forever, byte for byte: the continuity
+// counter is not advanced, so the encoder sees identical input every time.
+type Repeater struct {
+	pkt []byte
+	pos int
+}
+
+// NewRepeater repeats pkt, which must be one whole TS packet.
+func NewRepeater(pkt []byte) (*Repeater, error) {
+	if len(pkt) != PacketSize {
+		return nil, fmt.Errorf("packet is %d bytes, want %d", len(pkt), PacketSize)
+	}
+	if pkt[0] != SyncByte {
+		return nil, fmt.Errorf("packet starts with %#02x, not the 0x47 sync byte", pkt[0])
+	}
+	return &Repeater{pkt: append([]byte(nil), pkt...)}, nil
+}
+
+// Read implements io.Reader. It never returns an error.
+func (r *Repeater) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.pkt[r.pos:])
+		n += c
+		r.pos = (r.pos + c) % PacketSize
+	}
+	return n, nil
+}
@@ -0,0 +1,125 @@
+package ts
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Pacing slack: packets are released early by up to this much, so the
+	// smoother sleeps a few times a second rather than once per packet.
+	smootherSlack = 10 * time.Millisecond
+
+	// The smoother runs this fraction faster than the nominal bitrate so the
+	// radio's clock, which is not the system clock, never outpaces it and
+	// slowly drains the sample buffer.
+	smootherHeadroom = 0.002
+)
+
+// Smoother is a leaky bucket in front of the modulator. Packets from the
+// source are queued in a bucket and released at a strict maximum rate of
+// the channel bitrate, so encoder bursts are spread out instead of arriving
+// at the sample buffer all at once. When the bucket is empty a null packet
+// goes out in its place; while it holds a backlog the source's own null
+// packets are dropped so that the bucket drains after a burst.
+type Smoother struct {
+	packets chan []byte
+	err     error
+	bitrate float64
+
+	start time.Time
+	sent  uint64 // packets released since start
+
+	padded  atomic.Uint64
+	dropped atomic.Uint64
+
+	pending []byte
+}
+
+// NewSmoother starts reading 188-byte packets from src in the background
+// into a bucket holding depth worth of packets at bitrate (bits/s). A full
+// bucket stops reading from src until it drains.
+func NewSmoother(src io.Reader, bitrate float64, depth time.Duration) *Smoother {
+	size := max(1, int(depth.Seconds()*bitrate/(PacketSize*8)))
+	s := &Smoother{
+		packets: make(chan []byte, size),
+		bitrate: bitrate * (1 + smootherHeadroom),
+	}
+	go func() {
+		for {
+			pkt := make([]byte, PacketSize)
+			if _, err := io.ReadFull(src, pkt); err != nil {
+				s.err = err
+				close(s.packets)
+				return
+			}
+			if pkt[0] == SyncByte && PID(pkt) == NullPID && len(s.packets) > cap(s.packets)/4 {
+				s.dropped.Add(1)
+				continue
+			}
+			s.packets <- pkt
+		}
+	}()
+	return s
+}
+
+// Read implements io.Reader.
+func (s *Smoother) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		pkt, err := s.next()
+		if err != nil {
+			return 0, err
+		}
+		s.pending = pkt
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *Smoother) next() ([]byte, error) {
+	s.pace()
+	select {
+	case pkt, ok := <-s.packets:
+		if !ok {
+			return nil, s.err
+		}
+		return pkt, nil
+	default:
+		s.padded.Add(1)
+		return NullPacket(), nil
+	}
+}
+
+// pace waits until the next packet is due at the bucket's leak rate. If the
+// reader has fallen behind (the sample buffer was full) the schedule is
+// moved up rather than caught up with a burst.
+func (s *Smoother) pace() {
+	now := time.Now()
+	if s.start.IsZero() {
+		s.start = now
+	}
+	due := s.start.Add(time.Duration(float64(s.sent) * PacketSize * 8 / s.bitrate * float64(time.Second)))
+	if wait := due.Sub(now); wait > smootherSlack {
+		time.Sleep(wait)
+	} else if wait < -smootherSlack {
+		s.start, s.sent = now, 0
+	}
+	s.sent++
+}
+
+// Backlog returns the number of packets waiting in the bucket.
+func (s *Smoother) Backlog() int {
+	return len(s.packets)
+}
+
+// Padded returns the number of null packets sent because the bucket was empty.
+func (s *Smoother) Padded() uint64 {
+	return s.padded.Load()
+}
+
+// Dropped returns the number of source null packets dropped to drain a backlog.
+func (s *Smoother) Dropped() uint64 {
+	return s.dropped.Load()
+}
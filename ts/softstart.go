@@ -0,0 +1,83 @@
+package ts
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// KeyframeGate discards packets until the first random access point (the
+// start of a GOP) of the first program's video stream, learnt from the PAT
+// and PMT, so transmission begins with a decodable picture, and the
+// encoder's startup burst of unusable packets never reaches the buffer.
+type KeyframeGate struct {
+	src     io.Reader
+	timeout time.Duration
+
+	layout Layout
+	video  uint16 // 0 until known
+
+	open      bool
+	discarded int
+	pkt       []byte
+	pending   []byte
+}
+
+// NewKeyframeGate gates src until its first keyframe. If none is seen within
+// timeout of the first packet (some encoders never set the random access
+// indicator) the gate opens anyway.
+func NewKeyframeGate(src io.Reader, timeout time.Duration) *KeyframeGate {
+	return &KeyframeGate{
+		src:     src,
+		timeout: timeout,
+		pkt:     make([]byte, PacketSize),
+	}
+}
+
+// Read implements io.Reader.
+func (g *KeyframeGate) Read(p []byte) (int, error) {
+	if !g.open {
+		if err := g.waitForKeyframe(); err != nil {
+			return 0, err
+		}
+	}
+	if len(g.pending) > 0 {
+		n := copy(p, g.pending)
+		g.pending = g.pending[n:]
+		return n, nil
+	}
+	return g.src.Read(p)
+}
+
+func (g *KeyframeGate) waitForKeyframe() error {
+	var deadline time.Time
+	for {
+		if _, err := io.ReadFull(g.src, g.pkt); err != nil {
+			return err
+		}
+		if deadline.IsZero() {
+			deadline = time.Now().Add(g.timeout)
+		}
+		if g.pkt[0] == SyncByte && g.video == 0 {
+			g.layout.Add(g.pkt)
+			if g.layout.Complete() {
+				if g.video = g.layout.videoPID(); g.video == 0 {
+					log.Printf("Soft start: no video stream to wait for, starting after %d discarded packets", g.discarded)
+					break
+				}
+			}
+		}
+		if g.video != 0 && PID(g.pkt) == g.video && PayloadUnitStart(g.pkt) && RandomAccess(g.pkt) {
+			log.Printf("Soft start: first keyframe after %d discarded packets", g.discarded)
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Printf("Soft start: no keyframe within %v, starting anyway", g.timeout)
+			break
+		}
+		g.discarded++
+	}
+	g.open = true
+	g.pending = g.pkt
+	return nil
+}
@@ -0,0 +1,96 @@
+package ts
+
+import "io"
+
+// StreamKind names what a PMT stream_type carries: "video", "audio", or ""
+// for anything else, such as private data.
+func StreamKind(streamType byte) string {
+	switch streamType {
+	case 0x01, 0x02, 0x10, 0x1B, 0x24, 0x42, 0xD1:
+		return "video"
+	case 0x03, 0x04, 0x0F, 0x11, 0x1C, 0x81, 0x87:
+		return "audio"
+	}
+	return ""
+}
+
+// StreamActivity is what a StreamCheck saw of one elementary stream.
+type StreamActivity struct {
+	Stream
+	Kind string // as StreamKind
+	PES  int    // PES packets started within the window
+}
+
+// StreamCheck passes a TS through unchanged while watching its first
+// packets for PES on every elementary stream the PMTs list, catching an
+// encoder that never produced a stream (a wrong device, a muted microphone)
+// before anyone tunes in. Null packets do not count towards the window.
+type StreamCheck struct {
+	src    io.Reader
+	window int
+
+	layout  Layout
+	starts  map[uint16]int
+	packets int
+	result  []StreamActivity
+	done    chan struct{}
+
+	pkt     []byte
+	pending []byte
+}
+
+// NewStreamCheck watches the first window non-null packets of src.
+func NewStreamCheck(src io.Reader, window int) *StreamCheck {
+	return &StreamCheck{
+		src:    src,
+		window: window,
+		starts: make(map[uint16]int),
+		done:   make(chan struct{}),
+		pkt:    make([]byte, PacketSize),
+	}
+}
+
+// Read implements io.Reader.
+func (c *StreamCheck) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		if _, err := io.ReadFull(c.src, c.pkt); err != nil {
+			return 0, err
+		}
+		c.watch(c.pkt)
+		c.pending = c.pkt
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *StreamCheck) watch(pkt []byte) {
+	if c.packets >= c.window || pkt[0] != SyncByte || PID(pkt) == NullPID {
+		return
+	}
+	c.layout.Add(pkt)
+	if PayloadUnitStart(pkt) {
+		c.starts[PID(pkt)]++
+	}
+	if c.packets++; c.packets < c.window {
+		return
+	}
+	for _, pmt := range c.layout.PMTPIDs {
+		for _, st := range c.layout.Streams[pmt] {
+			c.result = append(c.result, StreamActivity{Stream: st, Kind: StreamKind(st.Type), PES: c.starts[st.PID]})
+		}
+	}
+	close(c.done)
+}
+
+// Done is closed once the window has passed.
+func (c *StreamCheck) Done() <-chan struct{} {
+	return c.done
+}
+
+// Result returns the elementary streams the PMTs listed and the PES seen on
+// each, once Done is closed; ok is false if no PAT and PMTs were found at
+// all.
+func (c *StreamCheck) Result() (streams []StreamActivity, ok bool) {
+	return c.result, c.layout.Complete()
+}
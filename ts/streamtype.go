@@ -0,0 +1,102 @@
+package ts
+
+import (
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+)
+
+// PCRStream is the StreamTypeRewriter key for whichever elementary stream
+// carries the PCR, the video in FFmpeg's output. It is outside the 13-bit
+// PID range, so it cannot clash with a real PID.
+const PCRStream = 0xFFFF
+
+// StreamTypeRewriter rewrites the stream_type PMTs advertise for chosen
+// elementary streams, recomputing each section's CRC, so that receivers
+// pick the right decoder for a codec the muxer tagged wrongly. Only
+// sections that fit in one packet are rewritten, as FFmpeg's always do.
+type StreamTypeRewriter struct {
+	src   io.Reader
+	types map[uint16]byte // ES PID or PCRStream -> stream_type
+	pmts  map[uint16]bool
+
+	pkt     []byte
+	pending []byte
+
+	rewritten atomic.Uint64
+}
+
+// NewStreamTypeRewriter rewrites the PMTs in src, advertising types[pid]
+// for each listed elementary stream PID.
+func NewStreamTypeRewriter(src io.Reader, types map[uint16]byte) *StreamTypeRewriter {
+	return &StreamTypeRewriter{
+		src:   src,
+		types: types,
+		pmts:  make(map[uint16]bool),
+		pkt:   make([]byte, PacketSize),
+	}
+}
+
+// Read implements io.Reader.
+func (r *StreamTypeRewriter) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if _, err := io.ReadFull(r.src, r.pkt); err != nil {
+			return 0, err
+		}
+		r.Rewrite(r.pkt)
+		r.pending = r.pkt
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Rewrite applies the stream types to pkt in place if it is a PMT. The PAT
+// is followed so that the PMT PIDs are known.
+func (r *StreamTypeRewriter) Rewrite(pkt []byte) {
+	if pkt[0] != SyncByte {
+		return
+	}
+	pid := PID(pkt)
+	if pid == PATPID {
+		if programs, ok := ParsePAT(pkt); ok {
+			clear(r.pmts)
+			for _, pmt := range programs {
+				r.pmts[pmt] = true
+			}
+		}
+		return
+	}
+	if !r.pmts[pid] {
+		return
+	}
+	s := section(pkt)
+	if len(s) < 16 || s[0] != 0x02 || CRC32(s) != 0 {
+		return
+	}
+	pcrPID := uint16(s[8]&0x1F)<<8 | uint16(s[9])
+	changed := false
+	i := 12 + (int(s[10]&0x0F)<<8 | int(s[11]))
+	for i+5 <= len(s)-4 {
+		es := uint16(s[i+1]&0x1F)<<8 | uint16(s[i+2])
+		t, ok := r.types[es]
+		if !ok && es == pcrPID {
+			t, ok = r.types[PCRStream]
+		}
+		if ok && s[i] != t {
+			s[i] = t
+			changed = true
+		}
+		i += 5 + (int(s[i+3]&0x0F)<<8 | int(s[i+4]))
+	}
+	if changed {
+		body := s[:len(s)-4]
+		binary.BigEndian.PutUint32(s[len(body):], CRC32(body))
+		r.rewritten.Add(1)
+	}
+}
+
+// Rewritten returns the number of PMT sections rewritten.
+func (r *StreamTypeRewriter) Rewritten() uint64 {
+	return r.rewritten.Load()
+}
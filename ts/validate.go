@@ -0,0 +1,72 @@
+package ts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Packet sizes of TS variants that are not plain 188-byte MPEG-TS, which
+// Validate names in its error so the fix is obvious
+var otherPacketSizes = []struct {
+	size int
+	name string
+}{
+	{192, "M2TS (Blu-ray/AVCHD, 4-byte timecode before each packet)"},
+	{204, "TS with 16 Reed-Solomon bytes per packet (a DVB capture)"},
+}
+
+// Validate reads the first n packets of r and checks that the sync byte
+// recurs every PacketSize bytes, allowing the stream to start part way
+// into a packet. It returns a reader that yields the stream from the first
+// whole packet on, with the checked packets put back in front, or an error
+// describing what the input looks like instead.
+func Validate(r io.Reader, n int) (io.Reader, error) {
+	head := make([]byte, (n+1)*PacketSize)
+	got, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:got]
+	if len(head) < PacketSize {
+		return nil, fmt.Errorf("the input ended after %d bytes, not even one TS packet", len(head))
+	}
+	whole := min(n, len(head)/PacketSize-1)
+	if whole < 1 {
+		whole = 1
+	}
+	if off, ok := syncOffset(head, PacketSize, whole); ok {
+		return io.MultiReader(bytes.NewReader(head[off:]), r), nil
+	}
+	for _, other := range otherPacketSizes {
+		if _, ok := syncOffset(head, other.size, len(head)/other.size-1); ok {
+			return nil, fmt.Errorf("the input has %d-byte packets: %s; remux it to 188-byte MPEG-TS (e.g. ffmpeg -i in -c copy -f mpegts out.ts)", other.size, other.name)
+		}
+	}
+	return nil, fmt.Errorf("this doesn't look like MPEG-TS: no 0x47 sync byte every %d bytes in the first %d bytes (starts % x)",
+		PacketSize, len(head), head[:min(8, len(head))])
+}
+
+// syncOffset finds the first offset below size at which count sync bytes
+// follow one another size bytes apart.
+func syncOffset(data []byte, size, count int) (int, bool) {
+	if count < 1 {
+		return 0, false
+	}
+	for off := 0; off < size; off++ {
+		if off+(count-1)*size >= len(data) {
+			break
+		}
+		ok := true
+		for i := 0; i < count; i++ {
+			if data[off+i*size] != SyncByte {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return off, true
+		}
+	}
+	return 0, false
+}
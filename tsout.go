@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"sync"
+)
+
+// tsTap copies everything read through it to a file: with -tsout, the TS
+// exactly as the DVB-S encoder receives it, after every stage that rewrites
+// the stream. A failed write stops the recording, not the transmission.
+type tsTap struct {
+	src io.Reader
+
+	mu  sync.Mutex
+	out *bufio.Writer // nil once a write has failed
+}
+
+func newTSTap(src io.Reader, out io.Writer) *tsTap {
+	return &tsTap{src: src, out: bufio.NewWriterSize(out, 1<<20)}
+}
+
+// Read implements io.Reader.
+func (t *tsTap) Read(p []byte) (int, error) {
+	n, err := t.src.Read(p)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.out != nil && n > 0 {
+		if _, werr := t.out.Write(p[:n]); werr != nil {
+			log.Printf("WARNING: -tsout write failed, no longer recording: %v", werr)
+			t.out = nil
+		}
+	}
+	return n, err
+}
+
+// Flush writes out what is still buffered; the encoder may still be reading.
+func (t *tsTap) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.out != nil {
+		t.out.Flush()
+	}
+}
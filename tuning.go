@@ -0,0 +1,95 @@
+package main
+
+import "math"
+
+// Largest -freq-correction accepted; a HackRF's TCXO is good to a few ppm
+const maxFreqCorrectionPPM = 100
+
+// HackRF firmware tuning: below 2170 MHz and from 2740 MHz the RFFC5071
+// mixer LO is set to a whole number of MHz and the MAX2837 makes up the
+// rest as an IF near 2.5 GHz; in between the MAX2837 tunes directly.
+const (
+	hackrfMinBypassMHz = 2170
+	hackrfMinHighMHz   = 2740
+	hackrfMid1HighMHz  = 3600
+	hackrfMid2HighMHz  = 5100
+
+	rffcRefMHz = 40
+	rffcLOMax  = 5400 // MHz
+
+	max2837Step = 30_000_000 // Hz per integer divide step; the fraction has 20 bits
+)
+
+// correctFreq returns the frequency to request so that a radio whose
+// reference runs ppm fast (or slow, if negative) lands on hz.
+func correctFreq(hz, ppm float64) uint64 {
+	return uint64(math.Round(hz / (1 + ppm/1e6)))
+}
+
+// hackrfTunedHz returns the frequency a HackRF synthesizes when asked for
+// hz, by the firmware's own arithmetic: the MAX2837 fraction is truncated
+// to its 20-bit step of about 28.6 Hz, so the result is off by about that
+// much at most, before any reference error.
+func hackrfTunedHz(hz uint64) float64 {
+	mhz := hz / 1_000_000
+	switch {
+	case mhz < hackrfMinBypassMHz:
+		// IF graded from 2650 MHz down to 2340 MHz; RF = LO - IF
+		nominal := 2_650_000_000 - hz/7
+		lo, actual := rffcTunedHz(nominal/1_000_000 + mhz)
+		return actual - max2837TunedHz(lo-hz)
+	case mhz < hackrfMinHighMHz:
+		return max2837TunedHz(hz)
+	default:
+		// IF graded across 2150-2738 MHz; RF = LO + IF
+		var nominal uint64
+		switch {
+		case mhz < hackrfMid1HighMHz:
+			nominal = 2_150_000_000 + (hz-2_750_000_000)*60/85
+		case mhz < hackrfMid2HighMHz:
+			nominal = 2_350_000_000 + (hz-3_600_000_000)/5
+		default:
+			nominal = 2_500_000_000 + (hz-5_100_000_000)/9
+		}
+		lo, actual := rffcTunedHz(mhz - nominal/1_000_000)
+		return actual + max2837TunedHz(hz-lo)
+	}
+}
+
+// rffcTunedHz returns the RFFC5071 LO for a request of mhz: as the firmware
+// reports it, truncated to whole Hz, and as it actually is.
+func rffcTunedHz(mhz uint64) (reported uint64, actual float64) {
+	nLO := 0
+	for x := rffcLOMax / mhz; x > 1 && nLO < 5; x >>= 1 {
+		nLO++
+	}
+	lodiv := uint64(1) << nLO
+	fvco := lodiv * mhz
+	fbkdiv := uint64(2)
+	if fvco > 3200 {
+		fbkdiv = 4
+	}
+	n := (fvco << 29) / (fbkdiv * rffcRefMHz)
+	num := rffcRefMHz * (n >> 5) * fbkdiv * 1_000_000
+	den := lodiv << 24
+	return num / den, float64(num) / float64(den)
+}
+
+// max2837TunedHz returns the frequency the MAX2837 synthesizes for a
+// request of hz. The firmware picks the fraction bit by bit against a
+// halving comparison value, truncated to whole Hz at each step.
+func max2837TunedHz(hz uint64) float64 {
+	divInt := hz / max2837Step
+	rem := hz % max2837Step
+	var frac uint64
+	cmp := uint64(max2837Step)
+	for range 20 {
+		frac <<= 1
+		cmp >>= 1
+		if rem > cmp {
+			frac |= 1
+			rem -= cmp
+		}
+	}
+	return float64(divInt*max2837Step) + float64(frac)*max2837Step/(1<<20)
+}
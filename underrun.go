@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+const (
+	// Monitor intervals in a row with underflows before the host is
+	// considered too slow rather than briefly disturbed (15 s at 5 s ticks)
+	sustainedUnderrunIntervals = 3
+
+	// -adaptive never lowers the frame rate below this
+	minAdaptiveFPS = 10
+)
+
+// underrunWatch spots sustained underflows in the monitor's readings.
+type underrunWatch struct {
+	last   uint64
+	streak int
+}
+
+// Update takes the ring's underflow total at a monitor tick and reports
+// true once each time the underflows have persisted for
+// sustainedUnderrunIntervals ticks.
+func (w *underrunWatch) Update(total uint64) bool {
+	if total > w.last {
+		w.streak++
+	} else {
+		w.streak = 0
+	}
+	w.last = total
+	return w.streak == sustainedUnderrunIntervals
+}
+
+// recommendForUnderruns explains what to change when the host cannot
+// generate samples in real time.
+func recommendForUnderruns(taps, fps int, liveEncoder bool) string {
+	advice := fmt.Sprintf("the host cannot generate samples in real time. Lower the CPU load: fewer RRC taps (-taps %d now; 21 still spans 10 symbols)", taps)
+	if liveEncoder {
+		advice += fmt.Sprintf(", a smaller -size or a lower -fps (%d now) for FFmpeg", fps)
+	}
+	return advice + ", or a lower symbol rate (consts.SymbolRate), which also lowers the channel capacity"
+}
+
+// degradeEncoder restarts the live encoder at two thirds of its frame rate,
+// returning false once the frame rate is at its floor.
+func degradeEncoder(src *ffmpegSource) bool {
+	opts := src.Options()
+	fps := max(minAdaptiveFPS, opts.FPS*2/3)
+	if fps == opts.FPS {
+		return false
+	}
+	log.Printf("Adaptive: lowering the frame rate from %d to %d fps to free CPU for the modulator", opts.FPS, fps)
+	opts.FPS = fps
+	if err := src.Restart(opts); err != nil {
+		log.Printf("WARNING: Adaptive restart failed: %v", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Interval at which LogLimited lets a repeated message through
+const limitInterval = time.Second
+
+// In -quiet mode only messages that start with one of these are kept,
+// along with slog records at warning level and above and Fatal's messages.
+// The call site chooses: a status line that merely mentions errors, such
+// as a count of none, is not one.
+var quietPrefixes = []string{"Error:", "WARNING:", "Warning:"}
+
+// logTime is the standard log package's date and time format.
+const logTime = "2006/01/02 15:04:05 "
+
+var (
+	jsonLogs bool
+	quiet    atomic.Bool
+)
+
+// SetupLogging selects the log output format: "text" (the standard log
+// package format) or "json" (one object per line for Loki/ELK). In JSON
+// mode plain log.Printf calls are routed through slog as well. quiet drops
+// everything but errors and warnings (see SetQuiet).
+func SetupLogging(format string, q bool) error {
+	quiet.Store(q)
+	switch format {
+	case "text":
+		// quietWriter stamps the time itself, after it has looked at the
+		// start of the message
+		log.SetFlags(0)
+		log.SetOutput(&quietWriter{out: os.Stderr})
+	case "json":
+		slog.SetDefault(slog.New(quietHandler{slog.NewJSONHandler(os.Stderr, nil)}))
+		jsonLogs = true
+	default:
+		return fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+	return nil
+}
+
+// SetQuiet switches between logging everything and errors and warnings
+// only, at any time.
+func SetQuiet(q bool) {
+	quiet.Store(q)
+}
+
+// JSONLogs reports whether logs are JSON, so callers can attach structured
+// fields instead of formatting them into the message.
+func JSONLogs() bool {
+	return jsonLogs
+}
+
+// keepQuiet reports whether msg starts with one of quietPrefixes.
+func keepQuiet(msg string) bool {
+	for _, p := range quietPrefixes {
+		if strings.HasPrefix(msg, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// quietWriter passes on only the log lines that report errors or warnings
+// while quiet is set, with the date and time in front. The log package
+// writes each message with a single Write call.
+type quietWriter struct {
+	out io.Writer
+}
+
+func (w *quietWriter) Write(p []byte) (int, error) {
+	if quiet.Load() && !keepQuiet(string(p)) {
+		return len(p), nil
+	}
+	if _, err := w.out.Write(append([]byte(time.Now().Format(logTime)), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// quietHandler passes on only the slog records that report errors or
+// warnings while quiet is set.
+type quietHandler struct {
+	slog.Handler
+}
+
+func (h quietHandler) Handle(ctx context.Context, r slog.Record) error {
+	if quiet.Load() && r.Level < slog.LevelWarn && !keepQuiet(r.Message) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h quietHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return quietHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h quietHandler) WithGroup(name string) slog.Handler {
+	return quietHandler{h.Handler.WithGroup(name)}
+}
+
+var limited struct {
+	sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+}
+
+// LogLimited logs like log.Printf, but lets each format through at most
+// once a second, so a message that can fire for every packet cannot flood
+// the log. Repeats in between are counted and the count is reported with
+// the next one logged.
+func LogLimited(format string, v ...any) {
+	limited.Lock()
+	if limited.last == nil {
+		limited.last = make(map[string]time.Time)
+		limited.suppressed = make(map[string]int)
+	}
+	now := time.Now()
+	if now.Sub(limited.last[format]) < limitInterval {
+		limited.suppressed[format]++
+		limited.Unlock()
+		return
+	}
+	limited.last[format] = now
+	n := limited.suppressed[format]
+	limited.suppressed[format] = 0
+	limited.Unlock()
+
+	msg := fmt.Sprintf(format, v...)
+	if n > 0 {
+		msg += fmt.Sprintf(" (%d more suppressed)", n)
+	}
+	log.Print(msg)
+}
+
+// Fatal logs like log.Fatal, whether or not quiet is set, and exits.
+func Fatal(v ...any) {
+	fatal(fmt.Sprint(v...))
+}
+
+// Fatalf logs like log.Fatalf, whether or not quiet is set, and exits.
+func Fatalf(format string, v ...any) {
+	fatal(fmt.Sprintf(format, v...))
+}
+
+func fatal(msg string) {
+	if jsonLogs {
+		slog.Error(msg)
+	} else {
+		fmt.Fprintln(os.Stderr, time.Now().Format(logTime)+msg)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestQuiet checks that -quiet keeps warnings and errors, chosen by their
+// prefix or slog level, and drops status lines that only mention errors.
+func TestQuiet(t *testing.T) {
+	defer SetQuiet(false)
+	SetQuiet(true)
+
+	cases := []struct {
+		msg  string
+		keep bool
+	}{
+		{"WARNING: DEBUG mode, -no-rs. The transmitted signal is NOT valid DVB-S!", true},
+		{"Warning: Lost TS packet sync.", true},
+		{"Error: encoder failed: EOF", true},
+		{"Scrambler framing errors: 0", false},
+		{"Injected errors: 0 in 12 packets", false},
+		{"Starting transmission...", false},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		w := &quietWriter{out: &out}
+		if n, err := w.Write([]byte(c.msg + "\n")); err != nil || n != len(c.msg)+1 {
+			t.Errorf("%q: Write returned %d, %v", c.msg, n, err)
+		}
+		if got := strings.HasSuffix(out.String(), " "+c.msg+"\n"); got != c.keep {
+			t.Errorf("%q: text log kept %v, want %v (wrote %q)", c.msg, got, c.keep, out.String())
+		}
+
+		out.Reset()
+		h := quietHandler{slog.NewTextHandler(&out, nil)}
+		slog.New(h).Info(c.msg)
+		if got := out.Len() > 0; got != c.keep {
+			t.Errorf("%q: slog kept %v, want %v", c.msg, got, c.keep)
+		}
+	}
+
+	var out bytes.Buffer
+	slog.New(quietHandler{slog.NewTextHandler(&out, nil)}).Warn("sample rate off nominal", "error_pct", 0.2)
+	if out.Len() == 0 {
+		t.Errorf("slog warning dropped")
+	}
+}
@@ -8,7 +8,20 @@ import (
 
 // WaitForSignal blocks until a SIGINT or SIGTERM is received.
 func WaitForSignal() {
+	<-NotifySignal()
+}
+
+// NotifySignal returns a channel that receives the next SIGINT or SIGTERM.
+func NotifySignal() <-chan os.Signal {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	<-ch
+	return ch
+}
+
+// NotifyReload returns a channel that receives each SIGHUP, the daemon
+// convention for re-reading configuration. It never fires on Windows.
+func NotifyReload() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	return ch
 }
\ No newline at end of file
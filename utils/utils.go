@@ -2,14 +2,27 @@ package utils
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"strconv"
+	"strings"
 )
 
 func LogFFmpeg(ffmpegStderr io.Reader) {
-	scanner := bufio.NewScanner(ffmpegStderr)
+	LogProcess("ffmpeg", ffmpegStderr)
+}
+
+// LogProcess logs each line a helper process writes, tagged with its name.
+func LogProcess(name string, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
 	for scanner.Scan() {
-		log.Printf("[ffmpeg] %s", scanner.Text())
+		if jsonLogs {
+			slog.Info(scanner.Text(), "source", name)
+			continue
+		}
+		log.Printf("[%s] %s", name, scanner.Text())
 	}
 }
 
@@ -20,4 +33,32 @@ func Parity(n uint16) byte {
 	n ^= n >> 2
 	n ^= n >> 1
 	return byte(n & 1)
+}
+
+// ReverseBits returns the low n bits of v in reverse order
+func ReverseBits(v uint16, n int) uint16 {
+	var r uint16
+	for i := 0; i < n; i++ {
+		r = (r << 1) | (v>>uint(i))&1
+	}
+	return r
+}
+
+// ParseBitrate parses an FFmpeg-style bitrate such as "700k" or "1.5M" into bits/s
+func ParseBitrate(s string) (float64, error) {
+	mult := 1.0
+	num := strings.TrimSpace(s)
+	switch {
+	case strings.HasSuffix(num, "k"), strings.HasSuffix(num, "K"):
+		mult = 1e3
+		num = num[:len(num)-1]
+	case strings.HasSuffix(num, "M"):
+		mult = 1e6
+		num = num[:len(num)-1]
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid bitrate %q", s)
+	}
+	return v * mult, nil
 }
\ No newline at end of file
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"math/bits"
+	"testing"
+)
+
+func TestParity(t *testing.T) {
+	for n := 0; n < 1<<16; n++ {
+		want := byte(bits.OnesCount16(uint16(n)) & 1)
+		if got := Parity(uint16(n)); got != want {
+			t.Fatalf("Parity(%#04x) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestReverseBits(t *testing.T) {
+	tests := []struct {
+		v    uint16
+		n    int
+		want uint16
+	}{
+		{0x79, 7, 0x4F}, // DVB-S generator X, 171 octal
+		{0x5B, 7, 0x6D}, // DVB-S generator Y, 133 octal
+		{0x01, 7, 0x40},
+		{0x7F, 7, 0x7F},
+		{0x00, 7, 0x00},
+		{0x0001, 16, 0x8000},
+		{0xFF01, 8, 0x80}, // bits above n are ignored
+	}
+	for _, tt := range tests {
+		if got := ReverseBits(tt.v, tt.n); got != tt.want {
+			t.Errorf("ReverseBits(%#x, %d) = %#x, want %#x", tt.v, tt.n, got, tt.want)
+		}
+	}
+}